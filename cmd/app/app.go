@@ -2,13 +2,21 @@ package app
 
 import (
 	"1337b04rd/internal/adapters/db/repository"
+	"1337b04rd/internal/adapters/events"
 	"1337b04rd/internal/adapters/external_api"
 	"1337b04rd/internal/adapters/http/handlers"
+	"1337b04rd/internal/adapters/identity"
 	"1337b04rd/internal/config"
+	"1337b04rd/internal/domain"
 	"1337b04rd/internal/logger"
+	"1337b04rd/internal/media"
 	"1337b04rd/internal/server"
 	"1337b04rd/internal/services"
+	"context"
+	"database/sql"
+	"expvar"
 	"log/slog"
+	"time"
 )
 
 func RunServer() {
@@ -28,20 +36,70 @@ func RunServer() {
 	postRepo := repository.NewPostRepository(db)
 	commentRepo := repository.NewCommentRepository(db)
 	userRepo := repository.NewUserRepository(db)
+	attachmentRepo := repository.NewAttachmentRepository(db)
 
-	avatarProvider := external_api.NewRickAndMortyClient()
+	s3Service := services.NewS3Service(config.S3Config.BaseURL, config.S3Config.PublicURL, config.S3Config.PresignSecret, config.S3Config.PresignTTL)
 
-	userService := services.NewUserService(userRepo, avatarProvider)
-	postService := services.NewPostService(postRepo, commentRepo, userRepo)
-	commentService := services.NewCommentService(commentRepo, postRepo)
-	s3Service := services.NewS3Service(config.S3Config.BaseURL, config.S3Config.PublicURL)
+	identityProvider, err := newIdentityProvider(config)
+	if err != nil {
+		slog.Error("Failed to set up identity provider", "error", err)
+		return
+	}
+	avatarProvider := services.NewAvatarMirror(identityProvider, s3Service, external_api.FetchImage, config.S3Config.PublicURL)
+
+	eventBus, err := newEventBus(config, db)
+	if err != nil {
+		slog.Error("Failed to set up event bus", "error", err)
+		return
+	}
+
+	userService := services.NewUserService(userRepo, avatarProvider, config.SessionConfig.TTL)
+	postService := services.NewPostService(postRepo, commentRepo, userRepo, attachmentRepo, s3Service, eventBus, config.BoardConfig.BumpLimit)
+	commentService := services.NewCommentService(commentRepo, postRepo, attachmentRepo, eventBus)
 
-	handler := handlers.NewHandler(userService, postService, commentService, s3Service)
+	handler := handlers.NewHandler(userService, postService, commentService, s3Service, eventBus, config.ModeratorConfig.Token, handlers.UploadLimits{
+		MaxFiles: config.BoardConfig.MaxAttachments,
+		Limits: media.Limits{
+			MaxImageSize: config.BoardConfig.MaxImageSize,
+			MaxVideoSize: config.BoardConfig.MaxVideoSize,
+			MaxDuration:  config.BoardConfig.MaxVideoDuration,
+		},
+	})
 	server := server.NewServer(config, handler)
 
 	handler.StartArchiveWorker()
+	handler.StartSessionCleanupWorker(config.SessionConfig.CleanupInterval)
+	if retention := config.RetentionConfig; retention.Days > 0 {
+		handler.StartPurgeWorker(retention.Interval, time.Duration(retention.Days)*24*time.Hour, retention.BatchSize, retention.DryRun)
+	}
 	server.Run()
 }
 
+func newIdentityProvider(cfg *config.Config) (domain.IdentityProvider, error) {
+	switch cfg.IdentityConfig.Theme {
+	case config.IdentityThemeWordList:
+		return identity.NewWordListProvider(), nil
+	case config.IdentityThemeRoster:
+		return identity.NewRosterProvider(cfg.IdentityConfig.RosterFile)
+	default:
+		rickAndMortyClient := external_api.NewRickAndMortyClient(cfg.AvatarConfig.PoolSize)
+		rickAndMortyClient.Start(context.Background())
+		expvar.Publish("characterPool", expvar.Func(func() any { return rickAndMortyClient.Stats() }))
+
+		return external_api.NewFallbackAvatarProvider(
+			rickAndMortyClient,
+			external_api.NewLocalCharacterProvider(),
+			3*time.Second,
+		), nil
+	}
+}
+
+func newEventBus(cfg *config.Config, db *sql.DB) (domain.EventBus, error) {
+	if cfg.EventsConfig.Backend == config.EventsBackendPostgres {
+		return events.NewPostgresBus(db, repository.DSN(cfg.DBConfig))
+	}
+	return events.NewHub(), nil
+}
+
 // TODO:
 // unit tests
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"1337b04rd/internal/adapters/db/repository"
+	"1337b04rd/internal/adapters/external_api"
+	"1337b04rd/internal/config"
+	"1337b04rd/internal/logger"
+	"1337b04rd/internal/services"
+	"context"
+	"log/slog"
+	"os"
+)
+
+// Mirrors every avatar still pointing at a third-party host into the
+// triple-s avatars bucket and rewrites user_sessions.avatar_url accordingly.
+// Identicons that stand in for an avatar the app failed to mirror are
+// retried too.
+func main() {
+	logger.Init(slog.LevelInfo)
+
+	config, err := config.NewConfig()
+	if err != nil {
+		slog.Error("Failed to get configures", "error", err)
+		os.Exit(1)
+	}
+
+	db, err := repository.ConnectToDB(config.DBConfig)
+	if err != nil {
+		slog.Error("Failed to connect to database.", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	userRepo := repository.NewUserRepository(db)
+	s3Service := services.NewS3Service(config.S3Config.BaseURL, config.S3Config.PublicURL, config.S3Config.PresignSecret, config.S3Config.PresignTTL)
+	// Only Mirror is used here, so no upstream character provider is needed.
+	mirror := services.NewAvatarMirror(nil, s3Service, external_api.FetchImage, config.S3Config.PublicURL)
+
+	urls, err := userRepo.ListAvatarURLs(ctx)
+	if err != nil {
+		slog.Error("Failed to list avatar urls", "error", err)
+		os.Exit(1)
+	}
+
+	var rewritten, failed int64
+	for _, oldURL := range urls {
+		source := oldURL
+		if pending, ok := services.PendingAvatarSource(oldURL); ok {
+			source = pending
+		}
+		newURL, err := mirror.Mirror(ctx, source)
+		if err != nil {
+			slog.Error("Failed to mirror avatar", "url", source, "error", err)
+			failed++
+			continue
+		}
+		if newURL == oldURL {
+			continue
+		}
+
+		n, err := userRepo.ReplaceAvatarURL(ctx, oldURL, newURL)
+		if err != nil {
+			slog.Error("Failed to rewrite avatar url", "url", oldURL, "error", err)
+			failed++
+			continue
+		}
+		rewritten += n
+	}
+
+	slog.Info("Avatar backfill finished", "rewritten", rewritten, "failed", failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
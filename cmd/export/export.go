@@ -0,0 +1,64 @@
+package main
+
+import (
+	"1337b04rd/internal/adapters/db/repository"
+	"1337b04rd/internal/adapters/external_api"
+	"1337b04rd/internal/config"
+	"1337b04rd/internal/export"
+	"1337b04rd/internal/logger"
+	"1337b04rd/internal/services"
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+)
+
+// Renders every archived thread into a static directory that can be served
+// without the app, database or triple-s.
+func main() {
+	logger.Init(slog.LevelInfo)
+
+	// Registered before config.NewConfig, which calls flag.Parse.
+	out := flag.String("out", "archive-export", "Directory to write the static archive to")
+	templates := flag.String("templates", "internal/ui/templates", "Directory with the archive templates")
+
+	config, err := config.NewConfig()
+	if err != nil {
+		slog.Error("Failed to get configures", "error", err)
+		os.Exit(1)
+	}
+
+	db, err := repository.ConnectToDB(config.DBConfig)
+	if err != nil {
+		slog.Error("Failed to connect to database.", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	// The exporter only reads, it needs neither storage nor events.
+	userRepo := repository.NewUserRepository(db)
+	postService := services.NewPostService(
+		repository.NewPostRepository(db),
+		repository.NewCommentRepository(db),
+		userRepo,
+		repository.NewAttachmentRepository(db),
+		nil,
+		nil,
+		config.BoardConfig.BumpLimit,
+	)
+
+	exporter := export.NewExporter(
+		postService,
+		userRepo,
+		external_api.FetchImage,
+		*templates,
+	)
+
+	n, err := exporter.Export(context.Background(), *out)
+	if err != nil {
+		slog.Error("Failed to export archive", "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Archive export finished", "threads", n, "out", *out)
+}
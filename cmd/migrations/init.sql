@@ -1,4 +1,4 @@
-CREATE TABLE user_sessions (
+CREATE TABLE IF NOT EXISTS user_sessions (
     id SERIAL PRIMARY KEY,
     session_token TEXT UNIQUE NOT NULL,
     name TEXT NOT NULL, 
@@ -7,23 +7,54 @@ CREATE TABLE user_sessions (
     expires_at TIMESTAMP DEFAULT NOW() + INTERVAL '1 week'
 );
 
-CREATE TABLE posts (
+CREATE TABLE IF NOT EXISTS posts (
     id SERIAL PRIMARY KEY,
-    session_id INTEGER REFERENCES user_sessions(id) ON DELETE CASCADE,
+    session_id INTEGER REFERENCES user_sessions(id) ON DELETE RESTRICT,
     username TEXT,
     title TEXT NOT NULL,
     content TEXT NOT NULL,
     image_url TEXT,
     created_at TIMESTAMP DEFAULT NOW(),
     archived_at TIMESTAMP DEFAULT NOW() + INTERVAL '15 minutes',
-    is_archived BOOLEAN DEFAULT FALSE
+    last_bumped_at TIMESTAMP DEFAULT NOW(),
+    is_archived BOOLEAN DEFAULT FALSE,
+    is_pinned BOOLEAN DEFAULT FALSE,
+    is_sticky BOOLEAN DEFAULT FALSE,
+    is_locked BOOLEAN DEFAULT FALSE
 );
 
-CREATE TABLE comments (
+CREATE TABLE IF NOT EXISTS comments (
     id SERIAL PRIMARY KEY,
-    session_id INTEGER REFERENCES user_sessions(id) ON DELETE CASCADE,
+    session_id INTEGER REFERENCES user_sessions(id) ON DELETE RESTRICT,
     post_id INTEGER REFERENCES posts(id) ON DELETE CASCADE,
     parent_comment_id INTEGER,
     content TEXT NOT NULL,
     created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    object_key TEXT NOT NULL UNIQUE,
+    url TEXT NOT NULL,
+    thumbnail_url TEXT NOT NULL DEFAULT '',
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    filename TEXT NOT NULL DEFAULT '',
+    is_spoiler BOOLEAN DEFAULT FALSE,
+    position INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS purge_log (
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    image_url TEXT,
+    comment_count INTEGER NOT NULL,
+    archived_at TIMESTAMP,
+    purged_at TIMESTAMP DEFAULT NOW()
 );
\ No newline at end of file
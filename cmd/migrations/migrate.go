@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+
+	_ "github.com/lib/pq"
 )
 
 func main() {
@@ -14,16 +16,19 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	// Read the init.sql file
-	sqlBytes, err := os.ReadFile("init.sql")
-	if err != nil {
-		log.Fatalf("Failed to read init.sql: %v", err)
-	}
+	// init.sql creates what is missing, upgrade.sql alters what an older
+	// init.sql created. Both can run again.
+	for _, file := range []string{"init.sql", "upgrade.sql"} {
+		sqlBytes, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", file, err)
+		}
 
-	// Execute SQL
-	_, err = db.Exec(string(sqlBytes))
-	if err != nil {
-		log.Fatalf("Failed to execute SQL: %v", err)
+		// Execute SQL
+		_, err = db.Exec(string(sqlBytes))
+		if err != nil {
+			log.Fatalf("Failed to execute %s: %v", file, err)
+		}
 	}
 
 	log.Println("Database initialized successfully")
@@ -0,0 +1,55 @@
+-- Brings a database created from an older init.sql up to date. Every
+-- statement can run again, migrate.go applies this file after init.sql.
+
+-- Sessions with posts or comments can't be deleted, expired ones are kept
+-- until their content is gone.
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_session_id_fkey;
+ALTER TABLE posts ADD CONSTRAINT posts_session_id_fkey
+    FOREIGN KEY (session_id) REFERENCES user_sessions(id) ON DELETE RESTRICT;
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS comments_session_id_fkey;
+ALTER TABLE comments ADD CONSTRAINT comments_session_id_fkey
+    FOREIGN KEY (session_id) REFERENCES user_sessions(id) ON DELETE RESTRICT;
+
+-- Moderation flags.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS is_pinned BOOLEAN DEFAULT FALSE;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS is_sticky BOOLEAN DEFAULT FALSE;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS is_locked BOOLEAN DEFAULT FALSE;
+
+-- Bump order. Existing threads count as bumped when they were created.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS last_bumped_at TIMESTAMP;
+UPDATE posts SET last_bumped_at = created_at WHERE last_bumped_at IS NULL;
+ALTER TABLE posts ALTER COLUMN last_bumped_at SET DEFAULT NOW();
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+    object_key TEXT NOT NULL,
+    url TEXT NOT NULL,
+    thumbnail_url TEXT NOT NULL DEFAULT '',
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    filename TEXT NOT NULL DEFAULT '',
+    is_spoiler BOOLEAN DEFAULT FALSE,
+    position INTEGER NOT NULL DEFAULT 0
+);
+-- Video thumbnails and durations came after the table.
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS thumbnail_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS duration_ms INTEGER NOT NULL DEFAULT 0;
+-- An object belongs to one post or comment, the database settles two
+-- confirmations of the same presigned upload racing each other.
+ALTER TABLE attachments DROP CONSTRAINT IF EXISTS attachments_object_key_key;
+ALTER TABLE attachments ADD CONSTRAINT attachments_object_key_key UNIQUE (object_key);
+
+CREATE TABLE IF NOT EXISTS purge_log (
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    image_url TEXT,
+    comment_count INTEGER NOT NULL,
+    archived_at TIMESTAMP,
+    purged_at TIMESTAMP DEFAULT NOW()
+);
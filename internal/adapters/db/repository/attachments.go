@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"1337b04rd/internal/domain"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type AttachmentRepository struct {
+	db *sql.DB
+}
+
+func NewAttachmentRepository(db *sql.DB) domain.AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+// SaveAll stores the attachments in one transaction and fills in their IDs.
+func (r *AttachmentRepository) SaveAll(ctx context.Context, attachments []*domain.Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin attachments transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO attachments(post_id, comment_id, object_key, url, thumbnail_url, content_type, size, width, height, duration_ms, filename, is_spoiler, position)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`
+	for _, a := range attachments {
+		commentID := sql.NullInt64{Int64: int64(a.CommentID), Valid: a.CommentID != 0}
+		err := tx.QueryRowContext(ctx, query,
+			a.PostID, commentID, a.ObjectKey, a.URL, a.ThumbnailURL, a.ContentType, a.Size, a.Width, a.Height, a.Duration.Milliseconds(), a.Filename, a.Spoiler, a.Position,
+		).Scan(&a.ID)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Constraint == "attachments_object_key_key" {
+			return fmt.Errorf("%w: %s", domain.ErrAttachmentInUse, a.ObjectKey)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save attachment %q: %w", a.Filename, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FindByPostID returns every attachment in a thread, the opening post's and
+// the replies', in display order.
+func (r *AttachmentRepository) FindByPostID(ctx context.Context, postID int) ([]*domain.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + `
+			  FROM attachments
+			  WHERE post_id = $1
+			  ORDER BY comment_id NULLS FIRST, position`
+	return r.find(ctx, query, postID)
+}
+
+// FindByCommentID returns the attachments of one reply in display order.
+func (r *AttachmentRepository) FindByCommentID(ctx context.Context, commentID int) ([]*domain.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + `
+			  FROM attachments
+			  WHERE comment_id = $1
+			  ORDER BY position`
+	return r.find(ctx, query, commentID)
+}
+
+const attachmentColumns = `id, post_id, comment_id, object_key, url, thumbnail_url, content_type, size, width, height, duration_ms, filename, is_spoiler, position`
+
+func (r *AttachmentRepository) find(ctx context.Context, query string, args ...interface{}) ([]*domain.Attachment, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []*domain.Attachment
+	for rows.Next() {
+		a := &domain.Attachment{}
+		var commentID sql.NullInt64
+		var durationMs int64
+		err := rows.Scan(&a.ID, &a.PostID, &commentID, &a.ObjectKey, &a.URL, &a.ThumbnailURL, &a.ContentType, &a.Size, &a.Width, &a.Height, &durationMs, &a.Filename, &a.Spoiler, &a.Position)
+		if err != nil {
+			return nil, err
+		}
+		a.CommentID = int(commentID.Int64)
+		a.Duration = time.Duration(durationMs) * time.Millisecond
+		attachments = append(attachments, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// ObjectKeyInUse reports whether an attachment already stores the object.
+func (r *AttachmentRepository) ObjectKeyInUse(ctx context.Context, objectKey string) (bool, error) {
+	var inUse bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM attachments WHERE object_key = $1)`, objectKey).Scan(&inUse)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up attachment object: %w", err)
+	}
+	return inUse, nil
+}
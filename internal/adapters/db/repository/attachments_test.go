@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"1337b04rd/internal/domain"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAttachmentRepository_SaveAllAndFindByPostID(t *testing.T) {
+	repo := NewAttachmentRepository(testDB)
+	userID := createTestUser(t, testDB, "attachments")
+	postID := createTestPost(t, testDB, userID)
+	commentID := createTestComment(t, testDB, userID, postID)
+
+	attachments := []*domain.Attachment{
+		{PostID: postID, CommentID: commentID, ObjectKey: "posts/c.png", URL: "http://s3/posts/c.png", ContentType: "image/png", Size: 3, Filename: "c.png"},
+		{PostID: postID, ObjectKey: "posts/b.png", URL: "http://s3/posts/b.png", ContentType: "image/png", Size: 2, Filename: "b.png", Position: 1, Spoiler: true},
+		{PostID: postID, ObjectKey: "posts/a.png", URL: "http://s3/posts/a.png", ContentType: "image/png", Size: 1, Width: 10, Height: 20, Filename: "a.png"},
+	}
+	if err := repo.SaveAll(context.Background(), attachments); err != nil {
+		t.Fatalf("SaveAll failed: %v", err)
+	}
+	for _, a := range attachments {
+		if a.ID == 0 {
+			t.Errorf("Expected ID to be set for %s", a.Filename)
+		}
+	}
+
+	found, err := repo.FindByPostID(context.Background(), postID)
+	if err != nil {
+		t.Fatalf("FindByPostID failed: %v", err)
+	}
+	if len(found) != 3 {
+		t.Fatalf("Expected 3 attachments, got %d", len(found))
+	}
+
+	// Post attachments first, by position, then the replies'.
+	if found[0].Filename != "a.png" || found[1].Filename != "b.png" || found[2].Filename != "c.png" {
+		t.Errorf("Unexpected order: %s, %s, %s", found[0].Filename, found[1].Filename, found[2].Filename)
+	}
+	if found[0].Width != 10 || found[0].Height != 20 || found[0].CommentID != 0 {
+		t.Errorf("Unexpected post attachment: %+v", found[0])
+	}
+	if !found[1].Spoiler {
+		t.Error("Expected spoiler flag to round-trip")
+	}
+	if found[2].CommentID != commentID {
+		t.Errorf("Expected comment ID %d, got %d", commentID, found[2].CommentID)
+	}
+
+	byComment, err := repo.FindByCommentID(context.Background(), commentID)
+	if err != nil || len(byComment) != 1 || byComment[0].Filename != "c.png" {
+		t.Errorf("FindByCommentID = %v, %v; want c.png", byComment, err)
+	}
+
+	if inUse, err := repo.ObjectKeyInUse(context.Background(), "posts/b.png"); err != nil || !inUse {
+		t.Errorf("ObjectKeyInUse(posts/b.png) = %v, %v; want true", inUse, err)
+	}
+	if inUse, err := repo.ObjectKeyInUse(context.Background(), "posts/unknown.png"); err != nil || inUse {
+		t.Errorf("ObjectKeyInUse(posts/unknown.png) = %v, %v; want false", inUse, err)
+	}
+
+	// An object attached twice is refused by the database, whatever checks
+	// ran before.
+	again := []*domain.Attachment{{PostID: postID, ObjectKey: "posts/b.png", URL: "http://s3/posts/b.png", ContentType: "image/png", Size: 2, Filename: "b.png"}}
+	if err := repo.SaveAll(context.Background(), again); !errors.Is(err, domain.ErrAttachmentInUse) {
+		t.Errorf("SaveAll of an attached object = %v, want ErrAttachmentInUse", err)
+	}
+}
@@ -37,6 +37,13 @@ func (r CommentRepository) Save(ctx context.Context, comment *domain.Comment) (i
 	return id, nil
 }
 
+// Delete removes a comment that never made it, e.g. whose attachments
+// failed to save.
+func (r CommentRepository) Delete(ctx context.Context, commentID int) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM comments WHERE id = $1`, commentID)
+	return err
+}
+
 func (r CommentRepository) FindByID(ctx context.Context, commentID int) (*domain.Comment, error) {
 	var comment domain.Comment
 	query := `
@@ -60,10 +67,11 @@ func (r CommentRepository) FindByID(ctx context.Context, commentID int) (*domain
 
 func (r CommentRepository) FindByPostID(ctx context.Context, postID int) ([]*domain.Comment, error) {
 	query := `
-        SELECT id, session_id, post_id, parent_comment_id, content, created_at
-        FROM comments
-        WHERE post_id = $1
-        ORDER BY created_at ASC
+        SELECT c.id, c.session_id, c.post_id, c.parent_comment_id, c.content, c.created_at, COALESCE(u.name, '')
+        FROM comments c
+        LEFT JOIN user_sessions u ON u.id = c.session_id
+        WHERE c.post_id = $1
+        ORDER BY c.created_at ASC
     `
 
 	rows, err := r.db.QueryContext(ctx, query, postID)
@@ -77,6 +85,7 @@ func (r CommentRepository) FindByPostID(ctx context.Context, postID int) ([]*dom
 		var comment domain.Comment
 		var parentCommentID sql.NullInt64
 		var createdAt sql.NullTime
+		var userName string
 
 		err := rows.Scan(
 			&comment.ID,
@@ -85,6 +94,7 @@ func (r CommentRepository) FindByPostID(ctx context.Context, postID int) ([]*dom
 			&comment.ParentID,
 			&comment.Content,
 			&createdAt,
+			&userName,
 		)
 		if err != nil {
 			return nil, err
@@ -100,6 +110,8 @@ func (r CommentRepository) FindByPostID(ctx context.Context, postID int) ([]*dom
 		if createdAt.Valid {
 			comment.CreatedAt = createdAt.Time
 		}
+		// The author's name comes along, so listing a thread takes one query.
+		comment.User = &domain.User{ID: comment.UserID, Name: userName}
 
 		comments = append(comments, &comment)
 	}
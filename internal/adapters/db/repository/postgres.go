@@ -10,9 +10,12 @@ import (
 
 const POSTGRES = "postgres"
 
+func DSN(cfg *config.DBConfig) string {
+	return fmt.Sprintf("%s://%s:%s@%s:%s/%s?sslmode=disable", POSTGRES, cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBName)
+}
+
 func ConnectToDB(cfg *config.DBConfig) (*sql.DB, error) {
-	conn := fmt.Sprintf("%s://%s:%s@%s:%s/%s?sslmode=disable", POSTGRES, cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBName)
-	db, err := sql.Open(POSTGRES, conn)
+	db, err := sql.Open(POSTGRES, DSN(cfg))
 	if err != nil {
 		return nil, err
 	}
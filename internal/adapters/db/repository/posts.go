@@ -6,8 +6,20 @@ import (
 	"database/sql"
 	"fmt"
 	"time"
+
+	"github.com/lib/pq"
 )
 
+const postColumns = `id, session_id, username, title, content, image_url, created_at, archived_at, last_bumped_at, is_archived, is_pinned, is_sticky, is_locked`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPost(row rowScanner, post *domain.Post) error {
+	return row.Scan(&post.ID, &post.UserID, &post.Username, &post.Title, &post.Content, &post.ImageURL, &post.CreatedAt, &post.ArchivedAt, &post.LastBumpedAt, &post.Archived, &post.Pinned, &post.Sticky, &post.Locked)
+}
+
 type PostRepository struct {
 	db *sql.DB
 }
@@ -31,9 +43,8 @@ func (r *PostRepository) Save(ctx context.Context, post *domain.Post) (int, erro
 func (r *PostRepository) FindByID(ctx context.Context, id int) (*domain.Post, error) {
 	post := &domain.Post{}
 
-	query := `SELECT * FROM posts WHERE id = $1`
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&post.ID, &post.UserID, &post.Username, &post.Title, &post.Content, &post.ImageURL, &post.CreatedAt, &post.ArchivedAt, &post.Archived)
+	query := `SELECT ` + postColumns + ` FROM posts WHERE id = $1`
+	err := scanPost(r.db.QueryRowContext(ctx, query, id), post)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("post with id %d doesn't exist", id)
@@ -69,7 +80,7 @@ func (r *PostRepository) FindByID(ctx context.Context, id int) (*domain.Post, er
 
 func (r *PostRepository) FindAll(ctx context.Context, archived bool) ([]*domain.Post, error) {
 	posts := []*domain.Post{}
-	query := `SELECT * FROM posts WHERE is_archived = $1`
+	query := `SELECT ` + postColumns + ` FROM posts WHERE is_archived = $1 ORDER BY is_sticky DESC, last_bumped_at DESC`
 
 	rows, err := r.db.QueryContext(ctx, query, archived)
 	if err != nil {
@@ -79,7 +90,7 @@ func (r *PostRepository) FindAll(ctx context.Context, archived bool) ([]*domain.
 
 	for rows.Next() {
 		post := &domain.Post{}
-		err = rows.Scan(&post.ID, &post.UserID, &post.Username, &post.Title, &post.Content, &post.ImageURL, &post.CreatedAt, &post.ArchivedAt, &post.Archived)
+		err = scanPost(rows, post)
 		if err != nil {
 			return nil, err
 		}
@@ -134,23 +145,139 @@ func (r *PostRepository) Update(ctx context.Context, post *domain.Post) error {
 	return nil
 }
 
-func (r *PostRepository) ArchiveExpired(ctx context.Context) error {
+func (r *PostRepository) ArchiveExpired(ctx context.Context) ([]int, error) {
 	query := `UPDATE posts
 			  SET is_archived = true
-			  WHERE is_archived = false AND archived_at < NOW()`
-	_, err := r.db.ExecContext(ctx, query)
+			  WHERE is_archived = false AND is_sticky = false AND archived_at < NOW()
+			  RETURNING id`
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
-		return fmt.Errorf("failed to archive expired posts: %w", err)
+		return nil, fmt.Errorf("failed to archive expired posts: %w", err)
 	}
-	return nil
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
 }
 
-func (r *PostRepository) Add15Min(ctx context.Context, id int) error {
+// Add15Min bumps the post: it pushes archived_at 15 minutes ahead and moves
+// the post to the top of the catalog, unless the thread already has more
+// than bumpLimit comments. It reports whether the post was bumped.
+func (r *PostRepository) Add15Min(ctx context.Context, id, bumpLimit int) (bool, error) {
 	time := time.Now().Add(15 * time.Minute)
-	query := `UPDATE posts SET archived_at = $2 WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id, time)
+	query := `UPDATE posts SET archived_at = $2, last_bumped_at = NOW()
+			  WHERE id = $1 AND (SELECT COUNT(*) FROM comments WHERE post_id = $1) <= $3`
+	result, err := r.db.ExecContext(ctx, query, id, time, bumpLimit)
+	if err != nil {
+		return false, fmt.Errorf("failed to add 15 minutes to post lifetime: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// FindPurgeable returns up to limit archived, unpinned posts archived before
+// the cutoff, ordered by id and starting after afterID.
+func (r *PostRepository) FindPurgeable(ctx context.Context, archivedBefore time.Time, afterID, limit int) ([]*domain.Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts
+			  WHERE is_archived = true AND is_pinned = false AND archived_at < $1 AND id > $2
+			  ORDER BY id
+			  LIMIT $3`
+	rows, err := r.db.QueryContext(ctx, query, archivedBefore, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find purgeable posts: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []*domain.Post
+	for rows.Next() {
+		post := &domain.Post{}
+		if err := scanPost(rows, post); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// Purge records the posts in purge_log and deletes them together with their
+// comments in one transaction.
+func (r *PostRepository) Purge(ctx context.Context, ids []int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin purge transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	auditQuery := `INSERT INTO purge_log(post_id, title, image_url, comment_count, archived_at)
+				   SELECT p.id, p.title, p.image_url,
+				          (SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id),
+				          p.archived_at
+				   FROM posts p
+				   WHERE p.id = ANY($1)`
+	if _, err := tx.ExecContext(ctx, auditQuery, pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to record purged posts: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM posts WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to delete purged posts: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostRepository) SetFlag(ctx context.Context, postID int, flag domain.PostFlag, value bool) error {
+	var column string
+	switch flag {
+	case domain.PostFlagSticky:
+		column = "is_sticky"
+	case domain.PostFlagLocked:
+		column = "is_locked"
+	case domain.PostFlagPinned:
+		column = "is_pinned"
+	default:
+		return fmt.Errorf("unknown post flag %q", flag)
+	}
+
+	query := `UPDATE posts SET ` + column + ` = $2 WHERE id = $1`
+	result, err := r.db.ExecContext(ctx, query, postID, value)
+	if err != nil {
+		return fmt.Errorf("failed to set post %s flag: %w", flag, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to add 15 minutes to post lifetime: %w", err)
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: %d", domain.ErrPostNotFound, postID)
+	}
+	return nil
+}
+
+// Delete removes a post that never made it, e.g. whose attachments failed to
+// save. Posts that lived on the board are purged instead, see Purge.
+func (r *PostRepository) Delete(ctx context.Context, postID int) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM posts WHERE id = $1`, postID); err != nil {
+		return fmt.Errorf("failed to delete post: %w", err)
 	}
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"1337b04rd/internal/domain"
 	"context"
 	"database/sql"
+	"errors"
 	"log"
 	"os"
 	"testing"
@@ -56,24 +57,55 @@ func setupTestDatabase(db *sql.DB) {
 		
 		CREATE TABLE IF NOT EXISTS posts (
 			id SERIAL PRIMARY KEY,
-			session_id INTEGER REFERENCES user_sessions(id) ON DELETE CASCADE,
+			session_id INTEGER REFERENCES user_sessions(id) ON DELETE RESTRICT,
 			username TEXT,
 			title TEXT NOT NULL,
 			content TEXT NOT NULL,
 			image_url TEXT DEFAULT '',
 			created_at TIMESTAMP DEFAULT NOW(),
 			archived_at TIMESTAMP DEFAULT NOW() + INTERVAL '15 minutes',
-			is_archived BOOLEAN DEFAULT FALSE
+			last_bumped_at TIMESTAMP DEFAULT NOW(),
+			is_archived BOOLEAN DEFAULT FALSE,
+			is_pinned BOOLEAN DEFAULT FALSE,
+			is_sticky BOOLEAN DEFAULT FALSE,
+			is_locked BOOLEAN DEFAULT FALSE
 		);
 		
 		CREATE TABLE IF NOT EXISTS comments (
 			id SERIAL PRIMARY KEY,
-			session_id INTEGER REFERENCES user_sessions(id) ON DELETE CASCADE,
+			session_id INTEGER REFERENCES user_sessions(id) ON DELETE RESTRICT,
 			post_id INTEGER REFERENCES posts(id) ON DELETE CASCADE,
 			parent_comment_id INTEGER DEFAULT 0,
 			content TEXT NOT NULL,
 			created_at TIMESTAMP DEFAULT NOW()
 		);
+
+		CREATE TABLE IF NOT EXISTS attachments (
+			id SERIAL PRIMARY KEY,
+			post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+			comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+			object_key TEXT NOT NULL UNIQUE,
+			url TEXT NOT NULL,
+			thumbnail_url TEXT NOT NULL DEFAULT '',
+			content_type TEXT NOT NULL,
+			size BIGINT NOT NULL,
+			width INTEGER NOT NULL DEFAULT 0,
+			height INTEGER NOT NULL DEFAULT 0,
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			filename TEXT NOT NULL DEFAULT '',
+			is_spoiler BOOLEAN DEFAULT FALSE,
+			position INTEGER NOT NULL DEFAULT 0
+		);
+
+		CREATE TABLE IF NOT EXISTS purge_log (
+			id SERIAL PRIMARY KEY,
+			post_id INTEGER NOT NULL,
+			title TEXT NOT NULL,
+			image_url TEXT,
+			comment_count INTEGER NOT NULL,
+			archived_at TIMESTAMP,
+			purged_at TIMESTAMP DEFAULT NOW()
+		);
 	`)
 	if err != nil {
 		log.Fatal(err)
@@ -81,6 +113,8 @@ func setupTestDatabase(db *sql.DB) {
 
 	_, err = db.Exec(`
 		TRUNCATE 
+			purge_log,
+			attachments,
 			comments, 
 			posts, 
 			user_sessions 
@@ -94,6 +128,8 @@ func setupTestDatabase(db *sql.DB) {
 func cleanupTestDatabase(db *sql.DB) {
 	_, err := db.Exec(`
 		DROP TABLE IF EXISTS 
+			purge_log,
+			attachments,
 			comments, 
 			posts, 
 			user_sessions
@@ -275,10 +311,13 @@ func TestPostRepository_ArchiveExpired(t *testing.T) {
 		t.Fatalf("Failed to create test post: %v", err)
 	}
 
-	err = repo.ArchiveExpired(context.Background())
+	archivedIDs, err := repo.ArchiveExpired(context.Background())
 	if err != nil {
 		t.Fatalf("ArchiveExpired failed: %v", err)
 	}
+	if len(archivedIDs) == 0 {
+		t.Error("Expected archived post IDs to be returned")
+	}
 
 	// Verify the post was archived
 	var isArchived bool
@@ -305,10 +344,13 @@ func TestPostRepository_Add15Min(t *testing.T) {
 		t.Fatalf("Failed to get original time: %v", err)
 	}
 
-	err = repo.Add15Min(context.Background(), postID)
+	bumped, err := repo.Add15Min(context.Background(), postID, 300)
 	if err != nil {
 		t.Fatalf("Add15Min failed: %v", err)
 	}
+	if !bumped {
+		t.Fatal("Expected post to be bumped")
+	}
 
 	// Verify the time was increased
 	var newTime time.Time
@@ -323,4 +365,117 @@ func TestPostRepository_Add15Min(t *testing.T) {
 	if !newTime.After(originalTime) {
 		t.Errorf("Expected time to be increased, original: %v, new: %v", originalTime, newTime)
 	}
-}
\ No newline at end of file
+}
+func TestPostRepository_PurgeArchived(t *testing.T) {
+	repo := NewPostRepository(testDB)
+	userID := createTestUser(t, testDB, "purge")
+
+	insert := func(title string, pinned bool, archivedAt string) int {
+		var id int
+		err := testDB.QueryRow(`
+			INSERT INTO posts(session_id, username, title, content, image_url, archived_at, is_archived, is_pinned)
+			VALUES ($1, 'testuser', $2, 'Content', 'http://localhost:8080/posts/x.png', NOW() - $3::interval, true, $4)
+			RETURNING id
+		`, userID, title, archivedAt, pinned).Scan(&id)
+		if err != nil {
+			t.Fatalf("Failed to create test post: %v", err)
+		}
+		return id
+	}
+	oldID := insert("Old", false, "40 days")
+	insert("Pinned", true, "40 days")
+	insert("Recent", false, "1 day")
+	createTestComment(t, testDB, userID, oldID)
+
+	posts, err := repo.FindPurgeable(context.Background(), time.Now().Add(-30*24*time.Hour), 0, 10)
+	if err != nil {
+		t.Fatalf("FindPurgeable failed: %v", err)
+	}
+	if len(posts) != 1 || posts[0].ID != oldID {
+		t.Fatalf("Expected only post %d to be purgeable, got %+v", oldID, posts)
+	}
+
+	if err := repo.Purge(context.Background(), []int{oldID}); err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+
+	var remaining int
+	testDB.QueryRow("SELECT COUNT(*) FROM posts WHERE id = $1", oldID).Scan(&remaining)
+	if remaining != 0 {
+		t.Error("Expected purged post to be deleted")
+	}
+	testDB.QueryRow("SELECT COUNT(*) FROM comments WHERE post_id = $1", oldID).Scan(&remaining)
+	if remaining != 0 {
+		t.Error("Expected comments of the purged post to be deleted")
+	}
+
+	var title string
+	var comments int
+	err = testDB.QueryRow("SELECT title, comment_count FROM purge_log WHERE post_id = $1", oldID).Scan(&title, &comments)
+	if err != nil {
+		t.Fatalf("Expected a purge_log record: %v", err)
+	}
+	if title != "Old" || comments != 1 {
+		t.Errorf("Unexpected purge_log record: title=%q comments=%d", title, comments)
+	}
+}
+
+func TestPostRepository_SetFlag(t *testing.T) {
+	repo := NewPostRepository(testDB)
+	userID := createTestUser(t, testDB, "flags")
+	stickyID := createTestPost(t, testDB, userID)
+	regularID := createTestPost(t, testDB, userID)
+	testDB.Exec(`UPDATE posts SET archived_at = NOW() - INTERVAL '1 hour'`)
+
+	if err := repo.SetFlag(context.Background(), stickyID, domain.PostFlagSticky, true); err != nil {
+		t.Fatalf("SetFlag failed: %v", err)
+	}
+	if err := repo.SetFlag(context.Background(), stickyID, domain.PostFlagLocked, true); err != nil {
+		t.Fatalf("SetFlag failed: %v", err)
+	}
+
+	archived, err := repo.ArchiveExpired(context.Background())
+	if err != nil {
+		t.Fatalf("ArchiveExpired failed: %v", err)
+	}
+	if len(archived) != 1 || archived[0] != regularID {
+		t.Errorf("Expected only post %d to be archived, got %v", regularID, archived)
+	}
+
+	post, err := repo.FindByID(context.Background(), stickyID)
+	if err != nil {
+		t.Fatalf("FindByID failed: %v", err)
+	}
+	if !post.Sticky || !post.Locked {
+		t.Errorf("Expected sticky and locked post, got sticky=%v locked=%v", post.Sticky, post.Locked)
+	}
+
+	if err := repo.SetFlag(context.Background(), 9999, domain.PostFlagSticky, true); !errors.Is(err, domain.ErrPostNotFound) {
+		t.Errorf("Expected ErrPostNotFound, got %v", err)
+	}
+}
+
+func TestPostRepository_Add15Min_BumpLimit(t *testing.T) {
+	repo := NewPostRepository(testDB)
+	userID := createTestUser(t, testDB, "bumplimit")
+	postID := createTestPost(t, testDB, userID)
+	createTestComment(t, testDB, userID, postID)
+	createTestComment(t, testDB, userID, postID)
+
+	var before time.Time
+	testDB.QueryRow("SELECT last_bumped_at FROM posts WHERE id = $1", postID).Scan(&before)
+
+	bumped, err := repo.Add15Min(context.Background(), postID, 1)
+	if err != nil {
+		t.Fatalf("Add15Min failed: %v", err)
+	}
+	if bumped {
+		t.Error("Expected post over the bump limit not to be bumped")
+	}
+
+	var after time.Time
+	testDB.QueryRow("SELECT last_bumped_at FROM posts WHERE id = $1", postID).Scan(&after)
+	if !after.Equal(before) {
+		t.Errorf("Expected last_bumped_at to stay %v, got %v", before, after)
+	}
+}
@@ -3,10 +3,25 @@ package repository
 import (
 	"1337b04rd/internal/domain"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"strings"
+	"time"
 )
 
+// Session tokens are stored as SHA-256 digests so a database dump can't be
+// replayed as cookies. Rows written before hashing hold the raw token and are
+// rehashed the first time they are looked up.
+const tokenDigestPrefix = "sha256:"
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return tokenDigestPrefix + hex.EncodeToString(sum[:])
+}
+
 type UserRepository struct {
 	db *sql.DB
 }
@@ -36,10 +51,14 @@ func (r *UserRepository) FindByID(ctx context.Context, userID int) (*domain.User
 
 func (r *UserRepository) FindBySessionToken(ctx context.Context, sessionToken string) (*domain.User, error) {
 	var user domain.User
-	query := `SELECT id, session_token, name, avatar_url, expires_at FROM user_sessions WHERE session_token = $1`
-	err := r.db.QueryRowContext(ctx, query, sessionToken).Scan(
+	var storedToken string
+	digest := hashSessionToken(sessionToken)
+	query := `SELECT id, session_token, name, avatar_url, expires_at FROM user_sessions
+			  WHERE (session_token = $1 OR (session_token = $2 AND session_token NOT LIKE 'sha256:%'))
+			  AND expires_at > NOW()`
+	err := r.db.QueryRowContext(ctx, query, digest, sessionToken).Scan(
 		&user.ID,
-		&user.SessionToken,
+		&storedToken,
 		&user.Name,
 		&user.AvatarURL,
 		&user.ExpiresAt,
@@ -47,25 +66,46 @@ func (r *UserRepository) FindBySessionToken(ctx context.Context, sessionToken st
 	if err != nil {
 		return nil, err
 	}
+
+	if !strings.HasPrefix(storedToken, tokenDigestPrefix) {
+		if err := r.rehashLegacyToken(ctx, user.ID, digest); err != nil {
+			return nil, err
+		}
+	} else if subtle.ConstantTimeCompare([]byte(storedToken), []byte(digest)) != 1 {
+		return nil, sql.ErrNoRows
+	}
+
+	user.SessionToken = sessionToken
 	return &user, nil
 }
 
+func (r *UserRepository) rehashLegacyToken(ctx context.Context, userID int, digest string) error {
+	query := `UPDATE user_sessions SET session_token = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, digest, userID)
+	if err != nil {
+		return fmt.Errorf("failed to rehash legacy session token: %w", err)
+	}
+	return nil
+}
+
 func (r *UserRepository) GetUserIDBySessionToken(ctx context.Context, sesionToken string) (int, error) {
-	var userID int
-	query := `SELECT id FROM user_sessions WHERE session_token = $1`
-	err := r.db.QueryRowContext(ctx, query, sesionToken).Scan(&userID)
+	user, err := r.FindBySessionToken(ctx, sesionToken)
 	if err != nil {
 		return -1, err
 	}
 
-	return userID, nil
+	return user.ID, nil
 }
 
 func (r *UserRepository) Save(ctx context.Context, user *domain.User) (int, error) {
 	var userID int
-	query := `INSERT INTO user_sessions(session_token, name, avatar_url)
-			  VALUES ($1, $2, $3) RETURNING id`
-	err := r.db.QueryRowContext(ctx, query, user.SessionToken, user.Name, user.AvatarURL).Scan(&userID)
+	query := `INSERT INTO user_sessions(session_token, name, avatar_url, expires_at)
+			  VALUES ($1, $2, $3, COALESCE($4, NOW() + INTERVAL '1 week')) RETURNING id`
+	var expiresAt sql.NullTime
+	if !user.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: user.ExpiresAt, Valid: true}
+	}
+	err := r.db.QueryRowContext(ctx, query, hashSessionToken(user.SessionToken), user.Name, user.AvatarURL, expiresAt).Scan(&userID)
 	if err != nil {
 		return -1, err
 	}
@@ -92,3 +132,68 @@ func (r *UserRepository) UpdateName(ctx context.Context, userID int, newName str
 
 	return nil
 }
+
+func (r *UserRepository) ExtendSession(ctx context.Context, userID int, expiresAt time.Time) error {
+	query := `UPDATE user_sessions SET expires_at = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, expiresAt, userID)
+	if err != nil {
+		return fmt.Errorf("failed to extend session: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes expired sessions that don't own any posts or comments.
+// Sessions that authored content are kept so threads still render their author.
+func (r *UserRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM user_sessions s
+			  WHERE s.expires_at < NOW()
+			  AND NOT EXISTS (SELECT 1 FROM posts p WHERE p.session_id = s.id)
+			  AND NOT EXISTS (SELECT 1 FROM comments c WHERE c.session_id = s.id)`
+	result, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	return rowsAffected, nil
+}
+
+func (r *UserRepository) ListAvatarURLs(ctx context.Context) ([]string, error) {
+	query := `SELECT DISTINCT avatar_url FROM user_sessions`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+func (r *UserRepository) ReplaceAvatarURL(ctx context.Context, oldURL, newURL string) (int64, error) {
+	query := `UPDATE user_sessions SET avatar_url = $1 WHERE avatar_url = $2`
+	result, err := r.db.ExecContext(ctx, query, newURL, oldURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to replace avatar url: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	return rowsAffected, nil
+}
@@ -251,4 +251,165 @@ func TestUserRepository_UpdateName(t *testing.T) {
 			t.Error("Expected error for non-existent user, got nil")
 		}
 	})
-}
\ No newline at end of file
+}
+
+func TestUserRepository_FindBySessionToken_Expired(t *testing.T) {
+	repo := NewUserRepository(testDB)
+
+	token := "expired_session_token_" + time.Now().Format("20060102150405.000")
+	_, err := testDB.Exec(
+		"INSERT INTO user_sessions(session_token, name, avatar_url, expires_at) VALUES ($1, $2, $3, $4)",
+		token, "Expired User", "expired_avatar.png", time.Now().Add(-time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Failed to insert test user: %v", err)
+	}
+
+	_, err = repo.FindBySessionToken(context.Background(), token)
+	if err == nil {
+		t.Error("Expected error for expired session token, got nil")
+	}
+}
+
+func TestUserRepository_ExtendSession(t *testing.T) {
+	repo := NewUserRepository(testDB)
+	userID := createTestUser(t, testDB, "extend")
+
+	newExpiry := time.Now().Add(48 * time.Hour)
+	if err := repo.ExtendSession(context.Background(), userID, newExpiry); err != nil {
+		t.Fatalf("ExtendSession failed: %v", err)
+	}
+
+	var expiresAt time.Time
+	err := testDB.QueryRow("SELECT expires_at FROM user_sessions WHERE id = $1", userID).Scan(&expiresAt)
+	if err != nil {
+		t.Fatalf("Failed to verify session expiry: %v", err)
+	}
+
+	if expiresAt.Before(time.Now().Add(47 * time.Hour)) {
+		t.Errorf("Expected expiry to be extended, got %v", expiresAt)
+	}
+}
+
+func TestUserRepository_DeleteExpired(t *testing.T) {
+	repo := NewUserRepository(testDB)
+
+	suffix := "_" + time.Now().Format("20060102150405.000")
+	var idleID, posterID int
+	err := testDB.QueryRow(
+		"INSERT INTO user_sessions(session_token, name, expires_at) VALUES ($1, $2, NOW() - INTERVAL '1 day') RETURNING id",
+		"expired_idle_token"+suffix, "Idle User",
+	).Scan(&idleID)
+	if err != nil {
+		t.Fatalf("Failed to insert test user: %v", err)
+	}
+	err = testDB.QueryRow(
+		"INSERT INTO user_sessions(session_token, name, expires_at) VALUES ($1, $2, NOW() - INTERVAL '1 day') RETURNING id",
+		"expired_poster_token"+suffix, "Poster User",
+	).Scan(&posterID)
+	if err != nil {
+		t.Fatalf("Failed to insert test user: %v", err)
+	}
+	postID := createTestPost(t, testDB, posterID)
+
+	deleted, err := repo.DeleteExpired(context.Background())
+	if err != nil {
+		t.Fatalf("DeleteExpired failed: %v", err)
+	}
+	if deleted < 1 {
+		t.Errorf("Expected at least 1 deleted session, got %d", deleted)
+	}
+
+	var count int
+	testDB.QueryRow("SELECT COUNT(*) FROM user_sessions WHERE id = $1", idleID).Scan(&count)
+	if count != 0 {
+		t.Error("Expected idle expired session to be deleted")
+	}
+
+	testDB.QueryRow("SELECT COUNT(*) FROM posts WHERE id = $1", postID).Scan(&count)
+	if count != 1 {
+		t.Error("Expected post of expired session to survive the purge")
+	}
+}
+
+func TestUserRepository_SessionTokenHashedAtRest(t *testing.T) {
+	repo := NewUserRepository(testDB)
+	rawToken := "raw_secret_token_" + time.Now().Format("20060102150405.000")
+
+	id, err := repo.Save(context.Background(), &domain.User{
+		SessionToken: rawToken,
+		Name:         "Hashed User",
+		AvatarURL:    "hashed_avatar.png",
+	})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	var stored string
+	err = testDB.QueryRow("SELECT session_token FROM user_sessions WHERE id = $1", id).Scan(&stored)
+	if err != nil {
+		t.Fatalf("Failed to read stored token: %v", err)
+	}
+	if strings.Contains(stored, rawToken) {
+		t.Errorf("Expected raw token to never be stored, got %s", stored)
+	}
+	if stored != hashSessionToken(rawToken) {
+		t.Errorf("Expected stored token to be the SHA-256 digest, got %s", stored)
+	}
+
+	var rawCount int
+	testDB.QueryRow("SELECT COUNT(*) FROM user_sessions WHERE session_token = $1", rawToken).Scan(&rawCount)
+	if rawCount != 0 {
+		t.Errorf("Expected no rows holding the raw token, got %d", rawCount)
+	}
+
+	user, err := repo.FindBySessionToken(context.Background(), rawToken)
+	if err != nil {
+		t.Fatalf("FindBySessionToken failed: %v", err)
+	}
+	if user.ID != id {
+		t.Errorf("Expected user ID %d, got %d", id, user.ID)
+	}
+
+	t.Run("digest is not accepted as token", func(t *testing.T) {
+		_, err := repo.FindBySessionToken(context.Background(), stored)
+		if err == nil {
+			t.Error("Expected stored digest to be rejected as a session token")
+		}
+	})
+}
+
+func TestUserRepository_LegacyTokenRehashed(t *testing.T) {
+	repo := NewUserRepository(testDB)
+	legacyToken := "legacy_plaintext_token"
+
+	var id int
+	err := testDB.QueryRow(
+		"INSERT INTO user_sessions(session_token, name) VALUES ($1, $2) RETURNING id",
+		legacyToken, "Legacy User",
+	).Scan(&id)
+	if err != nil {
+		t.Fatalf("Failed to insert legacy user: %v", err)
+	}
+
+	user, err := repo.FindBySessionToken(context.Background(), legacyToken)
+	if err != nil {
+		t.Fatalf("FindBySessionToken failed for legacy token: %v", err)
+	}
+	if user.ID != id {
+		t.Errorf("Expected user ID %d, got %d", id, user.ID)
+	}
+
+	var stored string
+	err = testDB.QueryRow("SELECT session_token FROM user_sessions WHERE id = $1", id).Scan(&stored)
+	if err != nil {
+		t.Fatalf("Failed to read stored token: %v", err)
+	}
+	if stored != hashSessionToken(legacyToken) {
+		t.Errorf("Expected legacy token to be rehashed, got %s", stored)
+	}
+
+	if _, err := repo.FindBySessionToken(context.Background(), legacyToken); err != nil {
+		t.Errorf("Expected rehashed token to keep working, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"1337b04rd/internal/domain"
+	"context"
+	"log/slog"
+	"sync"
+)
+
+const subscriberBuffer = 16
+
+// Hub is an in-process pub/sub for board events. Slow subscribers miss events
+// instead of blocking publishers.
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[int]map[chan domain.Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[int]map[chan domain.Event]struct{})}
+}
+
+func (h *Hub) Publish(ctx context.Context, event domain.Event) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.deliver(h.subscribers[event.PostID], event)
+	if event.PostID != domain.AllPosts {
+		h.deliver(h.subscribers[domain.AllPosts], event)
+	}
+	return nil
+}
+
+func (h *Hub) deliver(subs map[chan domain.Event]struct{}, event domain.Event) {
+	for ch := range subs {
+		select {
+		case ch <- event:
+		default:
+			slog.Warn("Dropping event for slow subscriber", "type", event.Type, "postID", event.PostID)
+		}
+	}
+}
+
+func (h *Hub) Subscribe(postID int) (<-chan domain.Event, func()) {
+	ch := make(chan domain.Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[postID] == nil {
+		h.subscribers[postID] = make(map[chan domain.Event]struct{})
+	}
+	h.subscribers[postID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[postID], ch)
+			if len(h.subscribers[postID]) == 0 {
+				delete(h.subscribers, postID)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, unsubscribe
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"1337b04rd/internal/domain"
+	"context"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, ch <-chan domain.Event) (domain.Event, bool) {
+	t.Helper()
+	select {
+	case event, ok := <-ch:
+		return event, ok
+	case <-time.After(100 * time.Millisecond):
+		return domain.Event{}, false
+	}
+}
+
+func TestHub_PublishSubscribe(t *testing.T) {
+	hub := NewHub()
+	thread, unsubscribeThread := hub.Subscribe(1)
+	defer unsubscribeThread()
+	other, unsubscribeOther := hub.Subscribe(2)
+	defer unsubscribeOther()
+	board, unsubscribeBoard := hub.Subscribe(domain.AllPosts)
+	defer unsubscribeBoard()
+
+	hub.Publish(context.Background(), domain.Event{Type: domain.EventCommentAdded, PostID: 1, CommentID: 7})
+
+	event, ok := receive(t, thread)
+	if !ok || event.CommentID != 7 {
+		t.Errorf("expected thread subscriber to get the event, got %+v", event)
+	}
+	if _, ok := receive(t, board); !ok {
+		t.Error("expected board subscriber to get the event")
+	}
+	if _, ok := receive(t, other); ok {
+		t.Error("expected subscriber of another thread to get nothing")
+	}
+}
+
+func TestHub_Unsubscribe(t *testing.T) {
+	hub := NewHub()
+	ch, unsubscribe := hub.Subscribe(1)
+	unsubscribe()
+	unsubscribe()
+
+	if _, ok := <-ch; ok {
+		t.Error("expected channel to be closed after unsubscribe")
+	}
+	if len(hub.subscribers) != 0 {
+		t.Errorf("expected no subscribers left, got %d", len(hub.subscribers))
+	}
+
+	if err := hub.Publish(context.Background(), domain.Event{PostID: 1}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestHub_SlowSubscriberDoesNotBlock(t *testing.T) {
+	hub := NewHub()
+	_, unsubscribe := hub.Subscribe(1)
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < subscriberBuffer*2; i++ {
+			hub.Publish(context.Background(), domain.Event{PostID: 1})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a slow subscriber")
+	}
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"1337b04rd/internal/domain"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const notifyChannel = "board_events"
+
+// PostgresBus shares events between app replicas through LISTEN/NOTIFY.
+// Publishing only sends a NOTIFY; every replica, including the sender,
+// receives it on its listener and fans it out through a local Hub.
+type PostgresBus struct {
+	db       *sql.DB
+	hub      *Hub
+	listener *pq.Listener
+}
+
+func NewPostgresBus(db *sql.DB, dsn string) (*PostgresBus, error) {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Error("Event listener connection problem", "err", err)
+		}
+	})
+	if err := listener.Listen(notifyChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", notifyChannel, err)
+	}
+
+	bus := &PostgresBus{db: db, hub: NewHub(), listener: listener}
+	go bus.run()
+	return bus, nil
+}
+
+func (b *PostgresBus) run() {
+	for notification := range b.listener.Notify {
+		// A nil notification means the connection was re-established and
+		// events may have been missed, there is nothing to replay.
+		if notification == nil {
+			continue
+		}
+
+		var event domain.Event
+		if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+			slog.Error("Failed to decode event notification", "err", err)
+			continue
+		}
+		b.hub.Publish(context.Background(), event)
+	}
+}
+
+func (b *PostgresBus) Publish(ctx context.Context, event domain.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, notifyChannel, string(payload))
+	if err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+func (b *PostgresBus) Subscribe(postID int) (<-chan domain.Event, func()) {
+	return b.hub.Subscribe(postID)
+}
+
+func (b *PostgresBus) Close() error {
+	return b.listener.Close()
+}
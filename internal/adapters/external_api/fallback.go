@@ -0,0 +1,137 @@
+package external_api
+
+import (
+	"1337b04rd/internal/domain"
+	"1337b04rd/internal/identicon"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var bundledRoster = []string{
+	"Rick Sanchez", "Morty Smith", "Summer Smith", "Beth Smith", "Jerry Smith",
+	"Birdperson", "Squanchy", "Mr. Meeseeks", "Mr. Poopybutthole", "Unity",
+	"Evil Morty", "Krombopulos Michael", "Scary Terry", "Abradolf Lincler",
+	"Gearhead", "Noob-Noob", "Pickle Rick", "Tammy Guetermann", "Principal Vagina",
+	"Snuffles", "King Jellybean", "Gazorpazorpfield", "Revolio Clockberg Jr.",
+	"Mr. Goldenfold", "Jessica", "Ethan", "Cromulon", "Phoenixperson", "Toxic Rick",
+	"Doofus Rick", "Cop Rick", "Slick Morty", "Ants in my Eyes Johnson", "Glootie",
+}
+
+// LocalCharacterProvider hands out characters from a bundled roster together
+// with a locally generated identicon, so it never needs the network.
+type LocalCharacterProvider struct{}
+
+func NewLocalCharacterProvider() domain.IdentityProvider {
+	return &LocalCharacterProvider{}
+}
+
+func (l *LocalCharacterProvider) GenerateIdentity(ctx context.Context) (string, string, error) {
+	avatarURL, err := identicon.RandomAvatarURL()
+	if err != nil {
+		return "", "", err
+	}
+
+	name := bundledRoster[rand.Intn(len(bundledRoster))]
+	return name, avatarURL, nil
+}
+
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+type circuitBreaker struct {
+	mu          sync.Mutex
+	failures    int
+	threshold   int
+	cooldown    time.Duration
+	openedUntil time.Time
+}
+
+func (c *circuitBreaker) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().After(c.openedUntil)
+}
+
+func (c *circuitBreaker) success() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = 0
+}
+
+func (c *circuitBreaker) failure() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures++
+	if c.failures >= c.threshold {
+		c.openedUntil = time.Now().Add(c.cooldown)
+		c.failures = 0
+		slog.Warn("Avatar API circuit breaker opened", "cooldown", c.cooldown.String())
+	}
+}
+
+// FallbackAvatarProvider asks the primary provider first and falls back to the
+// secondary one when the primary fails, times out or its circuit is open.
+type FallbackAvatarProvider struct {
+	primary  domain.IdentityProvider
+	fallback domain.IdentityProvider
+	timeout  time.Duration
+	breaker  *circuitBreaker
+}
+
+func NewFallbackAvatarProvider(primary, fallback domain.IdentityProvider, timeout time.Duration) domain.IdentityProvider {
+	return &FallbackAvatarProvider{
+		primary:  primary,
+		fallback: fallback,
+		timeout:  timeout,
+		breaker: &circuitBreaker{
+			threshold: 3,
+			cooldown:  time.Minute,
+		},
+	}
+}
+
+func (f *FallbackAvatarProvider) GenerateIdentity(ctx context.Context) (string, string, error) {
+	name, avatarURL, err := f.tryPrimary(ctx)
+	if err == nil {
+		return name, avatarURL, nil
+	}
+
+	slog.Warn("Falling back to local avatar provider", "err", err)
+	return f.fallback.GenerateIdentity(ctx)
+}
+
+func (f *FallbackAvatarProvider) tryPrimary(ctx context.Context) (string, string, error) {
+	if !f.breaker.allow() {
+		return "", "", errCircuitOpen
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	type result struct {
+		name, avatarURL string
+		err             error
+	}
+	done := make(chan result, 1)
+	go func() {
+		name, avatarURL, err := f.primary.GenerateIdentity(ctx)
+		done <- result{name, avatarURL, err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			f.breaker.failure()
+			return "", "", res.err
+		}
+		f.breaker.success()
+		return res.name, res.avatarURL, nil
+	case <-ctx.Done():
+		f.breaker.failure()
+		return "", "", fmt.Errorf("avatar API timed out: %w", ctx.Err())
+	}
+}
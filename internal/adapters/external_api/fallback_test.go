@@ -0,0 +1,109 @@
+package external_api
+
+import (
+	"1337b04rd/internal/identicon"
+	"bytes"
+	"context"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+)
+
+type stubProvider struct {
+	calls int
+	delay time.Duration
+	err   error
+}
+
+func (s *stubProvider) GenerateIdentity(ctx context.Context) (string, string, error) {
+	s.calls++
+	if s.delay > 0 {
+		select {
+		case <-time.After(s.delay):
+		case <-ctx.Done():
+			return "", "", ctx.Err()
+		}
+	}
+	if s.err != nil {
+		return "", "", s.err
+	}
+	return "Rick", "rick.jpg", nil
+}
+
+func TestFallbackAvatarProvider(t *testing.T) {
+	t.Run("primary succeeds", func(t *testing.T) {
+		provider := NewFallbackAvatarProvider(&stubProvider{}, NewLocalCharacterProvider(), time.Second)
+		name, avatar, err := provider.GenerateIdentity(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if name != "Rick" || avatar != "rick.jpg" {
+			t.Errorf("expected primary character, got %s %s", name, avatar)
+		}
+	})
+
+	t.Run("primary error falls back", func(t *testing.T) {
+		provider := NewFallbackAvatarProvider(&stubProvider{err: errors.New("offline")}, NewLocalCharacterProvider(), time.Second)
+		name, avatar, err := provider.GenerateIdentity(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if name == "" {
+			t.Error("expected fallback name to be set")
+		}
+		if !strings.HasPrefix(avatar, identicon.AvatarPath) {
+			t.Errorf("expected local avatar URL, got %s", avatar)
+		}
+	})
+
+	t.Run("primary timeout falls back", func(t *testing.T) {
+		provider := NewFallbackAvatarProvider(&stubProvider{delay: time.Second}, NewLocalCharacterProvider(), 10*time.Millisecond)
+		_, avatar, err := provider.GenerateIdentity(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.HasPrefix(avatar, identicon.AvatarPath) {
+			t.Errorf("expected local avatar URL, got %s", avatar)
+		}
+	})
+
+	t.Run("circuit opens after repeated failures", func(t *testing.T) {
+		primary := &stubProvider{err: errors.New("offline")}
+		provider := NewFallbackAvatarProvider(primary, NewLocalCharacterProvider(), time.Second)
+		for i := 0; i < 5; i++ {
+			if _, _, err := provider.GenerateIdentity(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if primary.calls != 3 {
+			t.Errorf("expected primary to be skipped once the circuit opened, got %d calls", primary.calls)
+		}
+	})
+}
+
+func TestLocalAvatarIsValidPNG(t *testing.T) {
+	_, avatar, err := NewLocalCharacterProvider().GenerateIdentity(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	seed := strings.TrimSuffix(strings.TrimPrefix(avatar, identicon.AvatarPath), ".png")
+
+	first, err := identicon.Generate(seed, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, _ := identicon.Generate(seed, 100)
+	if !bytes.Equal(first, second) {
+		t.Error("expected identicon to be deterministic for the same seed")
+	}
+
+	img, err := png.Decode(bytes.NewReader(first))
+	if err != nil {
+		t.Fatalf("expected valid PNG: %v", err)
+	}
+	if img.Bounds().Dx() != 100 {
+		t.Errorf("expected 100px wide image, got %d", img.Bounds().Dx())
+	}
+}
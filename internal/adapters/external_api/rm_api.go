@@ -1,76 +1,261 @@
 package external_api
 
 import (
-	"1337b04rd/internal/domain"
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"math/rand"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	defaultPoolSize   = 20
+	prefetchRetryWait = 5 * time.Second
+)
+
+type character struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
+// RickAndMortyClient hands out characters from a buffered pool that a
+// background prefetcher keeps topped up through the batch endpoint, so
+// creating a session doesn't have to wait for the API.
 type RickAndMortyClient struct {
-	total                int
-	baseURL              string
-	fetchedCharactersIDs map[int]struct{}
-	mu                   sync.Mutex
+	baseURL  string
+	client   *http.Client
+	poolSize int
+	pool     chan character
+	refill   chan struct{}
+
+	refills   atomic.Int64 // batches added to the pool
+	fallbacks atomic.Int64 // identities fetched directly from a dry pool
+
+	mu    sync.Mutex
+	total int
+	ids   []int // shuffled character ids not handed out yet in this round
+}
+
+// PoolStats is a snapshot of the prefetch pool, published through expvar.
+type PoolStats struct {
+	Depth     int   `json:"depth"`
+	Size      int   `json:"size"`
+	Refills   int64 `json:"refills"`
+	Fallbacks int64 `json:"fallbacks"`
 }
 
-func NewRickAndMortyClient() domain.RickAndMortyAPI {
+func NewRickAndMortyClient(poolSize int) *RickAndMortyClient {
+	if poolSize <= 0 {
+		poolSize = defaultPoolSize
+	}
 	return &RickAndMortyClient{
-		fetchedCharactersIDs: make(map[int]struct{}),
-		baseURL:             "https://rickandmortyapi.com/api/",
+		baseURL:  "https://rickandmortyapi.com/api/",
+		client:   &http.Client{Timeout: 10 * time.Second},
+		poolSize: poolSize,
+		pool:     make(chan character, poolSize),
+		refill:   make(chan struct{}, 1),
 	}
 }
 
-func (r *RickAndMortyClient) GetRandomCharacter(ctx context.Context) (string, string, error) {
-	if r.total == 0 {
-		var meta struct {
-			Info struct {
-				Count int `json:"count"`
-			} `json:"info"`
+// Start runs the prefetcher until ctx is cancelled.
+func (r *RickAndMortyClient) Start(ctx context.Context) {
+	go func() {
+		slog.Info("Character prefetcher started", "poolSize", r.poolSize)
+		for {
+			wait := time.Minute
+			if err := r.fillPool(ctx); err != nil {
+				slog.Warn("Failed to prefetch characters", "err", err, "poolDepth", r.PoolDepth())
+				wait = prefetchRetryWait
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.refill:
+			case <-time.After(wait):
+			}
 		}
+	}()
+}
+
+// PoolDepth reports how many prefetched characters are ready to hand out.
+func (r *RickAndMortyClient) PoolDepth() int {
+	return len(r.pool)
+}
 
-		if err := fetchJSON(r.baseURL+"character", &meta); err != nil {
-			return "", "", fmt.Errorf("failed to fetch meta data: %w", err)
+// Stats reports the pool depth along with how often it was refilled and
+// how often it ran dry, so a pool that is too small shows up.
+func (r *RickAndMortyClient) Stats() PoolStats {
+	return PoolStats{
+		Depth:     r.PoolDepth(),
+		Size:      r.poolSize,
+		Refills:   r.refills.Load(),
+		Fallbacks: r.fallbacks.Load(),
+	}
+}
+
+func (r *RickAndMortyClient) GenerateIdentity(ctx context.Context) (string, string, error) {
+	select {
+	case ch := <-r.pool:
+		// Topping up a nearly full pool would cost an upstream call per
+		// session, so the prefetcher waits for the low-water mark.
+		if len(r.pool) < r.poolSize/2 {
+			r.requestRefill()
 		}
-		r.total = meta.Info.Count
+		return ch.Name, ch.Image, nil
+	default:
 	}
 
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	if len(r.fetchedCharactersIDs) == r.total {
-		r.fetchedCharactersIDs = make(map[int]struct{})
+	// The pool ran dry, fetch one directly and let the prefetcher catch up.
+	r.fallbacks.Add(1)
+	r.requestRefill()
+	chars, err := r.fetchBatch(ctx, 1)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch character: %w", err)
+	}
+	return chars[0].Name, chars[0].Image, nil
+}
+
+func (r *RickAndMortyClient) requestRefill() {
+	select {
+	case r.refill <- struct{}{}:
+	default:
 	}
+}
 
-	var ch struct {
-		Name  string `json:"name"`
-		Image string `json:"image"`
+func (r *RickAndMortyClient) fillPool(ctx context.Context) error {
+	missing := cap(r.pool) - len(r.pool)
+	if missing == 0 {
+		return nil
 	}
 
-	for {
-		id := rand.Intn(r.total) + 1
+	chars, err := r.fetchBatch(ctx, missing)
+	if err != nil {
+		return err
+	}
 
-		_, exists := r.fetchedCharactersIDs[id]
-		if exists {
-			continue
+	for _, ch := range chars {
+		select {
+		case r.pool <- ch:
+		default:
 		}
+	}
+	r.refills.Add(1)
+	slog.Debug("Character pool refilled", "poolDepth", r.PoolDepth())
+	return nil
+}
+
+func (r *RickAndMortyClient) fetchBatch(ctx context.Context, n int) ([]character, error) {
+	ids, err := r.nextIDs(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
 
-		r.fetchedCharactersIDs[id] = struct{}{}
+	// The batch endpoint answers with a bare object instead of an array when
+	// asked for a single id.
+	var raw json.RawMessage
+	if err := r.fetchJSON(ctx, r.baseURL+"character/"+strings.Join(parts, ","), &raw); err != nil {
+		return nil, err
+	}
 
-		if err := fetchJSON(fmt.Sprintf("%scharacter/%d", r.baseURL, id), &ch); err != nil {
-			return "", "", fmt.Errorf("failed to fetch character: %w", err)
+	var chars []character
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+		err = json.Unmarshal(raw, &chars)
+	} else {
+		var ch character
+		err = json.Unmarshal(raw, &ch)
+		chars = []character{ch}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(chars) == 0 {
+		return nil, fmt.Errorf("empty character batch")
+	}
+	return chars, nil
+}
+
+// nextIDs draws n ids without repeats, reshuffling once every character has
+// been handed out.
+func (r *RickAndMortyClient) nextIDs(ctx context.Context, n int) ([]int, error) {
+	total, err := r.characterCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if n > total {
+		n = total
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]int, 0, n)
+	for len(ids) < n {
+		if len(r.ids) == 0 {
+			r.ids = rand.Perm(total)
+			for i := range r.ids {
+				r.ids[i]++
+			}
 		}
+		ids = append(ids, r.ids[len(r.ids)-1])
+		r.ids = r.ids[:len(r.ids)-1]
+	}
+	return ids, nil
+}
 
-		return ch.Name, ch.Image, nil
+func (r *RickAndMortyClient) characterCount(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	total := r.total
+	r.mu.Unlock()
+	if total > 0 {
+		return total, nil
+	}
+
+	var meta struct {
+		Info struct {
+			Count int `json:"count"`
+		} `json:"info"`
+	}
+	if err := r.fetchJSON(ctx, r.baseURL+"character", &meta); err != nil {
+		return 0, fmt.Errorf("failed to fetch meta data: %w", err)
+	}
+	if meta.Info.Count <= 0 {
+		return 0, fmt.Errorf("API reported no characters")
+	}
+
+	r.mu.Lock()
+	r.total = meta.Info.Count
+	r.mu.Unlock()
+	return meta.Info.Count, nil
+}
+
+func (r *RickAndMortyClient) fetchJSON(ctx context.Context, url string, v interface{}) error {
+	client := r.client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
 	}
+	return fetchJSON(ctx, client, url, v)
 }
 
-func fetchJSON(url string, v interface{}) error {
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get(url)
+func fetchJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -81,4 +266,4 @@ func fetchJSON(url string, v interface{}) error {
 	}
 
 	return json.NewDecoder(resp.Body).Decode(v)
-}
\ No newline at end of file
+}
@@ -8,7 +8,7 @@ import (
 	"testing"
 )
 
-func TestGetRandomCharacter(t *testing.T) {
+func TestGenerateIdentity(t *testing.T) {
 	// Setup test server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
@@ -26,6 +26,11 @@ func TestGetRandomCharacter(t *testing.T) {
 				"name":  "Morty",
 				"image": "morty.jpg",
 			})
+		case "/api/character/1,2", "/api/character/2,1":
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"id": 1, "name": "Rick", "image": "rick.jpg"},
+				{"id": 2, "name": "Morty", "image": "morty.jpg"},
+			})
 		default:
 			w.WriteHeader(http.StatusNotFound)
 		}
@@ -34,11 +39,10 @@ func TestGetRandomCharacter(t *testing.T) {
 
 	t.Run("successful character fetch", func(t *testing.T) {
 		client := &RickAndMortyClient{
-			baseURL:              server.URL + "/api/",
-			fetchedCharactersIDs: make(map[int]struct{}),
+			baseURL: server.URL + "/api/",
 		}
 
-		name, image, err := client.GetRandomCharacter(context.Background())
+		name, image, err := client.GenerateIdentity(context.Background())
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -52,24 +56,23 @@ func TestGetRandomCharacter(t *testing.T) {
 
 	t.Run("fetch all characters", func(t *testing.T) {
 		client := &RickAndMortyClient{
-			baseURL:              server.URL + "/api/",
-			fetchedCharactersIDs: make(map[int]struct{}),
+			baseURL: server.URL + "/api/",
 		}
 
 		// Fetch first character
-		_, _, err := client.GetRandomCharacter(context.Background())
+		_, _, err := client.GenerateIdentity(context.Background())
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
 
 		// Fetch second character
-		_, _, err = client.GetRandomCharacter(context.Background())
+		_, _, err = client.GenerateIdentity(context.Background())
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
 
 		// Should reset and fetch first character again
-		name, _, err := client.GetRandomCharacter(context.Background())
+		name, _, err := client.GenerateIdentity(context.Background())
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -79,10 +82,72 @@ func TestGetRandomCharacter(t *testing.T) {
 	})
 }
 
+func TestCharacterPoolPrefetch(t *testing.T) {
+	var batchRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/character":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"info": map[string]interface{}{"count": 2},
+			})
+		case "/api/character/1,2", "/api/character/2,1":
+			batchRequests++
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"id": 1, "name": "Rick", "image": "rick.jpg"},
+				{"id": 2, "name": "Morty", "image": "morty.jpg"},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewRickAndMortyClient(2)
+	client.baseURL = server.URL + "/api/"
+
+	if err := client.fillPool(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.PoolDepth() != 2 {
+		t.Fatalf("expected pool depth 2, got %d", client.PoolDepth())
+	}
+	if batchRequests != 1 {
+		t.Errorf("expected a single batch request, got %d", batchRequests)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		name, _, err := client.GenerateIdentity(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		seen[name] = true
+	}
+	if !seen["Rick"] || !seen["Morty"] {
+		t.Errorf("expected both characters from the pool, got %v", seen)
+	}
+	if client.PoolDepth() != 0 {
+		t.Errorf("expected drained pool, got depth %d", client.PoolDepth())
+	}
+	if stats := client.Stats(); stats.Refills != 1 || stats.Fallbacks != 0 || stats.Size != 2 {
+		t.Errorf("unexpected pool stats %+v", stats)
+	}
+}
+
+func TestGenerateIdentityRespectsContext(t *testing.T) {
+	client := &RickAndMortyClient{baseURL: "http://127.0.0.1:1/api/"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := client.GenerateIdentity(ctx); err == nil {
+		t.Error("expected error for cancelled context")
+	}
+}
+
 func TestFetchJSONError(t *testing.T) {
 	t.Run("invalid URL", func(t *testing.T) {
 		var result interface{}
-		err := fetchJSON("invalid-url", &result)
+		err := fetchJSON(context.Background(), http.DefaultClient, "invalid-url", &result)
 		if err == nil {
 			t.Error("expected error for invalid URL")
 		}
@@ -95,9 +160,31 @@ func TestFetchJSONError(t *testing.T) {
 		defer server.Close()
 
 		var result interface{}
-		err := fetchJSON(server.URL, &result)
+		err := fetchJSON(context.Background(), http.DefaultClient, server.URL, &result)
 		if err == nil {
 			t.Error("expected error for server error")
 		}
 	})
-}
\ No newline at end of file
+}
+func TestGenerateIdentityRefillsAtLowWater(t *testing.T) {
+	client := NewRickAndMortyClient(4)
+	for i := 0; i < 4; i++ {
+		client.pool <- character{ID: i + 1, Name: "Rick", Image: "rick.jpg"}
+	}
+
+	if _, _, err := client.GenerateIdentity(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.refill) != 0 {
+		t.Error("expected no refill while the pool is above half full")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := client.GenerateIdentity(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(client.refill) != 1 {
+		t.Error("expected a refill once the pool dropped below half full")
+	}
+}
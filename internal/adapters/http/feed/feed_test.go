@@ -0,0 +1,99 @@
+package feed
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFeed() Feed {
+	published := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	return Feed{
+		Title:    "1337b04rd - Catalog",
+		Link:     "http://board.local/catalog",
+		SelfLink: "http://board.local/catalog/feed/atom",
+		Updated:  published.Add(time.Hour),
+		Entries: []Entry{{
+			ID:        "http://board.local/post/1",
+			Title:     "First <thread>",
+			Link:      "http://board.local/post/1",
+			Author:    "Rick Sanchez",
+			Content:   "wubba & lubba",
+			Published: published,
+			Updated:   published.Add(time.Hour),
+		}},
+	}
+}
+
+func TestAtom(t *testing.T) {
+	body, err := Atom(testFeed())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var doc atomFeed
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("invalid XML: %v", err)
+	}
+	if doc.Updated != "2026-10-01T13:00:00Z" {
+		t.Errorf("unexpected feed updated: %s", doc.Updated)
+	}
+	if len(doc.Entries) != 1 || doc.Entries[0].Title != "First <thread>" {
+		t.Fatalf("unexpected entries: %+v", doc.Entries)
+	}
+	if doc.Entries[0].Author.Name != "Rick Sanchez" {
+		t.Errorf("unexpected author: %s", doc.Entries[0].Author.Name)
+	}
+	if !strings.Contains(string(body), `xmlns="http://www.w3.org/2005/Atom"`) {
+		t.Error("expected Atom namespace")
+	}
+}
+
+func TestRSS(t *testing.T) {
+	body, err := RSS(testFeed())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var doc rssFeed
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("invalid XML: %v", err)
+	}
+	if doc.Version != "2.0" {
+		t.Errorf("expected RSS 2.0, got %s", doc.Version)
+	}
+	if len(doc.Channel.Items) != 1 || doc.Channel.Items[0].Description != "wubba & lubba" {
+		t.Fatalf("unexpected items: %+v", doc.Channel.Items)
+	}
+	if doc.Channel.Items[0].PubDate != "Thu, 01 Oct 2026 12:00:00 +0000" {
+		t.Errorf("unexpected pubDate: %s", doc.Channel.Items[0].PubDate)
+	}
+}
+
+func TestETag(t *testing.T) {
+	a := ETag([]byte("feed a"))
+	b := ETag([]byte("feed b"))
+	if a == b {
+		t.Error("expected different bodies to get different ETags")
+	}
+	if a != ETag([]byte("feed a")) {
+		t.Error("expected ETag to be stable")
+	}
+
+	tests := []struct {
+		header string
+		match  bool
+	}{
+		{a, true},
+		{"W/" + a, true},
+		{`"other", ` + a, true},
+		{"*", true},
+		{b, false},
+	}
+	for _, tt := range tests {
+		if got := Matches(tt.header, a); got != tt.match {
+			t.Errorf("Matches(%q) = %v, want %v", tt.header, got, tt.match)
+		}
+	}
+}
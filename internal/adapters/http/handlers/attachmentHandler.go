@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"1337b04rd/internal/domain"
+	"1337b04rd/internal/media"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const attachmentsBucket = "posts"
+
+var (
+	errTooManyAttachments = errors.New("too many attachments")
+	errInvalidUpload      = errors.New("invalid upload")
+)
+
+// probeWindow is how much of a direct upload is read to identify it.
+const probeWindow = 1 << 20
+
+// directUploadKey matches the keys PresignUpload hands out, u<user id>/<time><ext>.
+var directUploadKey = regexp.MustCompile(`^u(\d+)/\d+\.[a-z0-9]+$`)
+
+// UploadLimits bounds the files CreatePost and CreateComment accept.
+type UploadLimits struct {
+	MaxFiles int
+	media.Limits
+}
+
+func (l UploadLimits) MaxImageMB() int64 { return l.MaxImageSize >> 20 }
+func (l UploadLimits) MaxVideoMB() int64 { return l.MaxVideoSize >> 20 }
+
+// uploadAttachments stores the files sent in the "images" form field and
+// returns their metadata in upload order, followed by the files the browser
+// already uploaded itself, see confirmUploads. A single "spoiler" checkbox
+// marks all of them. Files are identified by content, not by the
+// Content-Type the browser claims. isAttachmentClientError tells which
+// errors are the client's fault. On error nothing it stored is left behind;
+// when saving the attachments fails later, the caller has discardUploads
+// remove them.
+func (h *Handler) uploadAttachments(ctx context.Context, form *multipart.Form, userID int, spoiler bool) ([]*domain.Attachment, error) {
+	if form == nil {
+		return nil, nil
+	}
+
+	var files []*multipart.FileHeader
+	for _, fh := range form.File["images"] {
+		// Browsers send an empty part when no file was chosen.
+		if fh.Filename != "" && fh.Size > 0 {
+			files = append(files, fh)
+		}
+	}
+	uploaded := form.Value["uploaded"]
+	if len(files)+len(uploaded) > h.uploads.MaxFiles {
+		return nil, fmt.Errorf("%w: at most %d files are allowed", errTooManyAttachments, h.uploads.MaxFiles)
+	}
+
+	maxSize := max(h.uploads.MaxImageSize, h.uploads.MaxVideoSize)
+	for _, fh := range files {
+		if fh.Size > maxSize {
+			return nil, fmt.Errorf("%w: %s", media.ErrTooLarge, fh.Filename)
+		}
+	}
+
+	attachments := make([]*domain.Attachment, 0, len(files))
+	for i, fh := range files {
+		attachment, err := h.uploadFormFile(ctx, fh, spoiler, i)
+		if err != nil {
+			h.discardUploads(ctx, attachments)
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	direct, err := h.confirmUploads(ctx, uploaded, userID, spoiler, len(attachments))
+	if err != nil {
+		h.discardUploads(ctx, attachments)
+		return nil, err
+	}
+	return append(attachments, direct...), nil
+}
+
+// uploadFormFile streams one file sent with the form to storage, identified
+// by its first probeWindow bytes like a direct upload, see probeHead.
+func (h *Handler) uploadFormFile(ctx context.Context, fh *multipart.FileHeader, spoiler bool, position int) (*domain.Attachment, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fh.Filename, err)
+	}
+	defer file.Close()
+
+	head := make([]byte, min(fh.Size, probeWindow))
+	if _, err := io.ReadFull(file, head); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fh.Filename, err)
+	}
+	info, err := probeHead(head, fh.Size)
+	if err == nil {
+		err = h.uploads.Check(info, fh.Size)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fh.Filename, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fh.Filename, err)
+	}
+
+	key := fmt.Sprintf("%d-%d%s", time.Now().UnixNano(), position, info.Extension())
+	url, err := h.s3Service.UploadFile(ctx, file, fh.Size, attachmentsBucket, key, info.ContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment := &domain.Attachment{
+		ObjectKey:   attachmentsBucket + "/" + key,
+		URL:         url,
+		ContentType: info.ContentType,
+		Size:        fh.Size,
+		Width:       info.Width,
+		Height:      info.Height,
+		Duration:    info.Duration,
+		Filename:    filepath.Base(fh.Filename),
+		Spoiler:     spoiler,
+		Position:    position,
+	}
+
+	thumbnail, err := media.Thumbnail(head, info)
+	if err != nil {
+		slog.Warn("No thumbnail for upload", "key", key, "err", err)
+	}
+	if thumbnail != nil {
+		attachment.ThumbnailURL, err = h.s3Service.UploadImage(ctx, thumbnail, attachmentsBucket, key+".thumb.png")
+		if err != nil {
+			h.discardUploads(ctx, []*domain.Attachment{attachment})
+			return nil, err
+		}
+	}
+	return attachment, nil
+}
+
+// confirmUploads attaches the files the browser uploaded through presigned
+// URLs, named by their keys. Only keys PresignUpload issued to this user and
+// not attached anywhere yet are accepted. Each file is confirmed with a HEAD
+// request and identified by its first bytes, see probeUpload. Files that
+// fail the checks are deleted again.
+func (h *Handler) confirmUploads(ctx context.Context, keys []string, userID int, spoiler bool, position int) (_ []*domain.Attachment, err error) {
+	attachments := make([]*domain.Attachment, 0, len(keys))
+	// Thumbnails made for the keys confirmed so far go if a later key fails.
+	defer func() {
+		if err != nil {
+			h.discardUploads(ctx, attachments)
+		}
+	}()
+
+	seen := make(map[string]bool)
+	for i, key := range keys {
+		match := directUploadKey.FindStringSubmatch(key)
+		if match == nil || match[1] != strconv.Itoa(userID) || seen[key] {
+			return nil, fmt.Errorf("%w: %s", errInvalidUpload, key)
+		}
+		seen[key] = true
+
+		inUse, err := h.postService.AttachmentInUse(ctx, attachmentsBucket+"/"+key)
+		if err != nil {
+			return nil, err
+		}
+		if inUse {
+			return nil, fmt.Errorf("%w: %s is already attached", errInvalidUpload, key)
+		}
+
+		object, err := h.s3Service.StatObject(ctx, attachmentsBucket, key)
+		if errors.Is(err, domain.ErrObjectNotFound) {
+			return nil, fmt.Errorf("%w: %s was not uploaded", errInvalidUpload, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		filename := path.Base(key)
+		if name, err := url.PathUnescape(object.Metadata["filename"]); err == nil && name != "" {
+			filename = filepath.Base(name)
+		}
+
+		info, head, err := h.probeUpload(ctx, key, object)
+		if err == nil {
+			err = h.uploads.Check(info, object.Size)
+		}
+		if err != nil {
+			if deleteErr := h.s3Service.DeleteImage(ctx, object.URL); deleteErr != nil {
+				slog.Error("Failed to delete rejected upload", "key", key, "err", deleteErr)
+			}
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+
+		attachment := &domain.Attachment{
+			ObjectKey:   attachmentsBucket + "/" + key,
+			URL:         object.URL,
+			ContentType: info.ContentType,
+			Size:        object.Size,
+			Width:       info.Width,
+			Height:      info.Height,
+			Duration:    info.Duration,
+			Filename:    filename,
+			Spoiler:     spoiler,
+			Position:    position + i,
+		}
+
+		// Video placeholders need only the probe, a GIF's first frame is
+		// usually in the head. Without one the file still shows as is.
+		thumbnail, err := media.Thumbnail(head, info)
+		if err != nil {
+			slog.Warn("No thumbnail for direct upload", "key", key, "err", err)
+		}
+		if thumbnail != nil {
+			attachment.ThumbnailURL, err = h.s3Service.UploadImage(ctx, thumbnail, attachmentsBucket, key+".thumb.png")
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+// probeUpload identifies a direct upload by its first probeWindow bytes,
+// see probeHead. It must be what it was uploaded as, storage serves it with
+// that Content-Type.
+func (h *Handler) probeUpload(ctx context.Context, key string, object *domain.StoredObject) (*media.Info, []byte, error) {
+	head, err := h.s3Service.ReadObjectHead(ctx, attachmentsBucket, key, probeWindow)
+	if err != nil {
+		return nil, nil, err
+	}
+	contentType, err := media.Sniff(head)
+	if err != nil {
+		return nil, nil, err
+	}
+	if contentType != object.ContentType {
+		return nil, nil, fmt.Errorf("%w: uploaded as %s but is %s", media.ErrUnsupported, object.ContentType, contentType)
+	}
+
+	info, err := probeHead(head, object.Size)
+	if err != nil {
+		return nil, nil, err
+	}
+	return info, head, nil
+}
+
+// probeHead identifies a file of size bytes by its head. Dimensions and
+// duration are known when they are in the head, as they are for images and
+// streaming-friendly videos; otherwise the limits are checked by type and
+// size only.
+func probeHead(head []byte, size int64) (*media.Info, error) {
+	info, err := media.Probe(head)
+	if err != nil && int64(len(head)) < size {
+		contentType, sniffErr := media.Sniff(head)
+		if sniffErr != nil {
+			return nil, sniffErr
+		}
+		return media.Declared(contentType)
+	}
+	return info, err
+}
+
+type presignRequest struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+type presignResponse struct {
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+// PresignUpload hands the browser a URL to upload one attachment straight to
+// storage, checked against the upload limits by the type and size it
+// announces. The URL takes exactly that size, once, so the file can't grow
+// past the limits or be swapped later. The returned key goes into the post
+// or comment form as "uploaded". Without a presign secret it answers 404 and the page falls
+// back to sending the files with the form.
+func (h *Handler) PresignUpload(w http.ResponseWriter, r *http.Request) {
+	user, ok := GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Session required", http.StatusUnauthorized)
+		return
+	}
+
+	var req presignRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil || req.Size <= 0 {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	info, err := media.Declared(req.ContentType)
+	if err == nil {
+		err = h.uploads.Check(info, req.Size)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %v", req.Filename, err), http.StatusBadRequest)
+		return
+	}
+
+	key := fmt.Sprintf("u%d/%d%s", user.ID, time.Now().UnixNano(), info.Extension())
+	uploadURL, err := h.s3Service.PresignUpload(r.Context(), attachmentsBucket, key, info.ContentType, req.Size)
+	if errors.Is(err, domain.ErrPresignDisabled) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to presign upload", "err", err)
+		http.Error(w, "Failed to prepare upload", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(presignResponse{Key: key, URL: uploadURL})
+}
+
+// discardUploads deletes what uploadAttachments stored for attachments that
+// were never saved: the files sent with the form and every thumbnail. Files
+// the browser uploaded itself stay, the form can be sent again with them.
+func (h *Handler) discardUploads(ctx context.Context, attachments []*domain.Attachment) {
+	for _, attachment := range attachments {
+		urls := []string{attachment.ThumbnailURL}
+		if !directUploadKey.MatchString(strings.TrimPrefix(attachment.ObjectKey, attachmentsBucket+"/")) {
+			urls = append(urls, attachment.URL)
+		}
+		for _, url := range urls {
+			if url == "" {
+				continue
+			}
+			if err := h.s3Service.DeleteImage(ctx, url); err != nil {
+				slog.Error("Failed to delete unsaved upload", "url", url, "err", err)
+			}
+		}
+	}
+}
+
+// msgUploadAttached answers a save that lost the race for an upload to
+// another post or comment after confirmUploads found it free.
+const msgUploadAttached = "invalid upload: the file is already attached"
+
+// isAttachmentConflict reports a save refused by the unique object_key.
+func isAttachmentConflict(err error) bool {
+	return errors.Is(err, domain.ErrAttachmentInUse)
+}
+
+func isAttachmentClientError(err error) bool {
+	return errors.Is(err, errTooManyAttachments) ||
+		errors.Is(err, errInvalidUpload) ||
+		errors.Is(err, media.ErrUnsupported) ||
+		errors.Is(err, media.ErrTooLarge) ||
+		errors.Is(err, media.ErrTooLong)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"1337b04rd/internal/identicon"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	avatarSize = 300
+	// Seeds are 16 hex digits, anything much longer isn't one of ours.
+	maxAvatarSeed = 64
+	// avatarCacheSize is how many rendered PNGs are kept, about 2 KB each.
+	avatarCacheSize = 256
+)
+
+// ServeAvatar renders the identicon used by the local avatar fallback. An
+// identicon only depends on its seed, so the ETag is derived from the seed.
+// Query parameters such as the src of a mirror fallback don't change the
+// image.
+func (h *Handler) ServeAvatar(w http.ResponseWriter, r *http.Request) {
+	seed := strings.TrimSuffix(r.PathValue("seed"), ".png")
+	if seed == "" {
+		h.HandleHTTPError(w, r, "Avatar seed is required", http.StatusBadRequest)
+		return
+	}
+	if len(seed) > maxAvatarSeed {
+		h.HandleHTTPError(w, r, "Avatar seed is too long", http.StatusBadRequest)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(seed))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("Content-Type", "image/png")
+
+	data, ok := h.avatars.get(seed)
+	if !ok {
+		var err error
+		data, err = identicon.Generate(seed, avatarSize)
+		if err != nil {
+			slog.Error("Failed to generate avatar", "err", err)
+			h.HandleHTTPError(w, r, "Failed to generate avatar", http.StatusInternalServerError)
+			return
+		}
+		h.avatars.add(seed, data)
+	}
+
+	// ServeContent answers If-None-Match with 304 and sets Content-Length.
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// avatarCache keeps the most recently served identicons.
+type avatarCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is the most recently used
+	entries map[string]*list.Element
+}
+
+type avatarEntry struct {
+	seed string
+	data []byte
+}
+
+func newAvatarCache(size int) *avatarCache {
+	return &avatarCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *avatarCache) get(seed string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[seed]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*avatarEntry).data, true
+}
+
+func (c *avatarCache) add(seed string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[seed]; ok {
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[seed] = c.order.PushFront(&avatarEntry{seed: seed, data: data})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*avatarEntry).seed)
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"1337b04rd/internal/adapters/http/websocket"
+	"1337b04rd/internal/domain"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	maxLiveConnections = 512
+	wsWriteTimeout     = 5 * time.Second
+	wsPingInterval     = 30 * time.Second
+	wsPongWait         = 2 * wsPingInterval
+)
+
+type catalogEvent struct {
+	Type       domain.EventType `json:"type"`
+	PostID     int              `json:"post_id"`
+	Title      string           `json:"title,omitempty"`
+	ArchivedAt string           `json:"archived_at,omitempty"`
+}
+
+// CatalogFeed streams new-thread, bump and archive events to catalog.html
+// over a WebSocket. Clients that can't keep up are disconnected.
+func (h *Handler) CatalogFeed(w http.ResponseWriter, r *http.Request) {
+	if h.liveConns.Add(1) > maxLiveConnections {
+		h.liveConns.Add(-1)
+		h.HandleHTTPError(w, r, "Too many live connections", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.liveConns.Add(-1)
+
+	conn, err := websocket.Upgrade(w, r)
+	if errors.Is(err, websocket.ErrHandshake) {
+		slog.Debug("Refused catalog feed handshake", "err", err)
+		h.HandleHTTPError(w, r, "WebSocket handshake required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		// The connection was taken over, nothing can be written to it.
+		slog.Error("Failed to upgrade catalog feed", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	events, unsubscribe := h.events.Subscribe(domain.AllPosts)
+	defer unsubscribe()
+
+	// The reader only exists to answer pings, notice pongs and detect the
+	// client going away.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		for {
+			opcode, _, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if opcode == websocket.OpPong {
+				conn.SetReadDeadline(time.Now().Add(wsPongWait))
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ping.C:
+			if err := conn.WritePing(wsWriteTimeout); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Type == domain.EventCommentAdded {
+				continue
+			}
+
+			payload, err := json.Marshal(h.catalogEventPayload(r, event))
+			if err != nil {
+				slog.Error("Failed to encode catalog event", "err", err)
+				continue
+			}
+			if err := conn.WriteText(payload, wsWriteTimeout); err != nil {
+				slog.Debug("Dropping slow catalog feed client", "err", err)
+				return
+			}
+		}
+	}
+}
+
+func (h *Handler) catalogEventPayload(r *http.Request, event domain.Event) catalogEvent {
+	payload := catalogEvent{Type: event.Type, PostID: event.PostID}
+	if !event.ArchivedAt.IsZero() {
+		payload.ArchivedAt = event.ArchivedAt.Format(time.RFC3339)
+	}
+
+	if event.Type == domain.EventPostCreated {
+		post, err := h.postService.GetPostByID(r.Context(), event.PostID)
+		if err == nil {
+			payload.Title = post.Title
+		}
+	}
+	return payload
+}
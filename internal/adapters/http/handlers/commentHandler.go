@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"1337b04rd/internal/domain"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -11,8 +13,8 @@ import (
 func (h *Handler) CreateComment(w http.ResponseWriter, r *http.Request) {
 	postID := path.Base(path.Dir(r.URL.Path))
 
-	// Parse form data
-	if err := r.ParseForm(); err != nil {
+	// Parse form data, the comment form is multipart once files are attached
+	if err := r.ParseMultipartForm(10 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
 		slog.Error("Failed to parse form", "error", err)
 		h.HandleHTTPError(w, r, "Failed to parse form", http.StatusBadRequest)
 		return
@@ -22,6 +24,7 @@ func (h *Handler) CreateComment(w http.ResponseWriter, r *http.Request) {
 	name := r.FormValue("name")
 	content := r.FormValue("content")
 	replyTo := r.FormValue("reply_to")
+	sage := r.FormValue("sage") != ""
 
 	// Validate required fields
 	if content == "" {
@@ -52,16 +55,52 @@ func (h *Handler) CreateComment(w http.ResponseWriter, r *http.Request) {
 		slog.Error("Invalid post ID", "error", err)
 	}
 
+	// A locked thread is refused before anything is uploaded for it,
+	// AddComment checks again in case it was locked meanwhile.
+	post, err := h.postService.GetPostByID(r.Context(), ipostID)
+	if err != nil {
+		h.HandleHTTPError(w, r, "Post not found", http.StatusNotFound)
+		return
+	}
+	if post.Locked {
+		h.HandleHTTPError(w, r, "This thread is locked by a moderator and no longer accepts replies", http.StatusForbidden)
+		return
+	}
+
+	attachments, err := h.uploadAttachments(r.Context(), r.MultipartForm, user.ID, r.FormValue("spoiler") != "")
+	if err != nil {
+		if isAttachmentClientError(err) {
+			h.HandleHTTPError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Error("Failed to upload attachments to S3", "error", err)
+		h.HandleHTTPError(w, r, "Failed to upload to S3", http.StatusInternalServerError)
+		return
+	}
+
 	// Save comment using repository
-	_, err = h.commentService.AddComment(r.Context(), user.ID, ipostID, parentID, content)
+	_, err = h.commentService.AddComment(r.Context(), user.ID, ipostID, parentID, content, attachments)
+	if err != nil {
+		h.discardUploads(r.Context(), attachments)
+	}
+	if errors.Is(err, domain.ErrThreadLocked) {
+		h.HandleHTTPError(w, r, "This thread is locked by a moderator and no longer accepts replies", http.StatusForbidden)
+		return
+	}
+	if isAttachmentConflict(err) {
+		h.HandleHTTPError(w, r, msgUploadAttached, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		slog.Error("Failed to save comment", "error", err)
 		h.HandleHTTPError(w, r, "Failed to save comment", http.StatusInternalServerError)
 		return
 	}
 
-	// Add 15 minutes to post lifetime
-	err = h.postService.AddTimeToPostLifetime(r.Context(), ipostID)
+	// Add 15 minutes to post lifetime, unless the poster chose not to bump
+	if !sage {
+		err = h.postService.AddTimeToPostLifetime(r.Context(), ipostID)
+	}
 
 	// Redirect back to the post page
 	http.Redirect(w, r, fmt.Sprintf("/post/%s", postID), http.StatusSeeOther)
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"1337b04rd/internal/domain"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const sseKeepAlive = 15 * time.Second
+
+type liveComment struct {
+	ID          int              `json:"id"`
+	ParentID    int              `json:"parent_id"`
+	Content     string           `json:"content"`
+	CreatedAt   string           `json:"created_at"`
+	UserName    string           `json:"user_name"`
+	AvatarURL   string           `json:"avatar_url"`
+	Attachments []liveAttachment `json:"attachments,omitempty"`
+}
+
+// liveAttachment carries what the gallery template of post.html shows.
+type liveAttachment struct {
+	Kind         string `json:"kind"` // "image" or "video"
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	ContentType  string `json:"content_type"`
+	Filename     string `json:"filename"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	Duration     string `json:"duration,omitempty"`
+	Spoiler      bool   `json:"spoiler"`
+}
+
+type liveEvent struct {
+	PostID     int          `json:"post_id"`
+	ArchivedAt string       `json:"archived_at,omitempty"`
+	Comment    *liveComment `json:"comment,omitempty"`
+}
+
+// ThreadEvents streams new comments, lifetime extensions and the archive
+// notice of a single thread as Server-Sent Events. Streams count towards
+// the same cap as the catalog feed.
+func (h *Handler) ThreadEvents(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || postID <= 0 {
+		h.HandleHTTPError(w, r, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.postService.GetPostByID(r.Context(), postID); err != nil {
+		h.HandleHTTPError(w, r, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	if h.liveConns.Add(1) > maxLiveConnections {
+		h.liveConns.Add(-1)
+		h.HandleHTTPError(w, r, "Too many live connections", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.liveConns.Add(-1)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.HandleHTTPError(w, r, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := h.events.Subscribe(postID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			payload, err := h.liveEventPayload(r, event)
+			if err != nil {
+				slog.Error("Failed to build live event", "type", event.Type, "postID", postID, "err", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, payload)
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *Handler) liveEventPayload(r *http.Request, event domain.Event) ([]byte, error) {
+	payload := liveEvent{PostID: event.PostID}
+	if !event.ArchivedAt.IsZero() {
+		payload.ArchivedAt = event.ArchivedAt.Format(time.RFC3339)
+	}
+
+	if event.Type == domain.EventCommentAdded {
+		comment, err := h.commentService.GetCommentByID(r.Context(), event.CommentID)
+		if err != nil {
+			return nil, err
+		}
+		user, err := h.userService.GetUserByID(r.Context(), comment.UserID)
+		if err != nil {
+			return nil, err
+		}
+		payload.Comment = &liveComment{
+			ID:        comment.ID,
+			ParentID:  comment.ParentID,
+			Content:   comment.Content,
+			CreatedAt: comment.CreatedAt.Format("2006-01-02 15:04:05"),
+			UserName:  user.Name,
+			AvatarURL: user.AvatarURL,
+		}
+		for _, a := range comment.Attachments {
+			attachment := liveAttachment{
+				Kind:         "image",
+				URL:          a.URL,
+				ThumbnailURL: a.ThumbnailURL,
+				ContentType:  a.ContentType,
+				Filename:     a.Filename,
+				Width:        a.Width,
+				Height:       a.Height,
+				Spoiler:      a.Spoiler,
+			}
+			if a.IsVideo() {
+				attachment.Kind = "video"
+			}
+			if a.Duration > 0 {
+				attachment.Duration = a.Duration.String()
+			}
+			payload.Comment.Attachments = append(payload.Comment.Attachments, attachment)
+		}
+	}
+
+	return json.Marshal(payload)
+}
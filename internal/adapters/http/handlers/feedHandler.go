@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"1337b04rd/internal/adapters/http/feed"
+	"1337b04rd/internal/domain"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	feedFormatAtom = "atom"
+	feedFormatRSS  = "rss"
+	feedMaxEntries = 50
+)
+
+func (h *Handler) CatalogFeedXML(w http.ResponseWriter, r *http.Request) {
+	h.serveBoardFeed(w, r, false)
+}
+
+func (h *Handler) ArchiveFeedXML(w http.ResponseWriter, r *http.Request) {
+	h.serveBoardFeed(w, r, true)
+}
+
+func (h *Handler) serveBoardFeed(w http.ResponseWriter, r *http.Request, archived bool) {
+	posts, err := h.postService.ListPosts(r.Context(), archived)
+	if err != nil {
+		slog.Error("Failed to fetch posts", "err", err)
+		h.HandleHTTPError(w, r, "Failed to fetch posts", http.StatusInternalServerError)
+		return
+	}
+
+	base := baseURL(r)
+	page, title, postPath := "/catalog", "1337b04rd - Catalog", "/post/"
+	if archived {
+		page, title, postPath = "/archive", "1337b04rd - Archive", "/archive-post/"
+	}
+
+	f := feed.Feed{
+		Title:       title,
+		Link:        base + page,
+		SelfLink:    base + r.URL.Path,
+		Description: "Anonymous Imageboard for Hackers",
+	}
+	for _, post := range posts {
+		updated := postUpdatedAt(post)
+		f.Entries = append(f.Entries, feed.Entry{
+			ID:        fmt.Sprintf("%s/post/%d", base, post.ID),
+			Title:     post.Title,
+			Link:      fmt.Sprintf("%s%s%d", base, postPath, post.ID),
+			Author:    authorName(post.Username),
+			Content:   post.Content,
+			Published: post.CreatedAt,
+			Updated:   updated,
+		})
+	}
+	sort.Slice(f.Entries, func(i, j int) bool {
+		return f.Entries[i].Updated.After(f.Entries[j].Updated)
+	})
+	if len(f.Entries) > feedMaxEntries {
+		f.Entries = f.Entries[:feedMaxEntries]
+	}
+	if len(f.Entries) > 0 {
+		f.Updated = f.Entries[0].Updated
+	}
+
+	h.writeFeed(w, r, f)
+}
+
+func (h *Handler) ThreadFeedXML(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	postID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.HandleHTTPError(w, r, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	post, err := h.postService.GetPostByID(ctx, postID)
+	if err != nil {
+		slog.Error("Failed to fetch post", "err", err)
+		h.HandleHTTPError(w, r, "Failed to fetch post", http.StatusNotFound)
+		return
+	}
+
+	comments, err := h.commentService.GetCommentsByPostID(ctx, postID)
+	if err != nil {
+		slog.Error("Failed to fetch comments", "err", err)
+		h.HandleHTTPError(w, r, "Failed to fetch comments", http.StatusInternalServerError)
+		return
+	}
+
+	base := baseURL(r)
+	link := fmt.Sprintf("%s/post/%d", base, post.ID)
+	if post.Archived {
+		link = fmt.Sprintf("%s/archive-post/%d", base, post.ID)
+	}
+
+	f := feed.Feed{
+		Title:       fmt.Sprintf("1337b04rd - %s", post.Title),
+		Link:        link,
+		SelfLink:    base + r.URL.Path,
+		Description: fmt.Sprintf("Replies to thread No.%d", post.ID),
+		Updated:     post.CreatedAt,
+		Entries: []feed.Entry{{
+			ID:        fmt.Sprintf("%s/post/%d", base, post.ID),
+			Title:     post.Title,
+			Link:      link,
+			Author:    authorName(post.Username),
+			Content:   post.Content,
+			Published: post.CreatedAt,
+			Updated:   post.CreatedAt,
+		}},
+	}
+
+	for _, comment := range comments {
+		// GetCommentsByPostID joins the author's name in.
+		author := ""
+		if comment.User != nil {
+			author = comment.User.Name
+		}
+		f.Entries = append(f.Entries, feed.Entry{
+			ID:        fmt.Sprintf("%s/post/%d#comment-%d", base, post.ID, comment.ID),
+			Title:     fmt.Sprintf("Reply No.%d", comment.ID),
+			Link:      fmt.Sprintf("%s#comment-%d", link, comment.ID),
+			Author:    authorName(author),
+			Content:   comment.Content,
+			Published: comment.CreatedAt,
+			Updated:   comment.CreatedAt,
+		})
+		if comment.CreatedAt.After(f.Updated) {
+			f.Updated = comment.CreatedAt
+		}
+	}
+
+	h.writeFeed(w, r, f)
+}
+
+func (h *Handler) writeFeed(w http.ResponseWriter, r *http.Request, f feed.Feed) {
+	// An empty feed has no activity to date it by. The epoch keeps the body,
+	// and with it the ETag, the same from one poll to the next.
+	if f.Updated.IsZero() {
+		f.Updated = time.Unix(0, 0)
+	}
+
+	format := r.PathValue("format")
+	var body []byte
+	var err error
+	switch format {
+	case feedFormatAtom:
+		body, err = feed.Atom(f)
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	case feedFormatRSS:
+		body, err = feed.RSS(f)
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	default:
+		h.HandleHTTPError(w, r, "Unknown feed format", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to render feed", "format", format, "err", err)
+		h.HandleHTTPError(w, r, "Failed to render feed", http.StatusInternalServerError)
+		return
+	}
+
+	etag := feed.ETag(body)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", f.Updated.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if match := r.Header.Get("If-None-Match"); match != "" && feed.Matches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Write(body)
+}
+
+func postUpdatedAt(post *domain.Post) time.Time {
+	updated := post.CreatedAt
+	for _, comment := range post.Comments {
+		if comment.CreatedAt.After(updated) {
+			updated = comment.CreatedAt
+		}
+	}
+	return updated
+}
+
+func authorName(name string) string {
+	if name == "" {
+		return "Anonymous"
+	}
+	return name
+}
+
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
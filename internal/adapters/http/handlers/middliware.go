@@ -4,6 +4,7 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"time"
 )
 
 type contextKey string
@@ -30,17 +31,22 @@ func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		if isNew {
-			http.SetCookie(w, &http.Cookie{
-				Name:     "session_token",
-				Value:    user.SessionToken,
-				Path:     "/",
-				HttpOnly: true,
-				Secure:   true, // Add this for HTTPS
-				SameSite: http.SameSiteStrictMode,
-				MaxAge:   7 * 24 * 60 * 60, // 7 days
-			})
+			slog.Debug("Issued new session", "userID", user.ID)
 		}
 
+		// Re-send the cookie on every request so its lifetime slides together
+		// with the session's expires_at.
+		http.SetCookie(w, &http.Cookie{
+			Name:     "session_token",
+			Value:    user.SessionToken,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   true, // Add this for HTTPS
+			SameSite: http.SameSiteStrictMode,
+			Expires:  user.ExpiresAt,
+			MaxAge:   int(time.Until(user.ExpiresAt).Seconds()),
+		})
+
 		// Add user to context for downstream handlers
 		ctx = context.WithValue(ctx, userContextKey, user)
 		r = r.WithContext(ctx)
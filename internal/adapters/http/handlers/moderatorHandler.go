@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"1337b04rd/internal/domain"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ModeratorMiddleware only lets through requests carrying the configured
+// moderator token as "Authorization: Bearer <token>".
+func (h *Handler) ModeratorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.moderatorToken == "" {
+			h.HandleHTTPError(w, r, "Moderation is disabled", http.StatusNotFound)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.moderatorToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="moderation"`)
+			h.HandleHTTPError(w, r, "Moderator token required", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SetPostFlag turns a thread flag on with POST and off with DELETE.
+func (h *Handler) SetPostFlag(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		h.HandleHTTPError(w, r, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	flag := domain.PostFlag(r.PathValue("flag"))
+	switch flag {
+	case domain.PostFlagSticky, domain.PostFlagLocked, domain.PostFlagPinned:
+	default:
+		h.HandleHTTPError(w, r, "Unknown flag, expected sticky, locked or pinned", http.StatusBadRequest)
+		return
+	}
+
+	err = h.postService.SetPostFlag(r.Context(), postID, flag, r.Method == http.MethodPost)
+	if errors.Is(err, domain.ErrPostNotFound) {
+		h.HandleHTTPError(w, r, "Post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to set post flag", "postID", postID, "flag", flag, "err", err)
+		h.HandleHTTPError(w, r, "Failed to update post", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
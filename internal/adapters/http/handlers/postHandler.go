@@ -1,14 +1,11 @@
 package handlers
 
 import (
-	"fmt"
 	"html/template"
-	"io"
 	"log/slog"
 	"net/http"
 	"path"
 	"strconv"
-	"time"
 )
 
 type PostFormData struct {
@@ -21,6 +18,7 @@ type PostFormData struct {
 type TemplateData struct {
 	FormData PostFormData
 	Error    map[string]string
+	Uploads  UploadLimits
 }
 
 func (h *Handler) ListPosts(w http.ResponseWriter, r *http.Request) {
@@ -219,6 +217,7 @@ func (h *Handler) CreatePostForm(w http.ResponseWriter, r *http.Request) {
 	data := TemplateData{
 		FormData: PostFormData{},
 		Error:    make(map[string]string),
+		Uploads:  h.uploads,
 	}
 
 	err = tmpl.Execute(w, data)
@@ -264,7 +263,8 @@ func (h *Handler) CreatePost(w http.ResponseWriter, r *http.Request) {
 				Title:   title,
 				Content: content,
 			},
-			Error: errors,
+			Error:   errors,
+			Uploads: h.uploads,
 		}
 
 		tmpl := template.Must(template.ParseFiles("create-post.html"))
@@ -278,31 +278,24 @@ func (h *Handler) CreatePost(w http.ResponseWriter, r *http.Request) {
 		user.Name = name // Update user in context after changing name
 	}
 
-	// Add triple-s implemenatation for file upload
-	var imageURL string
-	file, fh, err := r.FormFile("image")
-	if err == nil && fh != nil {
-		defer file.Close()
-
-		raw, err := io.ReadAll(file)
-		if err != nil {
-			slog.Error("Failed to read image", "err", err)
-			h.HandleHTTPError(w, r, "Failed to read image", http.StatusInternalServerError)
+	attachments, err := h.uploadAttachments(ctx, r.MultipartForm, user.ID, r.FormValue("spoiler") != "")
+	if err != nil {
+		if isAttachmentClientError(err) {
+			h.HandleHTTPError(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
+		slog.Error("Failed to upload attachments to S3", "err", err)
+		h.HandleHTTPError(w, r, "Failed to upload to S3", http.StatusInternalServerError)
+		return
+	}
 
-		key := fmt.Sprintf("%d-%s", time.Now().Unix(), fh.Filename)
-
-		url, err := h.s3Service.UploadImage(ctx, raw, "posts", key)
-		if err != nil {
-			slog.Error("Failed to upload image to S3", "err", err)
-			h.HandleHTTPError(w, r, "Failed to upload to S3", http.StatusInternalServerError)
+	_, err = h.postService.CreatePost(ctx, user.ID, user.Name, title, content, attachments)
+	if err != nil {
+		h.discardUploads(ctx, attachments)
+		if isAttachmentConflict(err) {
+			h.HandleHTTPError(w, r, msgUploadAttached, http.StatusBadRequest)
 			return
 		}
-		imageURL = url
-	}
-	_, err = h.postService.CreatePost(ctx, user.ID, user.Name, title, content, imageURL)
-	if err != nil {
 		slog.Error("Failed to create post", "err", err)
 		h.HandleHTTPError(w, r, "Failed to create post", http.StatusInternalServerError)
 		return
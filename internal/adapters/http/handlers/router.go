@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"1337b04rd/internal/domain"
+	"expvar"
 	"net/http"
+	"sync/atomic"
 )
 
 type Handler struct {
@@ -10,25 +12,44 @@ type Handler struct {
 	postService    domain.PostService
 	commentService domain.CommentService
 	s3Service      domain.S3Service
+	events         domain.EventBus
+	moderatorToken string
+	uploads        UploadLimits
+	liveConns      atomic.Int32
+	avatars        *avatarCache
 }
 
-func NewHandler(userService domain.UserService, postService domain.PostService, commentService domain.CommentService, s3Service domain.S3Service) *Handler {
+func NewHandler(userService domain.UserService, postService domain.PostService, commentService domain.CommentService, s3Service domain.S3Service, events domain.EventBus, moderatorToken string, uploads UploadLimits) *Handler {
 	return &Handler{
 		userService:    userService,
 		postService:    postService,
 		commentService: commentService,
 		s3Service:      s3Service,
+		events:         events,
+		moderatorToken: moderatorToken,
+		uploads:        uploads,
+		avatars:        newAvatarCache(avatarCacheSize),
 	}
 }
 
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.Handle("GET /catalog", h.AuthMiddleware(http.HandlerFunc(h.ListPosts)))
+	mux.HandleFunc("GET /catalog/live", h.CatalogFeed)
 	mux.Handle("GET /archive", h.AuthMiddleware(http.HandlerFunc(h.ListArchivedPosts)))
 	mux.Handle("GET /post/{id}", h.AuthMiddleware(http.HandlerFunc(h.GetPost)))
 	mux.Handle("GET /archive-post/{id}", h.AuthMiddleware(http.HandlerFunc(h.GetArchivePost)))
 	mux.Handle("GET /create-post", h.AuthMiddleware(http.HandlerFunc(h.CreatePostForm)))
 	mux.Handle("POST /create-post", h.AuthMiddleware(http.HandlerFunc(h.CreatePost)))
+	mux.Handle("POST /uploads/presign", h.AuthMiddleware(http.HandlerFunc(h.PresignUpload)))
 	mux.Handle("POST /post/{id}/comment", h.AuthMiddleware(http.HandlerFunc(h.CreateComment)))
+	mux.HandleFunc("GET /post/{id}/events", h.ThreadEvents)
+	mux.HandleFunc("GET /avatars/{seed}", h.ServeAvatar)
+	mux.HandleFunc("GET /catalog/feed/{format}", h.CatalogFeedXML)
+	mux.HandleFunc("GET /archive/feed/{format}", h.ArchiveFeedXML)
+	mux.HandleFunc("GET /post/{id}/feed/{format}", h.ThreadFeedXML)
+	mux.Handle("POST /mod/post/{id}/{flag}", h.ModeratorMiddleware(http.HandlerFunc(h.SetPostFlag)))
+	mux.Handle("DELETE /mod/post/{id}/{flag}", h.ModeratorMiddleware(http.HandlerFunc(h.SetPostFlag)))
+	mux.Handle("GET /mod/vars", h.ModeratorMiddleware(expvar.Handler()))
 	mux.Handle("GET /error", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		h.HandleHTTPError(w, r, "An expected error occurred.", http.StatusInternalServerError)
 	}))
@@ -4,7 +4,6 @@ import (
 	"1337b04rd/internal/domain"
 	"context"
 	"log/slog"
-	"mime/multipart"
 	"time"
 )
 
@@ -33,14 +32,38 @@ func (h *Handler) StartArchiveWorker() {
 	}()
 }
 
-func isValidImageType(fileHeader *multipart.FileHeader) bool {
-	allowedTypes := []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
-	contentType := fileHeader.Header.Get("Content-Type")
+func (h *Handler) StartSessionCleanupWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		slog.Info("Session cleanup worker started", "interval", interval.String())
+
+		for range ticker.C {
+			purged, err := h.userService.PurgeExpiredSessions(context.Background())
+			if err != nil {
+				slog.Error("Failed to purge expired sessions", "err", err)
+				continue
+			}
+			slog.Info("Expired sessions purged", "count", purged)
+		}
+	}()
+}
+
+func (h *Handler) StartPurgeWorker(interval, retention time.Duration, batchSize int, dryRun bool) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		slog.Info("Purge worker started", "interval", interval.String(), "retention", retention.String(), "dryRun", dryRun)
 
-	for _, allowedType := range allowedTypes {
-		if contentType == allowedType {
-			return true
+		for range ticker.C {
+			purged, err := h.postService.PurgeArchived(context.Background(), retention, batchSize, dryRun)
+			if err != nil {
+				slog.Error("Failed to purge archived posts", "purged", purged, "err", err)
+				continue
+			}
+			slog.Info("Archived posts purged", "count", purged, "dryRun", dryRun)
 		}
-	}
-	return false
+	}()
 }
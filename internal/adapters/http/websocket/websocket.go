@@ -0,0 +1,227 @@
+// Package websocket implements the small subset of RFC 6455 the board needs
+// to push server events: the opening handshake over a hijacked connection,
+// unfragmented text frames and ping/pong/close control frames.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OpText   byte = 0x1
+	OpBinary byte = 0x2
+	OpClose  byte = 0x8
+	OpPing   byte = 0x9
+	OpPong   byte = 0xA
+
+	handshakeGUID  = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	maxReadPayload = 4096
+)
+
+var (
+	ErrClosed = errors.New("websocket: connection closed")
+	// ErrHandshake marks requests Upgrade refused before taking over the
+	// connection, they can still get an HTTP response.
+	ErrHandshake = errors.New("websocket: bad handshake")
+)
+
+type Conn struct {
+	conn    net.Conn
+	br      *bufio.Reader
+	writeMu sync.Mutex
+}
+
+// Upgrade performs the opening handshake and takes over the connection.
+// Browsers may only connect from pages of the same host, so other sites
+// can't ride on a visitor's session. Errors wrapping ErrHandshake leave the
+// connection to the caller, any other means it is gone.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, fmt.Errorf("%w: not a websocket handshake", ErrHandshake)
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("%w: unsupported version", ErrHandshake)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("%w: missing Sec-WebSocket-Key", ErrHandshake)
+	}
+	if !sameOrigin(r) {
+		return nil, fmt.Errorf("%w: origin %s not allowed", ErrHandshake, r.Header.Get("Origin"))
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("%w: response does not support hijacking", ErrHandshake)
+	}
+	netConn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+	if _, err := rw.WriteString(response); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: netConn, br: rw.Reader}, nil
+}
+
+// AcceptKey derives the Sec-WebSocket-Accept value for a client key.
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + handshakeGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// sameOrigin accepts requests without an Origin, which only browsers send,
+// and those whose Origin names the host they were sent to.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Conn) WriteText(data []byte, timeout time.Duration) error {
+	return c.writeFrame(OpText, data, timeout)
+}
+
+func (c *Conn) WritePing(timeout time.Duration) error {
+	return c.writeFrame(OpPing, nil, timeout)
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte, timeout time.Duration) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadMessage returns the next data or pong frame. Pings are answered and
+// a close frame is acknowledged before ErrClosed is returned.
+func (c *Conn) ReadMessage() (byte, []byte, error) {
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case OpPing:
+			if err := c.writeFrame(OpPong, payload, time.Second); err != nil {
+				return 0, nil, err
+			}
+		case OpClose:
+			c.writeFrame(OpClose, nil, time.Second)
+			return 0, nil, ErrClosed
+		default:
+			return opcode, payload, nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+
+	if !masked {
+		return 0, nil, fmt.Errorf("websocket: client frame is not masked")
+	}
+	if length > maxReadPayload {
+		return 0, nil, fmt.Errorf("websocket: frame of %d bytes exceeds limit", length)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// Close sends a close frame and closes the underlying connection.
+func (c *Conn) Close() error {
+	c.writeFrame(OpClose, nil, time.Second)
+	return c.conn.Close()
+}
@@ -0,0 +1,149 @@
+package websocket
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455, section 1.3.
+	if got := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("unexpected accept key: %s", got)
+	}
+}
+
+func dial(t *testing.T, url string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("failed to read handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected accept header: %s", resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+	return conn, br
+}
+
+func writeMasked(t *testing.T, conn net.Conn, opcode byte, payload []byte) {
+	t.Helper()
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+}
+
+func readServerFrame(t *testing.T, br *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	payload := make([]byte, head[1]&0x7F)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	return head[0] & 0x0F, payload
+}
+
+func TestUpgradeAndExchange(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			t.Errorf("upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteText([]byte("hello"), time.Second)
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			t.Errorf("read failed: %v", err)
+			return
+		}
+		received <- string(payload)
+	}))
+	defer server.Close()
+
+	conn, br := dial(t, server.URL)
+	defer conn.Close()
+
+	opcode, payload := readServerFrame(t, br)
+	if opcode != OpText || string(payload) != "hello" {
+		t.Errorf("expected text frame 'hello', got opcode %d payload %q", opcode, payload)
+	}
+
+	writeMasked(t, conn, OpPing, []byte("p"))
+	opcode, payload = readServerFrame(t, br)
+	if opcode != OpPong || string(payload) != "p" {
+		t.Errorf("expected pong echoing ping payload, got opcode %d payload %q", opcode, payload)
+	}
+
+	writeMasked(t, conn, OpText, []byte("hi server"))
+	select {
+	case msg := <-received:
+		if msg != "hi server" {
+			t.Errorf("unexpected message: %s", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server did not receive message")
+	}
+}
+
+func TestUpgradeRejectsPlainRequest(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, err := Upgrade(rec, req); !errors.Is(err, ErrHandshake) {
+		t.Errorf("expected ErrHandshake for non-websocket request, got %v", err)
+	}
+}
+
+func TestUpgradeChecksOrigin(t *testing.T) {
+	for origin, allowed := range map[string]bool{
+		"":                                  true,
+		"http://board.example":              true,
+		"https://BOARD.example":             true,
+		"http://evil.example":               false,
+		"http://board.example.evil.example": false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://board.example/catalog/live", nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+
+		// The recorder can't be hijacked, so an allowed origin gets that far.
+		_, err := Upgrade(httptest.NewRecorder(), req)
+		refused := err != nil && strings.Contains(err.Error(), "origin")
+		if refused == allowed {
+			t.Errorf("origin %q: allowed %v, got %v", origin, allowed, err)
+		}
+	}
+}
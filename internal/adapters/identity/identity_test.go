@@ -0,0 +1,85 @@
+package identity
+
+import (
+	"1337b04rd/internal/identicon"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWordListProvider(t *testing.T) {
+	name, avatarURL, err := NewWordListProvider().GenerateIdentity(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !regexp.MustCompile(`^\S+ .+ #\d{4}$`).MatchString(name) {
+		t.Errorf("unexpected name format: %s", name)
+	}
+	if !strings.HasPrefix(avatarURL, identicon.AvatarPath) {
+		t.Errorf("expected identicon avatar, got %s", avatarURL)
+	}
+}
+
+func TestRosterProvider(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectedErr bool
+	}{
+		{
+			name:    "valid roster",
+			content: `[{"name": "Neo", "avatar_url": "https://example.com/neo.png"}]`,
+		},
+		{
+			name:    "entry without avatar",
+			content: `[{"name": "Trinity"}]`,
+		},
+		{
+			name:        "invalid json",
+			content:     `{not json`,
+			expectedErr: true,
+		},
+		{
+			name:        "no named entries",
+			content:     `[{"avatar_url": "https://example.com/x.png"}]`,
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "roster.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("failed to write roster: %v", err)
+			}
+
+			provider, err := NewRosterProvider(path)
+			if tt.expectedErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			name, avatarURL, err := provider.GenerateIdentity(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name == "" || avatarURL == "" {
+				t.Errorf("expected name and avatar, got %q %q", name, avatarURL)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := NewRosterProvider(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
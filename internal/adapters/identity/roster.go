@@ -0,0 +1,62 @@
+package identity
+
+import (
+	"1337b04rd/internal/domain"
+	"1337b04rd/internal/identicon"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+)
+
+type rosterEntry struct {
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// RosterProvider picks identities from a JSON roster file:
+//
+//	[{"name": "Neo", "avatar_url": "https://example.com/neo.png"}, {"name": "Trinity"}]
+//
+// Entries without an avatar get a generated identicon.
+type RosterProvider struct {
+	entries []rosterEntry
+}
+
+func NewRosterProvider(path string) (domain.IdentityProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity roster: %w", err)
+	}
+
+	var entries []rosterEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse identity roster: %w", err)
+	}
+
+	valid := entries[:0]
+	for _, entry := range entries {
+		if entry.Name != "" {
+			valid = append(valid, entry)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, fmt.Errorf("identity roster %s has no named entries", path)
+	}
+
+	return &RosterProvider{entries: valid}, nil
+}
+
+func (p *RosterProvider) GenerateIdentity(ctx context.Context) (string, string, error) {
+	entry := p.entries[rand.Intn(len(p.entries))]
+	if entry.AvatarURL != "" {
+		return entry.Name, entry.AvatarURL, nil
+	}
+
+	avatarURL, err := identicon.RandomAvatarURL()
+	if err != nil {
+		return "", "", err
+	}
+	return entry.Name, avatarURL, nil
+}
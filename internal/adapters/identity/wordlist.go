@@ -0,0 +1,42 @@
+package identity
+
+import (
+	"1337b04rd/internal/domain"
+	"1337b04rd/internal/identicon"
+	"context"
+	"fmt"
+	"math/rand"
+)
+
+var (
+	adjectives = []string{
+		"Anonymous", "Rogue", "Silent", "Phantom", "Binary", "Quantum", "Stealthy",
+		"Glitched", "Encrypted", "Elusive", "Caffeinated", "Recursive", "Volatile",
+	}
+	nouns = []string{
+		"Hacker", "Cracker", "Packet", "Daemon", "Kernel", "Script Kiddie", "Sysadmin",
+		"Phreaker", "Byte", "Cipher", "Netrunner", "Rootkit", "Compiler",
+	}
+)
+
+// WordListProvider builds names like "Anonymous Hacker #1337" from built-in
+// word lists and pairs them with a generated identicon.
+type WordListProvider struct{}
+
+func NewWordListProvider() domain.IdentityProvider {
+	return &WordListProvider{}
+}
+
+func (p *WordListProvider) GenerateIdentity(ctx context.Context) (string, string, error) {
+	avatarURL, err := identicon.RandomAvatarURL()
+	if err != nil {
+		return "", "", err
+	}
+
+	name := fmt.Sprintf("%s %s #%04d",
+		adjectives[rand.Intn(len(adjectives))],
+		nouns[rand.Intn(len(nouns))],
+		rand.Intn(10000),
+	)
+	return name, avatarURL, nil
+}
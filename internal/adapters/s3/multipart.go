@@ -0,0 +1,230 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultPartSize is the part size UploadObject uses. Every part but the
+// last must be at least 5 MiB.
+const DefaultPartSize = 8 << 20
+
+var ErrNoSuchUpload = errors.New("no such upload")
+
+// Part is an uploaded part of a multipart upload, as CompleteMultipartUpload
+// takes it and ListParts returns it.
+type Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+	Size       int64  `xml:"Size,omitempty"`
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type listPartsResult struct {
+	Parts []Part `xml:"Part"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []Part   `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	ETag string `xml:"ETag"`
+}
+
+// CreateMultipartUpload starts a multipart upload and returns its ID.
+func (c *HTTPClient) CreateMultipartUpload(bucketName, objectKey, contentType string) (string, error) {
+	req, err := http.NewRequest("POST", c.baseURL+"/"+bucketName+"/"+objectKey+"?uploads", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create multipart upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	var result initiateMultipartUploadResult
+	if err := c.doXML(req, &result); err != nil {
+		return "", fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	return result.UploadID, nil
+}
+
+// UploadPart uploads one part and returns its ETag. Part numbers run from
+// 1 to 10000, uploading a number again replaces the part.
+func (c *HTTPClient) UploadPart(bucketName, objectKey, uploadID string, partNumber int, data []byte) (string, error) {
+	query := url.Values{"uploadId": {uploadID}, "partNumber": {strconv.Itoa(partNumber)}}
+	req, err := http.NewRequest("PUT", c.baseURL+"/"+bucketName+"/"+objectKey+"?"+query.Encode(), bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload part request: %w", err)
+	}
+	sum := md5.Sum(data)
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+	}
+	resp.Body.Close()
+	return strings.Trim(resp.Header.Get("ETag"), `"`), nil
+}
+
+// ListParts returns the parts uploaded so far, to resume an upload.
+func (c *HTTPClient) ListParts(bucketName, objectKey, uploadID string) ([]Part, error) {
+	req, err := http.NewRequest("GET", c.baseURL+"/"+bucketName+"/"+objectKey+"?uploadId="+url.QueryEscape(uploadID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create list parts request: %w", err)
+	}
+
+	var result listPartsResult
+	if err := c.doXML(req, &result); err != nil {
+		return nil, fmt.Errorf("failed to list parts: %w", err)
+	}
+	for i := range result.Parts {
+		result.Parts[i].ETag = strings.Trim(result.Parts[i].ETag, `"`)
+	}
+	return result.Parts, nil
+}
+
+// CompleteMultipartUpload joins the parts, in ascending part number order,
+// into the object and returns its ETag.
+func (c *HTTPClient) CompleteMultipartUpload(bucketName, objectKey, uploadID string, parts []Part) (string, error) {
+	body, err := xml.Marshal(completeMultipartUpload{Parts: parts})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", c.baseURL+"/"+bucketName+"/"+objectKey+"?uploadId="+url.QueryEscape(uploadID), bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create complete multipart upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+
+	var result completeMultipartUploadResult
+	if err := c.doXML(req, &result); err != nil {
+		return "", fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return strings.Trim(result.ETag, `"`), nil
+}
+
+// AbortMultipartUpload discards an upload and its parts.
+func (c *HTTPClient) AbortMultipartUpload(bucketName, objectKey, uploadID string) error {
+	req, err := http.NewRequest("DELETE", c.baseURL+"/"+bucketName+"/"+objectKey+"?uploadId="+url.QueryEscape(uploadID), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create abort multipart upload request: %w", err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// UploadObject streams body to storage and returns the public URL. size is
+// the length of body, or -1 when it isn't known. Bodies that fit in one part
+// go up in a single PUT, larger ones as a multipart upload, so neither side
+// ever holds more than a part in memory. A failed multipart upload is
+// aborted.
+func (c *HTTPClient) UploadObject(bucketName, objectKey, contentType string, body io.Reader, size int64) (string, error) {
+	// A body known to fit is read at its own size, not a whole part's.
+	if size >= 0 && size <= int64(c.partSize) {
+		data := make([]byte, size)
+		if _, err := io.ReadFull(body, data); err != nil {
+			return "", fmt.Errorf("failed to read object data: %w", err)
+		}
+		return c.CreateObject(bucketName, objectKey, contentType, data)
+	}
+
+	part := make([]byte, c.partSize)
+	n, err := io.ReadFull(body, part)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return c.CreateObject(bucketName, objectKey, contentType, part[:n])
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read object data: %w", err)
+	}
+
+	c.CreateBucket(bucketName)
+	uploadID, err := c.CreateMultipartUpload(bucketName, objectKey, contentType)
+	if err != nil {
+		return "", err
+	}
+	slog.Info("Uploading object in parts", "bucket", bucketName, "key", objectKey, "uploadId", uploadID)
+
+	if err := c.uploadParts(bucketName, objectKey, uploadID, part, body); err != nil {
+		if abortErr := c.AbortMultipartUpload(bucketName, objectKey, uploadID); abortErr != nil {
+			slog.Error("Failed to abort multipart upload", "uploadId", uploadID, "err", abortErr)
+		}
+		return "", err
+	}
+	return c.publicURL + "/" + bucketName + "/" + objectKey, nil
+}
+
+// uploadParts uploads the full first part and the rest of body, then
+// completes the upload.
+func (c *HTTPClient) uploadParts(bucketName, objectKey, uploadID string, first []byte, body io.Reader) error {
+	var parts []Part
+	data := first
+	for {
+		etag, err := c.UploadPart(bucketName, objectKey, uploadID, len(parts)+1, data)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, Part{PartNumber: len(parts) + 1, ETag: etag})
+
+		n, err := io.ReadFull(body, first)
+		if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read object data: %w", err)
+		}
+		data = first[:n]
+	}
+
+	_, err := c.CompleteMultipartUpload(bucketName, objectKey, uploadID, parts)
+	return err
+}
+
+// do executes a request and turns error statuses into errors.
+func (c *HTTPClient) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	xml.NewDecoder(resp.Body).Decode(&s3Err)
+	if s3Err.Code == "NoSuchUpload" {
+		return nil, ErrNoSuchUpload
+	}
+	return nil, fmt.Errorf("unexpected status %d: %s %s", resp.StatusCode, s3Err.Code, s3Err.Message)
+}
+
+func (c *HTTPClient) doXML(req *http.Request, v interface{}) error {
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
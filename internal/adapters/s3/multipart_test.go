@@ -0,0 +1,131 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeMultipart records the multipart requests of one upload.
+type fakeMultipart struct {
+	mu        sync.Mutex
+	parts     map[string][]byte
+	completed []Part
+	aborted   bool
+	puts      int
+	failPart  string
+}
+
+func (f *fakeMultipart) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>videos</Bucket><Key>clip.mp4</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+	case r.Method == http.MethodPut && query.Get("uploadId") == "upload-1":
+		if query.Get("partNumber") == f.failPart {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.parts[query.Get("partNumber")] = body
+		w.Header().Set("ETag", `"etag-`+query.Get("partNumber")+`"`)
+	case r.Method == http.MethodPost && query.Get("uploadId") == "upload-1":
+		var request completeMultipartUpload
+		xml.Unmarshal(body, &request)
+		f.completed = request.Parts
+		w.Write([]byte(`<CompleteMultipartUploadResult><ETag>"abc-3"</ETag></CompleteMultipartUploadResult>`))
+	case r.Method == http.MethodDelete && query.Get("uploadId") == "upload-1":
+		f.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		if r.URL.Path != "/videos" {
+			f.puts++
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<Error><Code>NoSuchUpload</Code><Message>The specified upload does not exist</Message></Error>`))
+	}
+}
+
+func TestHTTPClient_UploadObject_Multipart(t *testing.T) {
+	fake := &fakeMultipart{parts: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, "https://cdn.example")
+	client.partSize = 4
+
+	url, err := client.UploadObject("videos", "clip.mp4", "video/mp4", strings.NewReader("0123456789"), 10)
+	if err != nil {
+		t.Fatalf("UploadObject: %v", err)
+	}
+	if url != "https://cdn.example/videos/clip.mp4" {
+		t.Errorf("url = %s", url)
+	}
+
+	if got := string(fake.parts["1"]) + "|" + string(fake.parts["2"]) + "|" + string(fake.parts["3"]); got != "0123|4567|89" {
+		t.Errorf("parts = %s", got)
+	}
+	want := []Part{{PartNumber: 1, ETag: "etag-1"}, {PartNumber: 2, ETag: "etag-2"}, {PartNumber: 3, ETag: "etag-3"}}
+	if len(fake.completed) != len(want) {
+		t.Fatalf("completed with %+v, want %+v", fake.completed, want)
+	}
+	for i := range want {
+		if fake.completed[i] != want[i] {
+			t.Errorf("completed part %d = %+v, want %+v", i, fake.completed[i], want[i])
+		}
+	}
+}
+
+func TestHTTPClient_UploadObject_SmallBody(t *testing.T) {
+	fake := &fakeMultipart{parts: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, server.URL)
+	client.partSize = 16
+
+	if _, err := client.UploadObject("videos", "clip.mp4", "video/mp4", bytes.NewReader([]byte("short")), 5); err != nil {
+		t.Fatalf("UploadObject: %v", err)
+	}
+	if fake.puts != 1 || len(fake.parts) != 0 {
+		t.Errorf("small body sent as %d PUTs and %d parts, want a single PUT", fake.puts, len(fake.parts))
+	}
+
+	// Without a known size the body is read a part at a time.
+	if _, err := client.UploadObject("videos", "clip.mp4", "video/mp4", strings.NewReader("short"), -1); err != nil {
+		t.Fatalf("UploadObject of unknown size: %v", err)
+	}
+	if fake.puts != 2 || len(fake.parts) != 0 {
+		t.Errorf("small body of unknown size sent as %d PUTs and %d parts, want a single PUT", fake.puts, len(fake.parts))
+	}
+}
+
+func TestHTTPClient_UploadObject_AbortsOnFailure(t *testing.T) {
+	fake := &fakeMultipart{parts: make(map[string][]byte), failPart: "2"}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, server.URL)
+	client.partSize = 4
+
+	if _, err := client.UploadObject("videos", "clip.mp4", "video/mp4", strings.NewReader("0123456789"), -1); err == nil {
+		t.Fatal("expected an error for a failed part")
+	}
+	if !fake.aborted || fake.completed != nil {
+		t.Errorf("aborted = %v, completed = %+v; want aborted only", fake.aborted, fake.completed)
+	}
+
+	if _, err := client.ListParts("videos", "clip.mp4", "unknown"); !errors.Is(err, ErrNoSuchUpload) {
+		t.Errorf("ListParts of an unknown upload: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package s3
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// triple-s verifies the same signature, its tests pin the same value.
+func TestSign(t *testing.T) {
+	const want = "JJfQ4ZAad6O3PdIVgpEVqGKvdXheo-wJnFJ4fOAS5Co"
+	if got := sign("secret", http.MethodPut, "image/png", "1234", "/posts/cat.png", 1760000000); got != want {
+		t.Errorf("sign = %s, want %s", got, want)
+	}
+}
+
+func verifySignature(t *testing.T, u *url.URL, method, contentType string) {
+	t.Helper()
+	query := u.Query()
+	expires, err := strconv.ParseInt(query.Get("Expires"), 10, 64)
+	if err != nil || expires < time.Now().Unix() {
+		t.Errorf("%s %s: bad Expires %q", method, u.Path, query.Get("Expires"))
+	}
+	if query.Get("Signature") != sign("secret", method, contentType, query.Get("Content-Length"), u.Path, expires) {
+		t.Errorf("%s %s: signature doesn't match", method, u.Path)
+	}
+}
+
+func TestHTTPClient_SignsRequests(t *testing.T) {
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.URL.Query().Has("uploads") {
+			w.Write([]byte(`<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, server.URL).WithPresignSecret("secret")
+	if _, err := client.CreateObject("posts", "cat.png", "image/png", []byte("png")); err != nil {
+		t.Fatalf("CreateObject: %v", err)
+	}
+	if _, err := client.CreateMultipartUpload("posts", "clip.mp4", "video/mp4"); err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+
+	if len(requests) != 3 {
+		t.Fatalf("got %d requests, want bucket, object and upload", len(requests))
+	}
+	for _, r := range requests {
+		verifySignature(t, r.URL, r.Method, r.Header.Get("Content-Type"))
+	}
+	if !requests[2].URL.Query().Has("uploads") {
+		t.Errorf("signing dropped the query: %s", requests[2].URL)
+	}
+}
+
+func TestHTTPClient_PresignURL(t *testing.T) {
+	client := NewHTTPClient("http://triple-s:8080", "http://localhost:9000")
+	if _, err := client.PresignURL(http.MethodPut, "posts", "cat.png", "image/png", 3, time.Minute); !errors.Is(err, ErrPresignDisabled) {
+		t.Errorf("PresignURL without a secret: %v", err)
+	}
+
+	client.WithPresignSecret("secret")
+	presigned, err := client.PresignURL(http.MethodPut, "posts", "u1/cat.png", "image/png", 48213, time.Minute)
+	if err != nil {
+		t.Fatalf("PresignURL: %v", err)
+	}
+	u, err := url.Parse(presigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "localhost:9000" || u.Path != "/posts/u1/cat.png" {
+		t.Errorf("presigned URL %s doesn't point at the public storage", presigned)
+	}
+	if u.Query().Get("Content-Length") != "48213" {
+		t.Errorf("presigned URL %s doesn't bind the length", presigned)
+	}
+	verifySignature(t, u, http.MethodPut, "image/png")
+}
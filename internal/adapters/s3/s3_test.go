@@ -0,0 +1,123 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPClient_StatObject(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("method = %s, want HEAD", r.Method)
+		}
+		if r.URL.Path != "/images/cat.png" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", "1234")
+		w.Header().Set("ETag", `"abc123"`)
+		w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+		w.Header().Set("X-Amz-Meta-Post-Id", "42")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, server.URL)
+
+	info, err := client.StatObject("images", "cat.png")
+	if err != nil {
+		t.Fatalf("StatObject: %v", err)
+	}
+	if info.ContentType != "image/png" || info.Size != 1234 || info.ETag != "abc123" {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	if !info.LastModified.Equal(modTime) {
+		t.Errorf("LastModified = %v, want %v", info.LastModified, modTime)
+	}
+	if info.Metadata["post-id"] != "42" {
+		t.Errorf("Metadata = %v, want post-id=42", info.Metadata)
+	}
+
+	exists, err := client.ObjectExists("images", "cat.png")
+	if err != nil || !exists {
+		t.Errorf("ObjectExists(cat.png) = %v, %v; want true", exists, err)
+	}
+	exists, err = client.ObjectExists("images", "dog.png")
+	if err != nil || exists {
+		t.Errorf("ObjectExists(dog.png) = %v, %v; want false", exists, err)
+	}
+}
+
+func TestHTTPClient_CreateObject_ContentMD5(t *testing.T) {
+	data := []byte("image bytes")
+	sum := md5.Sum(data)
+	want := base64.StdEncoding.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == "/images/cat.png" {
+			if got := r.Header.Get("Content-MD5"); got != want {
+				t.Errorf("Content-MD5 = %q, want %q", got, want)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, "http://public")
+	url, err := client.CreateObject("images", "cat.png", "image/png", data)
+	if err != nil {
+		t.Fatalf("CreateObject: %v", err)
+	}
+	if url != "http://public/images/cat.png" {
+		t.Errorf("url = %q", url)
+	}
+}
+
+func TestHTTPClient_CreateObject_Rejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path != "/images" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, server.URL)
+	if _, err := client.CreateObject("images", "cat.png", "image/png", []byte("x")); err == nil {
+		t.Error("expected an error for a rejected upload")
+	}
+}
+
+func TestHTTPClient_ReadObjectHead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/posts/clip.mp4" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Range") != "bytes=0-3" {
+			t.Errorf("Range = %q, want bytes=0-3", r.Header.Get("Range"))
+		}
+		// A server that ignores the range still only gets read n bytes into.
+		w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL, server.URL)
+	head, err := client.ReadObjectHead("posts", "clip.mp4", 4)
+	if err != nil || string(head) != "0123" {
+		t.Errorf("ReadObjectHead = %q, %v; want 0123", head, err)
+	}
+	if _, err := client.ReadObjectHead("posts", "gone.mp4", 4); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("ReadObjectHead of a missing object: %v", err)
+	}
+}
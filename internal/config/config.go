@@ -6,12 +6,20 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"time"
 )
 
 type Config struct {
-	ServerConfig *ServerConfig
-	DBConfig     *DBConfig
-	S3Config     *S3Config
+	ServerConfig    *ServerConfig
+	DBConfig        *DBConfig
+	S3Config        *S3Config
+	SessionConfig   *SessionConfig
+	AvatarConfig    *AvatarConfig
+	IdentityConfig  *IdentityConfig
+	EventsConfig    *EventsConfig
+	RetentionConfig *RetentionConfig
+	ModeratorConfig *ModeratorConfig
+	BoardConfig     *BoardConfig
 }
 
 type ServerConfig struct {
@@ -29,6 +37,66 @@ type DBConfig struct {
 type S3Config struct {
 	BaseURL   string
 	PublicURL string
+	// PresignSecret is triple-s's -presign-secret. Empty disables direct
+	// browser uploads, attachments then go through the app.
+	PresignSecret string
+	PresignTTL    time.Duration
+}
+
+const (
+	IdentityThemeRickAndMorty = "rickandmorty"
+	IdentityThemeWordList     = "wordlist"
+	IdentityThemeRoster       = "roster"
+)
+
+type IdentityConfig struct {
+	Theme      string
+	RosterFile string
+}
+
+const (
+	EventsBackendMemory   = "memory"
+	EventsBackendPostgres = "postgres"
+)
+
+type EventsConfig struct {
+	Backend string
+}
+
+type AvatarConfig struct {
+	PoolSize int
+}
+
+// BoardConfig holds the board's posting rules. Replies beyond BumpLimit no
+// longer keep a thread alive or move it up the catalog. MaxAttachments caps
+// the files per post or comment, the other limits apply to each file; animated
+// GIFs count as video.
+type BoardConfig struct {
+	BumpLimit        int
+	MaxAttachments   int
+	MaxImageSize     int64
+	MaxVideoSize     int64
+	MaxVideoDuration time.Duration
+}
+
+// ModeratorConfig holds the bearer token for the /mod endpoints. An empty
+// token disables them.
+type ModeratorConfig struct {
+	Token string
+}
+
+// RetentionConfig controls the hard purge of archived threads. A zero
+// Days disables purging altogether.
+type RetentionConfig struct {
+	Days      int
+	BatchSize int
+	Interval  time.Duration
+	DryRun    bool
+}
+
+type SessionConfig struct {
+	TTL             time.Duration
+	CleanupInterval time.Duration
 }
 
 func NewConfig() (*Config, error) {
@@ -41,8 +109,55 @@ func NewConfig() (*Config, error) {
 	}
 
 	s3Config := &S3Config{
-		BaseURL:   getEnv("S3_BASE_URL", "http://triples:8080"),
-		PublicURL: getEnv("S3_PUBLIC_URL", "http://localhost:8080"),
+		BaseURL:       getEnv("S3_BASE_URL", "http://triples:8080"),
+		PublicURL:     getEnv("S3_PUBLIC_URL", "http://localhost:8080"),
+		PresignSecret: getEnv("S3_PRESIGN_SECRET", ""),
+		PresignTTL:    getDurationEnv("S3_PRESIGN_TTL", 15*time.Minute),
+	}
+
+	sessionConfig := &SessionConfig{
+		TTL:             getDurationEnv("SESSION_TTL", 7*24*time.Hour),
+		CleanupInterval: getDurationEnv("SESSION_CLEANUP_INTERVAL", time.Hour),
+	}
+
+	avatarConfig := &AvatarConfig{
+		PoolSize: getIntEnv("AVATAR_POOL_SIZE", 20),
+	}
+
+	identityConfig := &IdentityConfig{
+		Theme:      getEnv("IDENTITY_THEME", IdentityThemeRickAndMorty),
+		RosterFile: getEnv("IDENTITY_ROSTER_FILE", "roster.json"),
+	}
+	switch identityConfig.Theme {
+	case IdentityThemeRickAndMorty, IdentityThemeWordList, IdentityThemeRoster:
+	default:
+		return nil, fmt.Errorf("unknown identity theme %q", identityConfig.Theme)
+	}
+
+	eventsConfig := &EventsConfig{
+		Backend: getEnv("EVENTS_BACKEND", EventsBackendMemory),
+	}
+	if eventsConfig.Backend != EventsBackendMemory && eventsConfig.Backend != EventsBackendPostgres {
+		return nil, fmt.Errorf("unknown events backend %q", eventsConfig.Backend)
+	}
+
+	retentionConfig := &RetentionConfig{
+		Days:      getIntEnv("ARCHIVE_RETENTION_DAYS", 0),
+		BatchSize: getIntEnv("PURGE_BATCH_SIZE", 100),
+		Interval:  getDurationEnv("PURGE_INTERVAL", time.Hour),
+		DryRun:    getBoolEnv("PURGE_DRY_RUN", false),
+	}
+
+	boardConfig := &BoardConfig{
+		BumpLimit:        getIntEnv("BUMP_LIMIT", 300),
+		MaxAttachments:   getIntEnv("MAX_ATTACHMENTS", 4),
+		MaxImageSize:     int64(getIntEnv("MAX_IMAGE_SIZE", 5<<20)),
+		MaxVideoSize:     int64(getIntEnv("MAX_VIDEO_SIZE", 20<<20)),
+		MaxVideoDuration: getDurationEnv("MAX_VIDEO_DURATION", 2*time.Minute),
+	}
+
+	moderatorConfig := &ModeratorConfig{
+		Token: getEnv("MODERATOR_TOKEN", ""),
 	}
 
 	serverConfig := &ServerConfig{
@@ -54,9 +169,16 @@ func NewConfig() (*Config, error) {
 	}
 
 	return &Config{
-		DBConfig:     dbConfig,
-		ServerConfig: serverConfig,
-		S3Config:     s3Config,
+		DBConfig:        dbConfig,
+		ServerConfig:    serverConfig,
+		S3Config:        s3Config,
+		SessionConfig:   sessionConfig,
+		AvatarConfig:    avatarConfig,
+		IdentityConfig:  identityConfig,
+		EventsConfig:    eventsConfig,
+		RetentionConfig: retentionConfig,
+		ModeratorConfig: moderatorConfig,
+		BoardConfig:     boardConfig,
 	}, nil
 }
 
@@ -70,6 +192,39 @@ func getEnv(key, defaultVal string) string {
 	return val
 }
 
+func getIntEnv(key string, defaultVal int) int {
+	val := getEnv(key, strconv.Itoa(defaultVal))
+	n, err := strconv.Atoi(val)
+	if err != nil || n <= 0 {
+		slog.Warn("Invalid number in environment variable, using default value!", "key", key, "value", val, "default value", defaultVal)
+		return defaultVal
+	}
+
+	return n
+}
+
+func getDurationEnv(key string, defaultVal time.Duration) time.Duration {
+	val := getEnv(key, defaultVal.String())
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		slog.Warn("Invalid duration in environment variable, using default value!", "key", key, "value", val, "default value", defaultVal)
+		return defaultVal
+	}
+
+	return d
+}
+
+func getBoolEnv(key string, defaultVal bool) bool {
+	val := getEnv(key, strconv.FormatBool(defaultVal))
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		slog.Warn("Invalid boolean in environment variable, using default value!", "key", key, "value", val, "default value", defaultVal)
+		return defaultVal
+	}
+
+	return b
+}
+
 func parseFlags(serverConfig *ServerConfig) error {
 	port := flag.Int("port", 0, "Port to serve on")
 	flag.Usage = func() {
@@ -1,30 +1,98 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPostNotFound = errors.New("post not found")
+	ErrThreadLocked = errors.New("thread is locked")
+
+	ErrObjectNotFound  = errors.New("object not found")
+	ErrPresignDisabled = errors.New("presigned uploads are disabled")
+	ErrAttachmentInUse = errors.New("object is already attached")
+)
 
 type Post struct {
-	ID         int
-	UserID     int
-	Username   string
-	Title      string
-	Content    string
-	ImageURL   string
-	User       *User
-	Comments   []*Comment
-	CreatedAt  time.Time
-	ArchivedAt time.Time
-	Archived   bool
+	ID           int
+	UserID       int
+	Username     string
+	Title        string
+	Content      string
+	ImageURL     string
+	User         *User
+	Comments     []*Comment
+	Attachments  []*Attachment
+	CreatedAt    time.Time
+	ArchivedAt   time.Time
+	LastBumpedAt time.Time
+	Archived     bool
+	Pinned       bool
+	Sticky       bool
+	Locked       bool
 }
 
+// PostFlag names a moderator-controlled switch on a thread.
+type PostFlag string
+
+const (
+	PostFlagSticky PostFlag = "sticky" // kept on top of the catalog and never archived
+	PostFlagLocked PostFlag = "locked" // rejects new comments
+	PostFlagPinned PostFlag = "pinned" // exempt from the archive retention purge
+)
+
 type Comment struct {
-	ID        int
-	UserID    int
-	PostID    int
-	ParentID  int
-	Content   string
-	CreatedAt time.Time
-	User      *User
-	Comments  []*Comment
+	ID          int
+	UserID      int
+	PostID      int
+	ParentID    int
+	Content     string
+	CreatedAt   time.Time
+	User        *User
+	Comments    []*Comment
+	Attachments []*Attachment
+}
+
+// Attachment is an uploaded file. It always belongs to a thread; CommentID
+// is set when it was posted with a reply rather than the opening post.
+type Attachment struct {
+	ID           int
+	PostID       int
+	CommentID    int
+	ObjectKey    string
+	URL          string
+	ThumbnailURL string
+	ContentType  string
+	Size         int64
+	Width        int
+	Height       int
+	Duration     time.Duration
+	Filename     string
+	Spoiler      bool
+	Position     int
+}
+
+func (a *Attachment) IsVideo() bool {
+	return strings.HasPrefix(a.ContentType, "video/")
+}
+
+// PreviewURL is what fits in an <img>: the thumbnail when there is one.
+func (a *Attachment) PreviewURL() string {
+	if a.ThumbnailURL != "" {
+		return a.ThumbnailURL
+	}
+	return a.URL
+}
+
+// StoredObject is what storage reports about an object, e.g. one a browser
+// uploaded through a presigned URL.
+type StoredObject struct {
+	URL         string
+	ContentType string
+	Size        int64
+	Metadata    map[string]string
 }
 
 type User struct {
@@ -34,3 +102,24 @@ type User struct {
 	AvatarURL    string
 	ExpiresAt    time.Time
 }
+
+type EventType string
+
+const (
+	EventPostCreated  EventType = "created"
+	EventCommentAdded EventType = "comment"
+	EventPostBumped   EventType = "bumped"
+	EventPostArchived EventType = "archived"
+)
+
+// AllPosts subscribes to events of every thread on the board.
+const AllPosts = 0
+
+// Event is kept small on purpose so it fits a Postgres NOTIFY payload;
+// subscribers load the comment or post themselves.
+type Event struct {
+	Type       EventType `json:"type"`
+	PostID     int       `json:"post_id"`
+	CommentID  int       `json:"comment_id,omitempty"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
@@ -2,18 +2,25 @@ package domain
 
 import (
 	"context"
+	"io"
+	"time"
 )
 
 type PostService interface {
-	CreatePost(ctx context.Context, userID int, username, title, content, imageURL string) (*Post, error)
+	CreatePost(ctx context.Context, userID int, username, title, content string, attachments []*Attachment) (*Post, error)
 	GetPostByID(ctx context.Context, postID int) (*Post, error)
 	ListPosts(ctx context.Context, archived bool) ([]*Post, error)
 	AddTimeToPostLifetime(ctx context.Context, postID int) error
 	ArchiveOldPosts(ctx context.Context) error
+	PurgeArchived(ctx context.Context, olderThan time.Duration, batchSize int, dryRun bool) (int, error)
+	SetPostFlag(ctx context.Context, postID int, flag PostFlag, value bool) error
+	// AttachmentInUse reports whether a post or comment already has the
+	// object, given as "<bucket>/<key>", attached.
+	AttachmentInUse(ctx context.Context, objectKey string) (bool, error)
 }
 
 type CommentService interface {
-	AddComment(ctx context.Context, userID, postID, parentID int, content string) (*Comment, error)
+	AddComment(ctx context.Context, userID, postID, parentID int, content string, attachments []*Attachment) (*Comment, error)
 	GetCommentsByPostID(ctx context.Context, postID int) ([]*Comment, error)
 	GetCommentByID(ctx context.Context, commentID int) (*Comment, error)
 }
@@ -22,6 +29,7 @@ type UserService interface {
 	GetUserByID(ctx context.Context, userID int) (*User, error)
 	GetOrCreateUser(ctx context.Context, sessionToken string) (*User, bool, error)
 	UpdateUserName(ctx context.Context, userID int, newName string) error
+	PurgeExpiredSessions(ctx context.Context) (int64, error)
 }
 
 type PostRepository interface {
@@ -29,14 +37,26 @@ type PostRepository interface {
 	FindByID(ctx context.Context, id int) (*Post, error)
 	FindAll(ctx context.Context, archived bool) ([]*Post, error)
 	Update(ctx context.Context, post *Post) error
-	ArchiveExpired(ctx context.Context) error
-	Add15Min(ctx context.Context, postID int) error
+	ArchiveExpired(ctx context.Context) ([]int, error)
+	Add15Min(ctx context.Context, postID, bumpLimit int) (bool, error)
+	FindPurgeable(ctx context.Context, archivedBefore time.Time, afterID, limit int) ([]*Post, error)
+	Purge(ctx context.Context, ids []int) error
+	SetFlag(ctx context.Context, postID int, flag PostFlag, value bool) error
+	Delete(ctx context.Context, postID int) error
 }
 
 type CommentRepository interface {
 	Save(ctx context.Context, comment *Comment) (int, error)
 	FindByPostID(ctx context.Context, postID int) ([]*Comment, error)
 	FindByID(ctx context.Context, commentID int) (*Comment, error)
+	Delete(ctx context.Context, commentID int) error
+}
+
+type AttachmentRepository interface {
+	SaveAll(ctx context.Context, attachments []*Attachment) error
+	FindByPostID(ctx context.Context, postID int) ([]*Attachment, error)
+	FindByCommentID(ctx context.Context, commentID int) ([]*Attachment, error)
+	ObjectKeyInUse(ctx context.Context, objectKey string) (bool, error)
 }
 
 type UserRepository interface {
@@ -45,12 +65,33 @@ type UserRepository interface {
 	Save(ctx context.Context, user *User) (int, error)
 	UpdateName(ctx context.Context, userID int, newName string) error
 	GetUserIDBySessionToken(ctx context.Context, sesionToken string) (int, error)
+	ExtendSession(ctx context.Context, userID int, expiresAt time.Time) error
+	DeleteExpired(ctx context.Context) (int64, error)
+	ListAvatarURLs(ctx context.Context) ([]string, error)
+	ReplaceAvatarURL(ctx context.Context, oldURL, newURL string) (int64, error)
 }
 
 type S3Service interface {
 	UploadImage(ctx context.Context, fileData []byte, bucketName, objectKey string) (string, error)
+	// UploadFile streams size bytes of file without holding it in memory.
+	UploadFile(ctx context.Context, file io.Reader, size int64, bucketName, objectKey, contentType string) (string, error)
+	DeleteImage(ctx context.Context, imageURL string) error
+	// PresignUpload returns a URL a browser PUTs the object to directly,
+	// once, with exactly the given Content-Type and size. It returns
+	// ErrPresignDisabled when storage has no presign secret.
+	PresignUpload(ctx context.Context, bucketName, objectKey, contentType string, size int64) (string, error)
+	// StatObject returns ErrObjectNotFound when there is no such object.
+	StatObject(ctx context.Context, bucketName, objectKey string) (*StoredObject, error)
+	// ReadObjectHead returns up to the first n bytes of an object.
+	ReadObjectHead(ctx context.Context, bucketName, objectKey string, n int64) ([]byte, error)
+}
+
+// IdentityProvider hands out the name and avatar given to a new anonymous session.
+type IdentityProvider interface {
+	GenerateIdentity(ctx context.Context) (name string, avatarURL string, err error)
 }
 
-type RickAndMortyAPI interface {
-	GetRandomCharacter(ctx context.Context) (name string, avatarURL string, err error)
+type EventBus interface {
+	Publish(ctx context.Context, event Event) error
+	Subscribe(postID int) (events <-chan Event, unsubscribe func())
 }
@@ -0,0 +1,217 @@
+// Package export renders archived threads into a self-contained static site
+// that can be published on any static host or kept as a cold backup.
+package export
+
+import (
+	"1337b04rd/internal/domain"
+	"1337b04rd/internal/identicon"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const mediaDir = "media"
+
+type ImageFetcher func(ctx context.Context, url string) ([]byte, error)
+
+type Exporter struct {
+	postService  domain.PostService
+	userRepo     domain.UserRepository
+	fetch        ImageFetcher
+	templatesDir string
+
+	media   map[string]string    // source URL -> path relative to the export root
+	authors map[int]*domain.User // user ID -> author with a local avatar
+}
+
+func NewExporter(postService domain.PostService, userRepo domain.UserRepository, fetch ImageFetcher, templatesDir string) *Exporter {
+	return &Exporter{
+		postService:  postService,
+		userRepo:     userRepo,
+		fetch:        fetch,
+		templatesDir: templatesDir,
+		media:        make(map[string]string),
+		authors:      make(map[int]*domain.User),
+	}
+}
+
+// Export writes index.html, one <id>.html page per archived thread and the
+// images and videos they use into outDir. It returns the number of exported threads.
+func (e *Exporter) Export(ctx context.Context, outDir string) (int, error) {
+	postTmpl, err := template.ParseFiles(filepath.Join(e.templatesDir, "archive-post.html"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse thread template: %w", err)
+	}
+	indexTmpl, err := template.ParseFiles(filepath.Join(e.templatesDir, "archive.html"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse index template: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(outDir, mediaDir), 0o755); err != nil {
+		return 0, err
+	}
+
+	posts, err := e.postService.ListPosts(ctx, true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch archived posts: %w", err)
+	}
+
+	for i, listed := range posts {
+		// ListPosts leaves out attachments, GetPostByID adds those of the
+		// post and its comments.
+		post, err := e.postService.GetPostByID(ctx, listed.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to fetch post %d: %w", listed.ID, err)
+		}
+		posts[i] = post
+
+		if err := e.preparePost(ctx, outDir, post); err != nil {
+			return 0, fmt.Errorf("failed to prepare post %d: %w", post.ID, err)
+		}
+
+		var buf bytes.Buffer
+		if err := postTmpl.Execute(&buf, post); err != nil {
+			return 0, fmt.Errorf("failed to render post %d: %w", post.ID, err)
+		}
+		page := filepath.Join(outDir, fmt.Sprintf("%d.html", post.ID))
+		if err := os.WriteFile(page, rewriteLinks(buf.Bytes()), 0o644); err != nil {
+			return 0, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := indexTmpl.Execute(&buf, posts); err != nil {
+		return 0, fmt.Errorf("failed to render index: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "index.html"), rewriteLinks(buf.Bytes()), 0o644); err != nil {
+		return 0, err
+	}
+
+	return len(posts), nil
+}
+
+// preparePost loads authors, nests replies the same way the archive page does
+// and points every image and attachment at its local copy.
+func (e *Exporter) preparePost(ctx context.Context, outDir string, post *domain.Post) error {
+	user, err := e.author(ctx, outDir, post.UserID)
+	if err != nil {
+		return err
+	}
+	post.User = user
+	post.ImageURL = e.localMedia(ctx, outDir, post.ImageURL)
+	e.localAttachments(ctx, outDir, post.Attachments)
+
+	for _, comment := range post.Comments {
+		user, err := e.author(ctx, outDir, comment.UserID)
+		if err != nil {
+			return err
+		}
+		comment.User = user
+		e.localAttachments(ctx, outDir, comment.Attachments)
+	}
+	for _, comment := range post.Comments {
+		if comment.ParentID == 0 {
+			continue
+		}
+		for _, parent := range post.Comments {
+			if parent.ID == comment.ParentID {
+				parent.Comments = append(parent.Comments, comment)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// author loads a user once per export, most threads are a few people
+// replying to each other.
+func (e *Exporter) author(ctx context.Context, outDir string, userID int) (*domain.User, error) {
+	if user, ok := e.authors[userID]; ok {
+		return user, nil
+	}
+	user, err := e.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	author := &domain.User{
+		ID:        user.ID,
+		Name:      user.Name,
+		AvatarURL: e.localMedia(ctx, outDir, user.AvatarURL),
+	}
+	e.authors[userID] = author
+	return author, nil
+}
+
+func (e *Exporter) localAttachments(ctx context.Context, outDir string, attachments []*domain.Attachment) {
+	for _, attachment := range attachments {
+		attachment.URL = e.localMedia(ctx, outDir, attachment.URL)
+		attachment.ThumbnailURL = e.localMedia(ctx, outDir, attachment.ThumbnailURL)
+	}
+}
+
+// localMedia copies an image into the export and returns its relative path.
+// Images that can't be fetched keep their original URL.
+func (e *Exporter) localMedia(ctx context.Context, outDir, source string) string {
+	if source == "" {
+		return ""
+	}
+	if local, ok := e.media[source]; ok {
+		return local
+	}
+
+	var data []byte
+	var err error
+	if u, parseErr := url.Parse(source); parseErr == nil && u.Host == "" && strings.HasPrefix(u.Path, identicon.AvatarPath) {
+		seed := strings.TrimSuffix(strings.TrimPrefix(u.Path, identicon.AvatarPath), ".png")
+		data, err = identicon.Generate(seed, 300)
+	} else {
+		data, err = e.fetch(ctx, source)
+	}
+	if err != nil {
+		slog.Warn("Failed to copy image into export, keeping remote URL", "url", source, "err", err)
+		return source
+	}
+
+	sum := sha256.Sum256([]byte(source))
+	name := hex.EncodeToString(sum[:8]) + mediaExt(source)
+	if err := os.WriteFile(filepath.Join(outDir, mediaDir, name), data, 0o644); err != nil {
+		slog.Warn("Failed to write exported image", "url", source, "err", err)
+		return source
+	}
+
+	local := mediaDir + "/" + name
+	e.media[source] = local
+	return local
+}
+
+func mediaExt(source string) string {
+	u, err := url.Parse(source)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(path.Ext(u.Path))
+}
+
+var (
+	feedLinkRe    = regexp.MustCompile(`\s*<link rel="alternate"[^>]*>`)
+	navLinkRe     = regexp.MustCompile(`href="/(catalog|archive|create-post)"`)
+	archivePostRe = regexp.MustCompile(`(\\?/)archive-post\\?/(\d+)`)
+)
+
+// rewriteLinks turns the app's absolute links into links between the
+// exported pages and drops the feed links, which only work against the app.
+func rewriteLinks(page []byte) []byte {
+	page = feedLinkRe.ReplaceAll(page, nil)
+	page = navLinkRe.ReplaceAll(page, []byte(`href="index.html"`))
+	return archivePostRe.ReplaceAll(page, []byte(`$2.html`))
+}
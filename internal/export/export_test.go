@@ -0,0 +1,147 @@
+package export
+
+import (
+	"1337b04rd/internal/domain"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakePostService struct {
+	domain.PostService
+	posts map[int]*domain.Post
+}
+
+func (s *fakePostService) ListPosts(ctx context.Context, archived bool) ([]*domain.Post, error) {
+	var posts []*domain.Post
+	for _, p := range s.posts {
+		posts = append(posts, &domain.Post{ID: p.ID, Title: p.Title, UserID: p.UserID, ImageURL: p.ImageURL, Archived: true})
+	}
+	return posts, nil
+}
+
+func (s *fakePostService) GetPostByID(ctx context.Context, id int) (*domain.Post, error) {
+	p, ok := s.posts[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return p, nil
+}
+
+type fakeUserRepository struct {
+	domain.UserRepository
+	lookups int
+}
+
+func (r *fakeUserRepository) FindByID(ctx context.Context, id int) (*domain.User, error) {
+	r.lookups++
+	return &domain.User{ID: id, Name: "Rick", AvatarURL: "https://example.com/avatar/1.jpeg"}, nil
+}
+
+func TestExporter_Export(t *testing.T) {
+	posts := &fakePostService{posts: map[int]*domain.Post{
+		7: {
+			ID: 7, Title: "Portal gun", Content: "wubba lubba", UserID: 1, Archived: true,
+			ImageURL: "http://storage/posts/7.png",
+			Attachments: []*domain.Attachment{
+				{URL: "http://storage/posts/7.png", ContentType: "image/png", Filename: "gun.png"},
+				{URL: "http://storage/posts/7.webm", ThumbnailURL: "http://storage/posts/7.webm.thumb.png", ContentType: "video/webm", Filename: "shot.webm"},
+			},
+			Comments: []*domain.Comment{
+				{ID: 1, PostID: 7, UserID: 1, Content: "first", Attachments: []*domain.Attachment{
+					{URL: "http://storage/posts/c1.gif", ContentType: "image/gif", Filename: "dance.gif"},
+				}},
+				{ID: 2, PostID: 7, UserID: 2, ParentID: 1, Content: "reply"},
+			},
+		},
+	}}
+
+	var fetched []string
+	fetch := func(ctx context.Context, url string) ([]byte, error) {
+		fetched = append(fetched, url)
+		return []byte("img"), nil
+	}
+
+	out := t.TempDir()
+	users := &fakeUserRepository{}
+	n, err := NewExporter(posts, users, fetch, "../ui/templates").Export(context.Background(), out)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Export() = %d, want 1", n)
+	}
+	if users.lookups != 2 {
+		t.Errorf("looked up authors %d times, want once per user", users.lookups)
+	}
+	if len(fetched) != 5 {
+		t.Errorf("fetched %v, want the post image, the video and its thumbnail, the comment image and one shared avatar", fetched)
+	}
+
+	page, err := os.ReadFile(filepath.Join(out, "7.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := os.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, html := range map[string]string{"7.html": string(page), "index.html": string(index)} {
+		for _, leak := range []string{"http://storage", "example.com", `href="/`, "archive-post", "feed/"} {
+			if strings.Contains(html, leak) {
+				t.Errorf("%s still references %q", name, leak)
+			}
+		}
+		if !strings.Contains(html, `src="media/`) {
+			t.Errorf("%s doesn't use local media", name)
+		}
+	}
+	if !strings.Contains(string(index), "7.html") {
+		t.Error("index.html doesn't link to the thread page")
+	}
+	if !strings.Contains(string(page), "reply") {
+		t.Error("thread page is missing the nested reply")
+	}
+	for _, name := range []string{"gun.png", "shot.webm", "dance.gif"} {
+		if !strings.Contains(string(page), name) {
+			t.Errorf("thread page is missing the attachment %s", name)
+		}
+	}
+
+	media, _ := os.ReadDir(filepath.Join(out, mediaDir))
+	if len(media) != 5 {
+		t.Errorf("media dir has %d files, want 5", len(media))
+	}
+}
+
+func TestExporter_KeepsRemoteURLWhenFetchFails(t *testing.T) {
+	e := NewExporter(nil, nil, func(ctx context.Context, url string) ([]byte, error) {
+		return nil, errors.New("boom")
+	}, "")
+
+	got := e.localMedia(context.Background(), t.TempDir(), "http://storage/posts/1.png")
+	if got != "http://storage/posts/1.png" {
+		t.Errorf("localMedia() = %q, want the original URL", got)
+	}
+}
+
+func TestExporter_GeneratesIdenticons(t *testing.T) {
+	out := t.TempDir()
+	os.MkdirAll(filepath.Join(out, mediaDir), 0o755)
+	e := NewExporter(nil, nil, func(ctx context.Context, url string) ([]byte, error) {
+		t.Fatalf("unexpected fetch of %s", url)
+		return nil, nil
+	}, "")
+
+	// The second stands in for an avatar that couldn't be mirrored yet.
+	for _, avatar := range []string{"/avatars/abc.png", "/avatars/def.png?src=https%3A%2F%2Fexample.com%2F1.jpeg"} {
+		got := e.localMedia(context.Background(), out, avatar)
+		if !strings.HasPrefix(got, "media/") || !strings.HasSuffix(got, ".png") {
+			t.Errorf("localMedia(%q) = %q, want a local png", avatar, got)
+		}
+	}
+}
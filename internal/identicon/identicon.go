@@ -0,0 +1,76 @@
+package identicon
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+const gridSize = 5
+
+// Generate renders a symmetric 5x5 identicon for seed as a PNG of size x size
+// pixels. The same seed always produces the same image.
+func Generate(seed string, size int) ([]byte, error) {
+	if size < gridSize {
+		size = gridSize
+	}
+	sum := sha256.Sum256([]byte(seed))
+
+	fg := color.RGBA{R: sum[0], G: sum[1], B: sum[2], A: 255}
+	bg := color.RGBA{R: 10, G: 10, B: 10, A: 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	cell := size / gridSize
+	offset := (size - cell*gridSize) / 2
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, bg)
+		}
+	}
+
+	// Only the left half plus the middle column is derived from the hash,
+	// the right half mirrors it.
+	for row := 0; row < gridSize; row++ {
+		for col := 0; col < (gridSize+1)/2; col++ {
+			if sum[3+row*3+col]%2 == 0 {
+				continue
+			}
+			fillCell(img, offset, cell, col, row, fg)
+			fillCell(img, offset, cell, gridSize-1-col, row, fg)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func fillCell(img *image.RGBA, offset, cell, col, row int, c color.Color) {
+	for y := offset + row*cell; y < offset+(row+1)*cell; y++ {
+		for x := offset + col*cell; x < offset+(col+1)*cell; x++ {
+			img.Set(x, y, c)
+		}
+	}
+}
+
+// AvatarPath is where the app serves generated identicons, see
+// handlers.ServeAvatar.
+const AvatarPath = "/avatars/"
+
+// RandomAvatarURL returns the app-relative URL of an identicon for a fresh
+// random seed.
+func RandomAvatarURL() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate avatar seed: %w", err)
+	}
+	return AvatarPath + hex.EncodeToString(b) + ".png", nil
+}
@@ -0,0 +1,101 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/gif"
+	"time"
+)
+
+// maxGIFPixels bounds the logical screen of a GIF. Decoding even the first
+// frame for a thumbnail allocates a byte per pixel, and a few compressed
+// bytes can declare a huge screen.
+const maxGIFPixels = 4096 * 4096
+
+var errTruncatedGIF = errors.New("truncated gif")
+
+// probeGIF reads the screen size from the header and walks the blocks to
+// count frames and add up their delays, without decoding any frame.
+func probeGIF(data []byte) (*Info, error) {
+	cfg, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: corrupt image/gif: %v", ErrUnsupported, err)
+	}
+	if cfg.Width*cfg.Height > maxGIFPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels, the limit is %d", ErrTooLarge, cfg.Width, cfg.Height, maxGIFPixels)
+	}
+
+	frames, duration, err := walkGIF(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: corrupt image/gif: %v", ErrUnsupported, err)
+	}
+
+	info := &Info{ContentType: "image/gif", Kind: KindImage, Width: cfg.Width, Height: cfg.Height}
+	if frames > 1 {
+		info.Kind = KindAnimated
+		info.Duration = duration
+	}
+	return info, nil
+}
+
+// walkGIF skips from block to block up to the trailer. A frame's delay, in
+// hundredths of a second, comes from the graphic control extension before it.
+func walkGIF(data []byte) (frames int, duration time.Duration, err error) {
+	// Header and logical screen descriptor, then the global color table.
+	if len(data) < 13 {
+		return 0, 0, errTruncatedGIF
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+
+	var delay uint16
+	for {
+		if pos >= len(data) {
+			return 0, 0, errTruncatedGIF
+		}
+		switch data[pos] {
+		case 0x21: // extension
+			if pos+2 > len(data) {
+				return 0, 0, errTruncatedGIF
+			}
+			label := data[pos+1]
+			pos += 2
+			if label == 0xf9 && pos+5 <= len(data) && data[pos] == 4 {
+				delay = binary.LittleEndian.Uint16(data[pos+2 : pos+4])
+			}
+		case 0x2c: // image descriptor, then the local color table
+			if pos+10 > len(data) {
+				return 0, 0, errTruncatedGIF
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++ // LZW minimum code size
+			frames++
+			duration += time.Duration(delay) * 10 * time.Millisecond
+			delay = 0
+		case 0x3b: // trailer
+			return frames, duration, nil
+		default:
+			return 0, 0, fmt.Errorf("unknown block 0x%02x", data[pos])
+		}
+
+		// Both kinds of block end in data sub-blocks, up to an empty one.
+		for {
+			if pos >= len(data) {
+				return 0, 0, errTruncatedGIF
+			}
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				break
+			}
+		}
+	}
+}
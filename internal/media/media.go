@@ -0,0 +1,154 @@
+// Package media identifies uploaded files by their content rather than the
+// client-supplied Content-Type, and extracts what the board needs to show
+// them: dimensions, duration and a still thumbnail.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported media type")
+	ErrTooLarge    = errors.New("file is too large")
+	ErrTooLong     = errors.New("media is too long")
+)
+
+type Kind string
+
+const (
+	KindImage    Kind = "image"
+	KindAnimated Kind = "animated"
+	KindVideo    Kind = "video"
+)
+
+type Info struct {
+	ContentType string
+	Kind        Kind
+	Width       int
+	Height      int
+	Duration    time.Duration
+}
+
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"video/webm": ".webm",
+	"video/mp4":  ".mp4",
+}
+
+// Extension is the canonical file extension for the sniffed content type.
+func (i *Info) Extension() string {
+	return extensions[i.ContentType]
+}
+
+// Declared describes a file by the content type its uploader declared, for
+// files the board never reads itself. Dimensions and duration stay unknown,
+// so a GIF counts as a still image.
+func Declared(contentType string) (*Info, error) {
+	if _, ok := extensions[contentType]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, contentType)
+	}
+	kind := KindImage
+	if strings.HasPrefix(contentType, "video/") {
+		kind = KindVideo
+	}
+	return &Info{ContentType: contentType, Kind: kind}, nil
+}
+
+// Limits bound what an upload may be. Animated GIFs count as video.
+type Limits struct {
+	MaxImageSize int64
+	MaxVideoSize int64
+	MaxDuration  time.Duration
+}
+
+func (l Limits) Check(info *Info, size int64) error {
+	maxSize := l.MaxImageSize
+	if info.Kind != KindImage {
+		maxSize = l.MaxVideoSize
+		if info.Duration > l.MaxDuration {
+			return fmt.Errorf("%w: %s is longer than %s", ErrTooLong, info.Duration.Round(time.Second), l.MaxDuration)
+		}
+	}
+	if size > maxSize {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrTooLarge, size, maxSize)
+	}
+	return nil
+}
+
+// Sniff names the container of data by its magic bytes, without parsing
+// any further.
+func Sniff(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return "image/jpeg", nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png", nil
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "image/gif", nil
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "image/webp", nil
+	case bytes.HasPrefix(data, []byte("\x1a\x45\xdf\xa3")):
+		return "video/webm", nil
+	case len(data) >= 12 && string(data[4:8]) == "ftyp" && mp4Brands[string(data[8:12])]:
+		return "video/mp4", nil
+	}
+	return "", ErrUnsupported
+}
+
+// mp4Brands are the major brands of ftyp that mean MP4. HEIC images and
+// QuickTime movies share the box layout under brands of their own.
+var mp4Brands = map[string]bool{
+	"isom": true, "iso2": true, "iso4": true, "iso5": true, "iso6": true,
+	"mp41": true, "mp42": true, "avc1": true, "dash": true, "M4V ": true,
+}
+
+// mediaDuration turns a duration in seconds read from a container into a
+// time.Duration. Values no real file has, zero, negative, NaN, infinite or
+// beyond what a Duration holds, are refused so they can't slip past
+// Limits.MaxDuration.
+func mediaDuration(seconds float64) (time.Duration, error) {
+	if !(seconds > 0) || seconds >= math.MaxInt64/float64(time.Second) {
+		return 0, fmt.Errorf("%w: invalid duration %v", ErrUnsupported, seconds)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// Probe sniffs the container from the file's magic bytes and parses just
+// enough of it to learn its dimensions and duration.
+func Probe(data []byte) (*Info, error) {
+	contentType, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	switch contentType {
+	case "image/gif":
+		return probeGIF(data)
+	case "image/webp":
+		// The stdlib has no WebP decoder, dimensions stay unknown.
+		return &Info{ContentType: "image/webp", Kind: KindImage}, nil
+	case "video/webm":
+		return probeWebM(data)
+	case "video/mp4":
+		return probeMP4(data)
+	}
+	return probeStill(data, contentType)
+}
+
+func probeStill(data []byte, contentType string) (*Info, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: corrupt %s: %v", ErrUnsupported, contentType, err)
+	}
+	return &Info{ContentType: contentType, Kind: KindImage, Width: cfg.Width, Height: cfg.Height}, nil
+}
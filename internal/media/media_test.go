@@ -0,0 +1,253 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"math"
+	"testing"
+	"time"
+)
+
+func box(boxType string, body ...[]byte) []byte {
+	payload := bytes.Join(body, nil)
+	out := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(out, uint32(8+len(payload)))
+	copy(out[4:], boxType)
+	return append(out, payload...)
+}
+
+func testMP4() []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)  // timescale
+	binary.BigEndian.PutUint32(mvhd[16:], 12500) // duration, 12.5s
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], 640<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], 360<<16)
+
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41")),
+		box("moov", box("mvhd", mvhd), box("trak", box("tkhd", tkhd))),
+		box("mdat", []byte("frames")),
+	}, nil)
+}
+
+// element encodes an EBML element; ids are written with their marker bits.
+func element(id uint32, body ...[]byte) []byte {
+	payload := bytes.Join(body, nil)
+	var out []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(out) > 0 {
+			out = append(out, b)
+		}
+	}
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(payload))|1<<56) // 8-byte vint
+	return append(append(out, size...), payload...)
+}
+
+func testWebM() []byte {
+	duration := make([]byte, 8)
+	binary.BigEndian.PutUint64(duration, math.Float64bits(3500)) // ms with the default timescale
+
+	return bytes.Join([][]byte{
+		element(ebmlHeader, element(ebmlDocType, []byte("webm"))),
+		element(mkvSegment,
+			element(mkvInfo, element(mkvTimescale, []byte{0x0f, 0x42, 0x40}), element(mkvDuration, duration)),
+			element(mkvTracks, element(mkvTrackEntry, element(mkvVideo,
+				element(mkvPixelWidth, []byte{0x01, 0x40}),
+				element(mkvPixelHeigh, []byte{0xf0}),
+			))),
+			element(mkvCluster, []byte("frames")),
+		),
+	}, nil)
+}
+
+func testGIF(frames int) []byte {
+	palette := color.Palette{color.Black, color.White}
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 400, 200), palette))
+		g.Delay = append(g.Delay, 50)
+	}
+	var buf bytes.Buffer
+	gif.EncodeAll(&buf, g)
+	return buf.Bytes()
+}
+
+func TestProbe(t *testing.T) {
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 3, 4)))
+
+	tests := []struct {
+		name string
+		data []byte
+		want Info
+	}{
+		{"png", pngData.Bytes(), Info{ContentType: "image/png", Kind: KindImage, Width: 3, Height: 4}},
+		{"still gif", testGIF(1), Info{ContentType: "image/gif", Kind: KindImage, Width: 400, Height: 200}},
+		{"animated gif", testGIF(3), Info{ContentType: "image/gif", Kind: KindAnimated, Width: 400, Height: 200, Duration: 1500 * time.Millisecond}},
+		{"mp4", testMP4(), Info{ContentType: "video/mp4", Kind: KindVideo, Width: 640, Height: 360, Duration: 12500 * time.Millisecond}},
+		{"webm", testWebM(), Info{ContentType: "video/webm", Kind: KindVideo, Width: 320, Height: 240, Duration: 3500 * time.Millisecond}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Probe(tt.data)
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("Probe() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbe_Unsupported(t *testing.T) {
+	webmDuration := func(seconds float64) []byte {
+		var old, new [8]byte
+		binary.BigEndian.PutUint64(old[:], math.Float64bits(3500))
+		binary.BigEndian.PutUint64(new[:], math.Float64bits(seconds*1000))
+		return bytes.Replace(testWebM(), old[:], new[:], 1)
+	}
+
+	for name, data := range map[string][]byte{
+		"heic":           bytes.Replace(testMP4(), []byte("ftypisom"), []byte("ftypheic"), 1),
+		"quicktime":      bytes.Replace(testMP4(), []byte("ftypisom"), []byte("ftypqt  "), 1),
+		"negative webm":  webmDuration(-5),
+		"nan webm":       webmDuration(math.NaN()),
+		"infinite webm":  webmDuration(math.Inf(1)),
+		"html":           []byte("<html><script>alert(1)</script></html>"),
+		"empty":          nil,
+		"truncated mp4":  testMP4()[:40],
+		"truncated gif":  testGIF(3)[:300],
+		"matroska video": bytes.Replace(testWebM(), []byte("webm"), []byte("mkvx"), 1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Probe(data); !errors.Is(err, ErrUnsupported) {
+				t.Errorf("Probe() error = %v, want ErrUnsupported", err)
+			}
+		})
+	}
+}
+
+// A duration whose nanoseconds don't fit in an int64 mustn't wrap around
+// to a negative one that passes the limit.
+func TestProbe_LongMP4(t *testing.T) {
+	data := testMP4()
+	mvhd := bytes.Index(data, []byte("mvhd")) + 4
+	binary.BigEndian.PutUint32(data[mvhd+16:], 0xffffffff) // ms, about 50 days
+
+	info, err := Probe(data)
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if info.Duration != 0xffffffff*time.Millisecond {
+		t.Errorf("Duration = %s, want %s", info.Duration, 0xffffffff*time.Millisecond)
+	}
+	if err := (Limits{MaxVideoSize: 1 << 20, MaxDuration: time.Minute}).Check(info, 1); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Check() error = %v, want ErrTooLong", err)
+	}
+}
+
+// A GIF declaring a 65535x65535 screen in a few bytes is refused before any
+// frame is decoded.
+func TestProbe_HugeGIF(t *testing.T) {
+	data := []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00,\x00\x00\x00\x00\xff\xff\xff\xff\x00\x02\x02\x44\x01\x00;")
+	if _, err := Probe(data); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Probe() error = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	// A head too short to probe still names its container.
+	if contentType, err := Sniff(testMP4()[:40]); err != nil || contentType != "video/mp4" {
+		t.Errorf("Sniff(mp4 head) = %q, %v; want video/mp4", contentType, err)
+	}
+	if _, err := Sniff([]byte("<html>")); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Sniff(html) error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestDeclared(t *testing.T) {
+	for contentType, want := range map[string]Kind{"image/png": KindImage, "image/gif": KindImage, "video/mp4": KindVideo} {
+		info, err := Declared(contentType)
+		if err != nil || info.Kind != want || info.Extension() == "" {
+			t.Errorf("Declared(%s) = %+v, %v; want kind %s", contentType, info, err, want)
+		}
+	}
+	for _, contentType := range []string{"text/html", "image/svg+xml", ""} {
+		if _, err := Declared(contentType); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Declared(%q) error = %v, want ErrUnsupported", contentType, err)
+		}
+	}
+}
+
+func TestLimits_Check(t *testing.T) {
+	limits := Limits{MaxImageSize: 100, MaxVideoSize: 1000, MaxDuration: time.Minute}
+
+	tests := []struct {
+		name string
+		info Info
+		size int64
+		want error
+	}{
+		{"small image", Info{Kind: KindImage}, 100, nil},
+		{"large image", Info{Kind: KindImage}, 101, ErrTooLarge},
+		{"video under limits", Info{Kind: KindVideo, Duration: time.Minute}, 1000, nil},
+		{"large video", Info{Kind: KindVideo}, 1001, ErrTooLarge},
+		{"long video", Info{Kind: KindVideo, Duration: 61 * time.Second}, 10, ErrTooLong},
+		{"long gif", Info{Kind: KindAnimated, Duration: 2 * time.Minute}, 10, ErrTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := limits.Check(&tt.info, tt.size); !errors.Is(err, tt.want) {
+				t.Errorf("Check() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          []byte
+		width, height int
+	}{
+		{"animated gif first frame", testGIF(2), 250, 125},
+		{"video placeholder", testMP4(), 250, 140},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Probe(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			thumb, err := Thumbnail(tt.data, info)
+			if err != nil {
+				t.Fatalf("Thumbnail() error = %v", err)
+			}
+			cfg, err := png.DecodeConfig(bytes.NewReader(thumb))
+			if err != nil {
+				t.Fatalf("thumbnail is not a png: %v", err)
+			}
+			if cfg.Width != tt.width || cfg.Height != tt.height {
+				t.Errorf("thumbnail is %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.width, tt.height)
+			}
+		})
+	}
+
+	t.Run("stills need none", func(t *testing.T) {
+		thumb, err := Thumbnail(nil, &Info{Kind: KindImage})
+		if thumb != nil || err != nil {
+			t.Errorf("Thumbnail() = %v, %v, want nil, nil", thumb, err)
+		}
+	})
+}
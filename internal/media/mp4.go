@@ -0,0 +1,106 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type mp4Info struct {
+	timescale     uint32
+	duration      uint64
+	width, height int
+}
+
+func probeMP4(data []byte) (*Info, error) {
+	m := &mp4Info{}
+	if err := m.walk(data, 0); err != nil {
+		return nil, fmt.Errorf("%w: corrupt video/mp4: %v", ErrUnsupported, err)
+	}
+	if m.timescale == 0 {
+		return nil, fmt.Errorf("%w: mp4 without a movie header", ErrUnsupported)
+	}
+	duration, err := mediaDuration(float64(m.duration) / float64(m.timescale))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Info{
+		ContentType: "video/mp4",
+		Kind:        KindVideo,
+		Width:       m.width,
+		Height:      m.height,
+		Duration:    duration,
+	}, nil
+}
+
+// walk visits the boxes in data and descends into moov and trak, where the
+// movie and track headers live.
+func (m *mp4Info) walk(data []byte, depth int) error {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		boxType := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return fmt.Errorf("truncated %s box", boxType)
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return fmt.Errorf("bad size for %s box", boxType)
+		}
+		body := data[header:size]
+		data = data[size:]
+
+		switch boxType {
+		case "moov", "trak":
+			if depth > 4 {
+				return fmt.Errorf("boxes nested too deep")
+			}
+			if err := m.walk(body, depth+1); err != nil {
+				return err
+			}
+		case "mvhd":
+			if err := m.movieHeader(body); err != nil {
+				return err
+			}
+		case "tkhd":
+			m.trackHeader(body)
+		}
+	}
+	return nil
+}
+
+func (m *mp4Info) movieHeader(body []byte) error {
+	if len(body) < 20 {
+		return fmt.Errorf("truncated mvhd box")
+	}
+	if body[0] == 1 {
+		if len(body) < 32 {
+			return fmt.Errorf("truncated mvhd box")
+		}
+		m.timescale = binary.BigEndian.Uint32(body[20:24])
+		m.duration = binary.BigEndian.Uint64(body[24:32])
+		return nil
+	}
+	m.timescale = binary.BigEndian.Uint32(body[12:16])
+	m.duration = uint64(binary.BigEndian.Uint32(body[16:20]))
+	return nil
+}
+
+// trackHeader keeps the size of the first visual track. Width and height are
+// 16.16 fixed point at the very end of the box.
+func (m *mp4Info) trackHeader(body []byte) {
+	if m.width != 0 || len(body) < 8 {
+		return
+	}
+	width := int(binary.BigEndian.Uint32(body[len(body)-8:]) >> 16)
+	height := int(binary.BigEndian.Uint32(body[len(body)-4:]) >> 16)
+	if width > 0 && height > 0 {
+		m.width, m.height = width, height
+	}
+}
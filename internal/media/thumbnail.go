@@ -0,0 +1,93 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+)
+
+const thumbnailSize = 250
+
+// Thumbnail returns a PNG still for media that can't be shown as an <img>
+// as is: the first frame of an animated GIF, or a placeholder for videos
+// since decoding video frames is out of reach of the standard library.
+// Stills need no thumbnail and get nil.
+func Thumbnail(data []byte, info *Info) ([]byte, error) {
+	var img image.Image
+	switch info.Kind {
+	case KindAnimated:
+		first, err := gif.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode first frame: %w", err)
+		}
+		img = scaleDown(first, thumbnailSize)
+	case KindVideo:
+		img = placeholder(info)
+	default:
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleDown fits img into a limit×limit box with nearest-neighbour sampling.
+func scaleDown(img image.Image, limit int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= limit && h <= limit {
+		return img
+	}
+	if w >= h {
+		w, h = limit, h*limit/w
+	} else {
+		w, h = w*limit/h, limit
+	}
+	w, h = max(w, 1), max(h, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.Set(x, y, img.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+	return dst
+}
+
+// placeholder draws a play symbol on the board's dark background, keeping the
+// video's aspect ratio when it is known.
+func placeholder(info *Info) image.Image {
+	w, h := thumbnailSize, thumbnailSize*9/16
+	if info.Width > 0 && info.Height > 0 {
+		if info.Width >= info.Height {
+			h = thumbnailSize * info.Height / info.Width
+		} else {
+			w, h = thumbnailSize*info.Width/info.Height, thumbnailSize
+		}
+	}
+	w, h = max(w, 32), max(h, 32)
+
+	bg := color.RGBA{0x0a, 0x0a, 0x0a, 0xff}
+	fg := color.RGBA{0x00, 0xff, 0x00, 0xff}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	side := min(w, h) / 3
+	left, top := (w-side)/2, (h-side)/2
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, bg)
+			// A right-pointing triangle: the half-height shrinks towards the tip.
+			dx, dy := x-left, y-top
+			if dx >= 0 && dx < side && dy >= dx/2 && dy <= side-dx/2 {
+				img.Set(x, y, fg)
+			}
+		}
+	}
+	return img
+}
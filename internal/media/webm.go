@@ -0,0 +1,142 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// EBML element IDs, marker bits included, as in the Matroska spec.
+const (
+	ebmlHeader    = 0x1A45DFA3
+	ebmlDocType   = 0x4282
+	mkvSegment    = 0x18538067
+	mkvInfo       = 0x1549A966
+	mkvTimescale  = 0x2AD7B1
+	mkvDuration   = 0x4489
+	mkvTracks     = 0x1654AE6B
+	mkvTrackEntry = 0xAE
+	mkvVideo      = 0xE0
+	mkvPixelWidth = 0xB0
+	mkvPixelHeigh = 0xBA
+	mkvCluster    = 0x1F43B675
+)
+
+type webmInfo struct {
+	docType       string
+	timescale     uint64
+	duration      float64
+	width, height int
+}
+
+func probeWebM(data []byte) (*Info, error) {
+	w := &webmInfo{timescale: 1000000}
+	if err := w.walk(data, 0); err != nil {
+		return nil, fmt.Errorf("%w: corrupt video/webm: %v", ErrUnsupported, err)
+	}
+	if w.docType != "webm" {
+		return nil, fmt.Errorf("%w: matroska doctype %q", ErrUnsupported, w.docType)
+	}
+	// Duration counts ticks of timescale nanoseconds.
+	duration, err := mediaDuration(w.duration * float64(w.timescale) / float64(time.Second))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Info{
+		ContentType: "video/webm",
+		Kind:        KindVideo,
+		Width:       w.width,
+		Height:      w.height,
+		Duration:    duration,
+	}, nil
+}
+
+// walk visits the elements in data, descending into the masters that lead to
+// the header fields, and stops at the first cluster since media data follows.
+func (w *webmInfo) walk(data []byte, depth int) error {
+	for len(data) > 0 {
+		id, n := readVint(data, true)
+		if n == 0 {
+			return fmt.Errorf("bad element id")
+		}
+		data = data[n:]
+
+		size, n := readVint(data, false)
+		if n == 0 {
+			return fmt.Errorf("bad element size")
+		}
+		data = data[n:]
+		// Unknown or overlong sizes (live streams) run to the end of the data.
+		if size > uint64(len(data)) {
+			size = uint64(len(data))
+		}
+		body := data[:size]
+		data = data[size:]
+
+		switch id {
+		case mkvCluster:
+			return nil
+		case ebmlHeader, mkvSegment, mkvInfo, mkvTracks, mkvTrackEntry, mkvVideo:
+			if depth > 8 {
+				return fmt.Errorf("elements nested too deep")
+			}
+			if err := w.walk(body, depth+1); err != nil {
+				return err
+			}
+		case ebmlDocType:
+			w.docType = string(body)
+		case mkvTimescale:
+			w.timescale = readUint(body)
+		case mkvDuration:
+			switch len(body) {
+			case 4:
+				w.duration = float64(math.Float32frombits(binary.BigEndian.Uint32(body)))
+			case 8:
+				w.duration = math.Float64frombits(binary.BigEndian.Uint64(body))
+			}
+		case mkvPixelWidth:
+			if w.width == 0 {
+				w.width = int(readUint(body))
+			}
+		case mkvPixelHeigh:
+			if w.height == 0 {
+				w.height = int(readUint(body))
+			}
+		}
+	}
+	return nil
+}
+
+// readVint decodes an EBML variable-length integer. IDs keep their length
+// marker bit, sizes don't. It returns 0 bytes read on malformed input.
+func readVint(data []byte, keepMarker bool) (uint64, int) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0
+	}
+	length := 1
+	for mask := byte(0x80); data[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || len(data) < length {
+		return 0, 0
+	}
+
+	v := uint64(data[0])
+	if !keepMarker {
+		v &= uint64(0xFF >> length)
+	}
+	for _, b := range data[1:length] {
+		v = v<<8 | uint64(b)
+	}
+	return v, length
+}
+
+func readUint(data []byte) uint64 {
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
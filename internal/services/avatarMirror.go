@@ -0,0 +1,142 @@
+package services
+
+import (
+	"1337b04rd/internal/domain"
+	"1337b04rd/internal/identicon"
+	"1337b04rd/internal/media"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+const AvatarBucket = "avatars"
+
+type ImageFetcher func(ctx context.Context, url string) ([]byte, error)
+
+// AvatarMirror copies third-party avatar images into triple-s so visitors'
+// browsers never hot-link the original host. It wraps another provider and
+// can be used as a drop-in domain.IdentityProvider.
+type AvatarMirror struct {
+	provider  domain.IdentityProvider
+	s3Service domain.S3Service
+	fetch     ImageFetcher
+	publicURL string
+
+	mu       sync.Mutex
+	mirrored map[string]string
+}
+
+func NewAvatarMirror(provider domain.IdentityProvider, s3Service domain.S3Service, fetch ImageFetcher, publicURL string) *AvatarMirror {
+	return &AvatarMirror{
+		provider:  provider,
+		s3Service: s3Service,
+		fetch:     fetch,
+		publicURL: publicURL,
+		mirrored:  make(map[string]string),
+	}
+}
+
+func (m *AvatarMirror) GenerateIdentity(ctx context.Context) (string, string, error) {
+	name, avatarURL, err := m.provider.GenerateIdentity(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	mirroredURL, err := m.Mirror(ctx, avatarURL)
+	if err != nil {
+		slog.Warn("Failed to mirror avatar, using an identicon until the backfill retries", "url", avatarURL, "err", err)
+		return name, FallbackAvatarURL(avatarURL), nil
+	}
+	return name, mirroredURL, nil
+}
+
+// FallbackAvatarURL is the identicon a user gets while their avatar can't
+// be mirrored, so the page never hot-links the original. The source rides
+// along in the query for the backfill, see PendingAvatarSource.
+func FallbackAvatarURL(sourceURL string) string {
+	sum := sha256.Sum256([]byte(sourceURL))
+	return identicon.AvatarPath + hex.EncodeToString(sum[:8]) + ".png?src=" + url.QueryEscape(sourceURL)
+}
+
+// PendingAvatarSource returns the source of an avatar FallbackAvatarURL
+// stood in for.
+func PendingAvatarSource(avatarURL string) (string, bool) {
+	u, err := url.Parse(avatarURL)
+	if err != nil || u.Host != "" || !strings.HasPrefix(u.Path, identicon.AvatarPath) {
+		return "", false
+	}
+	source := u.Query().Get("src")
+	return source, isRemoteURL(source)
+}
+
+// Mirror stores sourceURL in the avatars bucket and returns its public URL.
+// Local and already mirrored URLs are returned unchanged.
+func (m *AvatarMirror) Mirror(ctx context.Context, sourceURL string) (string, error) {
+	if !isRemoteURL(sourceURL) || strings.HasPrefix(sourceURL, m.publicURL) {
+		return sourceURL, nil
+	}
+
+	m.mu.Lock()
+	cached, ok := m.mirrored[sourceURL]
+	m.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	data, err := m.fetch(ctx, sourceURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch avatar: %w", err)
+	}
+
+	key, err := avatarObjectKey(sourceURL, data)
+	if err != nil {
+		return "", err
+	}
+
+	mirroredURL, err := m.s3Service.UploadImage(ctx, data, AvatarBucket, key)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	m.mirrored[sourceURL] = mirroredURL
+	m.mu.Unlock()
+	return mirroredURL, nil
+}
+
+func isRemoteURL(raw string) bool {
+	return strings.HasPrefix(raw, "http://") || strings.HasPrefix(raw, "https://")
+}
+
+// avatarObjectKey keys avatars by a hash of the full source URL, as
+// FallbackAvatarURL does, since unrelated hosts reuse file names such as
+// avatar.png. The extension comes from the image itself, or from the URL
+// when the format isn't one the board sniffs.
+func avatarObjectKey(sourceURL string, data []byte) (string, error) {
+	sum := sha256.Sum256([]byte(sourceURL))
+	name := hex.EncodeToString(sum[:8])
+
+	if contentType, err := media.Sniff(data); err == nil {
+		if !strings.HasPrefix(contentType, "image/") {
+			return "", fmt.Errorf("avatar %s is not an image but %s", sourceURL, contentType)
+		}
+		return name + (&media.Info{ContentType: contentType}).Extension(), nil
+	}
+
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid avatar URL: %w", err)
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	if !strings.HasPrefix(mime.TypeByExtension(ext), "image/") {
+		return "", fmt.Errorf("avatar %s is not a known image format", sourceURL)
+	}
+	return name + ext, nil
+}
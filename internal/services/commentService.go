@@ -4,36 +4,61 @@ import (
 	"1337b04rd/internal/domain"
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
 	"time"
 )
 
 type CommentService struct {
-	commentRepo domain.CommentRepository
-	postRepo    domain.PostRepository
+	commentRepo    domain.CommentRepository
+	postRepo       domain.PostRepository
+	attachmentRepo domain.AttachmentRepository
+	events         domain.EventBus
 }
 
-func NewCommentService(commentRepo domain.CommentRepository, postRepo domain.PostRepository) domain.CommentService {
-	return &CommentService{commentRepo: commentRepo, postRepo: postRepo}
+func NewCommentService(commentRepo domain.CommentRepository, postRepo domain.PostRepository, attachmentRepo domain.AttachmentRepository, events domain.EventBus) domain.CommentService {
+	return &CommentService{commentRepo: commentRepo, postRepo: postRepo, attachmentRepo: attachmentRepo, events: events}
 }
 
-func (s *CommentService) AddComment(ctx context.Context, userID, postID, parentID int, content string) (*domain.Comment, error) {
-	_, err := s.postRepo.FindByID(ctx, postID)
+func (s *CommentService) AddComment(ctx context.Context, userID, postID, parentID int, content string, attachments []*domain.Attachment) (*domain.Comment, error) {
+	post, err := s.postRepo.FindByID(ctx, postID)
 	if err != nil {
 		return nil, errors.New("post not found")
 	}
+	if post.Locked {
+		return nil, domain.ErrThreadLocked
+	}
 
 	comment := &domain.Comment{
-		UserID:    userID,
-		PostID:    postID,
-		ParentID:  parentID,
-		Content:   content,
-		CreatedAt: time.Now(),
+		UserID:      userID,
+		PostID:      postID,
+		ParentID:    parentID,
+		Content:     content,
+		CreatedAt:   time.Now(),
+		Attachments: attachments,
 	}
 	id, err := s.commentRepo.Save(ctx, comment)
 	if err != nil {
 		return nil, err
 	}
 	comment.ID = id
+
+	for _, attachment := range attachments {
+		attachment.PostID = postID
+		attachment.CommentID = id
+	}
+	if err := s.attachmentRepo.SaveAll(ctx, attachments); err != nil {
+		// Without the comment a retry doesn't leave a duplicate behind.
+		if deleteErr := s.commentRepo.Delete(ctx, id); deleteErr != nil {
+			slog.Error("Failed to delete comment without attachments", "commentID", id, "err", deleteErr)
+		}
+		return nil, fmt.Errorf("failed to save comment attachments: %w", err)
+	}
+
+	event := domain.Event{Type: domain.EventCommentAdded, PostID: postID, CommentID: id}
+	if err := s.events.Publish(ctx, event); err != nil {
+		slog.Error("Failed to publish comment event", "postID", postID, "err", err)
+	}
 	return comment, nil
 }
 
@@ -46,5 +71,10 @@ func (s *CommentService) GetCommentByID(ctx context.Context, commentID int) (*do
 	if err != nil {
 		return nil, errors.New("comment not found")
 	}
+
+	comment.Attachments, err = s.attachmentRepo.FindByCommentID(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
 	return comment, nil
 }
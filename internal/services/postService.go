@@ -4,39 +4,90 @@ import (
 	"1337b04rd/internal/domain"
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 )
 
 type PostService struct {
-	postRepo    domain.PostRepository
-	commentRepo domain.CommentRepository
-	userRepo    domain.UserRepository
+	postRepo       domain.PostRepository
+	commentRepo    domain.CommentRepository
+	userRepo       domain.UserRepository
+	attachmentRepo domain.AttachmentRepository
+	s3Service      domain.S3Service
+	events         domain.EventBus
+	bumpLimit      int
 }
 
-func NewPostService(postRepo domain.PostRepository, commentRepo domain.CommentRepository, userRepo domain.UserRepository) domain.PostService {
-	return &PostService{postRepo: postRepo, commentRepo: commentRepo, userRepo: userRepo}
+func NewPostService(postRepo domain.PostRepository, commentRepo domain.CommentRepository, userRepo domain.UserRepository, attachmentRepo domain.AttachmentRepository, s3Service domain.S3Service, events domain.EventBus, bumpLimit int) domain.PostService {
+	return &PostService{
+		postRepo:       postRepo,
+		commentRepo:    commentRepo,
+		userRepo:       userRepo,
+		attachmentRepo: attachmentRepo,
+		s3Service:      s3Service,
+		events:         events,
+		bumpLimit:      bumpLimit,
+	}
 }
 
-func (s *PostService) CreatePost(ctx context.Context, userID int, name, title, content, imageURL string) (*domain.Post, error) {
+// CreatePost saves the post and its attachments. The first non-spoiler
+// attachment doubles as the post's ImageURL, the catalog thumbnail.
+func (s *PostService) CreatePost(ctx context.Context, userID int, name, title, content string, attachments []*domain.Attachment) (*domain.Post, error) {
 	post := &domain.Post{
-		UserID:     userID,
-		Username:   name,
-		Title:      title,
-		Content:    content,
-		ImageURL:   imageURL,
-		CreatedAt:  time.Now(),
-		ArchivedAt: time.Now().Add(15 * time.Minute),
+		UserID:       userID,
+		Username:     name,
+		Title:        title,
+		Content:      content,
+		ImageURL:     coverURL(attachments),
+		Attachments:  attachments,
+		CreatedAt:    time.Now(),
+		ArchivedAt:   time.Now().Add(15 * time.Minute),
+		LastBumpedAt: time.Now(),
 	}
 	id, err := s.postRepo.Save(ctx, post)
 	if err != nil {
 		return nil, fmt.Errorf("failed to save created post: %s", err)
 	}
 	post.ID = id
+
+	for _, attachment := range attachments {
+		attachment.PostID = id
+	}
+	if err := s.attachmentRepo.SaveAll(ctx, attachments); err != nil {
+		// Without the post a retry doesn't leave a duplicate behind.
+		if deleteErr := s.postRepo.Delete(ctx, id); deleteErr != nil {
+			slog.Error("Failed to delete post without attachments", "postID", id, "err", deleteErr)
+		}
+		return nil, fmt.Errorf("failed to save post attachments: %w", err)
+	}
+
+	s.publish(ctx, domain.Event{Type: domain.EventPostCreated, PostID: id, ArchivedAt: post.ArchivedAt})
 	return post, nil
 }
 
 func (s *PostService) GetPostByID(ctx context.Context, postID int) (*domain.Post, error) {
-	return s.postRepo.FindByID(ctx, postID)
+	post, err := s.postRepo.FindByID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := s.attachmentRepo.FindByPostID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	comments := make(map[int]*domain.Comment, len(post.Comments))
+	for _, comment := range post.Comments {
+		comments[comment.ID] = comment
+	}
+	for _, attachment := range attachments {
+		if comment, ok := comments[attachment.CommentID]; ok {
+			comment.Attachments = append(comment.Attachments, attachment)
+		} else if attachment.CommentID == 0 {
+			post.Attachments = append(post.Attachments, attachment)
+		}
+	}
+	return post, nil
 }
 
 func (s *PostService) ListPosts(ctx context.Context, archived bool) ([]*domain.Post, error) {
@@ -44,9 +95,137 @@ func (s *PostService) ListPosts(ctx context.Context, archived bool) ([]*domain.P
 }
 
 func (s *PostService) AddTimeToPostLifetime(ctx context.Context, postID int) error {
-	return s.postRepo.Add15Min(ctx, postID)
+	bumped, err := s.postRepo.Add15Min(ctx, postID, s.bumpLimit)
+	if err != nil {
+		return err
+	}
+	if !bumped {
+		slog.Debug("Bump limit reached, post not bumped", "postID", postID, "bumpLimit", s.bumpLimit)
+		return nil
+	}
+
+	s.publish(ctx, domain.Event{
+		Type:       domain.EventPostBumped,
+		PostID:     postID,
+		ArchivedAt: time.Now().Add(15 * time.Minute),
+	})
+	return nil
 }
 
 func (s *PostService) ArchiveOldPosts(ctx context.Context) error {
-	return s.postRepo.ArchiveExpired(ctx)
+	archivedIDs, err := s.postRepo.ArchiveExpired(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range archivedIDs {
+		s.publish(ctx, domain.Event{Type: domain.EventPostArchived, PostID: id, ArchivedAt: time.Now()})
+	}
+	return nil
+}
+
+// PurgeArchived hard-deletes archived, unpinned threads archived more than
+// olderThan ago, batchSize at a time, and removes their images from storage.
+// With dryRun set it only logs what would be purged.
+func (s *PostService) PurgeArchived(ctx context.Context, olderThan time.Duration, batchSize int, dryRun bool) (int, error) {
+	cutoff := time.Now().Add(-olderThan)
+	purged, afterID := 0, 0
+
+	for {
+		posts, err := s.postRepo.FindPurgeable(ctx, cutoff, afterID, batchSize)
+		if err != nil {
+			return purged, err
+		}
+		if len(posts) == 0 {
+			return purged, nil
+		}
+
+		ids := make([]int, 0, len(posts))
+		images := make(map[int][]string, len(posts))
+		for _, post := range posts {
+			ids = append(ids, post.ID)
+			afterID = post.ID
+
+			attachments, err := s.attachmentRepo.FindByPostID(ctx, post.ID)
+			if err != nil {
+				return purged, err
+			}
+			images[post.ID] = purgedImageURLs(post, attachments)
+		}
+
+		if !dryRun {
+			if err := s.postRepo.Purge(ctx, ids); err != nil {
+				return purged, fmt.Errorf("failed to purge posts %v: %w", ids, err)
+			}
+		}
+
+		for _, post := range posts {
+			slog.Info("Purged archived post", "postID", post.ID, "title", post.Title, "images", len(images[post.ID]), "archivedAt", post.ArchivedAt, "dryRun", dryRun)
+			if dryRun {
+				continue
+			}
+			// The rows are gone already; a leftover image is logged, not retried.
+			for _, imageURL := range images[post.ID] {
+				if err := s.s3Service.DeleteImage(ctx, imageURL); err != nil {
+					slog.Error("Failed to delete purged post image", "postID", post.ID, "imageURL", imageURL, "err", err)
+				}
+			}
+		}
+		purged += len(posts)
+
+		if len(posts) < batchSize {
+			return purged, nil
+		}
+	}
+}
+
+func (s *PostService) SetPostFlag(ctx context.Context, postID int, flag domain.PostFlag, value bool) error {
+	if err := s.postRepo.SetFlag(ctx, postID, flag, value); err != nil {
+		return err
+	}
+	slog.Info("Post flag changed", "postID", postID, "flag", flag, "value", value)
+	return nil
+}
+
+func (s *PostService) AttachmentInUse(ctx context.Context, objectKey string) (bool, error) {
+	return s.attachmentRepo.ObjectKeyInUse(ctx, objectKey)
+}
+
+// coverURL picks the catalog image: the first attachment that isn't a
+// spoiler and fits in an <img>. Videos only qualify with a thumbnail.
+func coverURL(attachments []*domain.Attachment) string {
+	for _, attachment := range attachments {
+		if attachment.Spoiler || (attachment.IsVideo() && attachment.ThumbnailURL == "") {
+			continue
+		}
+		return attachment.PreviewURL()
+	}
+	return ""
+}
+
+// purgedImageURLs lists every stored file of a thread once. Posts created
+// before attachments existed only have ImageURL.
+func purgedImageURLs(post *domain.Post, attachments []*domain.Attachment) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	if post.ImageURL != "" {
+		urls = append(urls, post.ImageURL)
+		seen[post.ImageURL] = true
+	}
+	for _, attachment := range attachments {
+		for _, url := range []string{attachment.URL, attachment.ThumbnailURL} {
+			if url != "" && !seen[url] {
+				urls = append(urls, url)
+				seen[url] = true
+			}
+		}
+	}
+	return urls
+}
+
+// publish is best effort, a lost live update must never fail the request.
+func (s *PostService) publish(ctx context.Context, event domain.Event) {
+	if err := s.events.Publish(ctx, event); err != nil {
+		slog.Error("Failed to publish event", "type", event.Type, "postID", event.PostID, "err", err)
+	}
 }
@@ -9,6 +9,8 @@ import (
 	"time"
 )
 
+const testBumpLimit = 300
+
 type mockPostRepository struct {
 	posts       map[int]*domain.Post
 	lastID      int
@@ -19,6 +21,7 @@ type mockPostRepository struct {
 	updateErr   error
 	archiveErr  error
 	add15MinErr error
+	purgeErr    error
 }
 
 func newMockPostRepo() *mockPostRepository {
@@ -97,37 +100,186 @@ func (m *mockPostRepository) Update(ctx context.Context, post *domain.Post) erro
 	return nil
 }
 
-func (m *mockPostRepository) ArchiveExpired(ctx context.Context) error {
+func (m *mockPostRepository) ArchiveExpired(ctx context.Context) ([]int, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if m.archiveErr != nil {
-		return m.archiveErr
+		return nil, m.archiveErr
 	}
 
+	var ids []int
 	now := time.Now()
 	for _, post := range m.posts {
-		if !post.Archived && now.After(post.ArchivedAt) {
+		if !post.Archived && !post.Sticky && now.After(post.ArchivedAt) {
 			post.Archived = true
+			ids = append(ids, post.ID)
 		}
 	}
-	return nil
+	return ids, nil
 }
 
-func (m *mockPostRepository) Add15Min(ctx context.Context, postID int) error {
+func (m *mockPostRepository) Add15Min(ctx context.Context, postID, bumpLimit int) (bool, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.add15MinErr != nil {
+		return false, m.add15MinErr
+	}
+
 	post, exists := m.posts[postID]
 	if !exists {
-		return errors.New("post not found")
+		return false, errors.New("post not found")
+	}
+	if len(post.Comments) > bumpLimit {
+		return false, nil
 	}
 
 	// Add 15 minutes to the ArchivedAt time
 	post.ArchivedAt = post.ArchivedAt.Add(15 * time.Minute)
+	post.LastBumpedAt = time.Now()
+	return true, nil
+}
+
+func (m *mockPostRepository) FindPurgeable(ctx context.Context, archivedBefore time.Time, afterID, limit int) ([]*domain.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var posts []*domain.Post
+	for id := afterID + 1; id <= m.lastID && len(posts) < limit; id++ {
+		post, exists := m.posts[id]
+		if exists && post.Archived && !post.Pinned && post.ArchivedAt.Before(archivedBefore) {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+func (m *mockPostRepository) Purge(ctx context.Context, ids []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.purgeErr != nil {
+		return m.purgeErr
+	}
+	for _, id := range ids {
+		delete(m.posts, id)
+	}
+	return nil
+}
+
+func (m *mockPostRepository) SetFlag(ctx context.Context, postID int, flag domain.PostFlag, value bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	post, exists := m.posts[postID]
+	if !exists {
+		return domain.ErrPostNotFound
+	}
+	switch flag {
+	case domain.PostFlagSticky:
+		post.Sticky = value
+	case domain.PostFlagLocked:
+		post.Locked = value
+	case domain.PostFlagPinned:
+		post.Pinned = value
+	default:
+		return errors.New("unknown flag")
+	}
+	return nil
+}
+
+func (m *mockPostRepository) Delete(ctx context.Context, postID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.posts, postID)
+	return nil
+}
+
+type mockAttachmentRepository struct {
+	mu          sync.Mutex
+	attachments []*domain.Attachment
+	saveErr     error
+}
+
+func newMockAttachmentRepo() *mockAttachmentRepository {
+	return &mockAttachmentRepository{}
+}
+
+func (m *mockAttachmentRepository) SaveAll(ctx context.Context, attachments []*domain.Attachment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	for _, a := range attachments {
+		a.ID = len(m.attachments) + 1
+		m.attachments = append(m.attachments, a)
+	}
+	return nil
+}
+
+func (m *mockAttachmentRepository) FindByPostID(ctx context.Context, postID int) ([]*domain.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var attachments []*domain.Attachment
+	for _, a := range m.attachments {
+		if a.PostID == postID {
+			attachments = append(attachments, a)
+		}
+	}
+	return attachments, nil
+}
+
+func (m *mockAttachmentRepository) FindByCommentID(ctx context.Context, commentID int) ([]*domain.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var attachments []*domain.Attachment
+	for _, a := range m.attachments {
+		if a.CommentID == commentID {
+			attachments = append(attachments, a)
+		}
+	}
+	return attachments, nil
+}
+
+func (m *mockAttachmentRepository) ObjectKeyInUse(ctx context.Context, objectKey string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, a := range m.attachments {
+		if a.ObjectKey == objectKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type mockEventBus struct {
+	mu        sync.Mutex
+	published []domain.Event
+}
+
+func newMockEventBus() *mockEventBus {
+	return &mockEventBus{}
+}
+
+func (m *mockEventBus) Publish(ctx context.Context, event domain.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.published = append(m.published, event)
 	return nil
 }
 
+func (m *mockEventBus) Subscribe(postID int) (<-chan domain.Event, func()) {
+	ch := make(chan domain.Event)
+	return ch, func() {}
+}
+
 type mockCommentRepository struct {
 	comments        map[int]*domain.Comment
 	postComments    map[int][]*domain.Comment
@@ -147,6 +299,7 @@ type mockUserRepository struct {
 	saveErr        error
 	updateNameErr  error
 	getUserIDErr   error
+	extendErr      error
 }
 
 func newMockUserRepo() *mockUserRepository {
@@ -181,7 +334,7 @@ func (m *mockUserRepository) FindBySessionToken(ctx context.Context, sessionToke
 	}
 
 	user, exists := m.usersByToken[sessionToken]
-	if !exists {
+	if !exists || (!user.ExpiresAt.IsZero() && user.ExpiresAt.Before(time.Now())) {
 		return nil, errors.New("user not found")
 	}
 	return user, nil
@@ -236,6 +389,68 @@ func (m *mockUserRepository) GetUserIDBySessionToken(ctx context.Context, sessio
 	return user.ID, nil
 }
 
+func (m *mockUserRepository) ExtendSession(ctx context.Context, userID int, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.extendErr != nil {
+		return m.extendErr
+	}
+
+	user, exists := m.users[userID]
+	if !exists {
+		return errors.New("user not found")
+	}
+	user.ExpiresAt = expiresAt
+	return nil
+}
+
+func (m *mockUserRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	now := time.Now()
+	for id, user := range m.users {
+		if !user.ExpiresAt.IsZero() && user.ExpiresAt.Before(now) {
+			delete(m.users, id)
+			delete(m.usersByToken, user.SessionToken)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *mockUserRepository) ListAvatarURLs(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := make(map[string]struct{})
+	var urls []string
+	for _, user := range m.users {
+		if _, ok := seen[user.AvatarURL]; ok {
+			continue
+		}
+		seen[user.AvatarURL] = struct{}{}
+		urls = append(urls, user.AvatarURL)
+	}
+	return urls, nil
+}
+
+func (m *mockUserRepository) ReplaceAvatarURL(ctx context.Context, oldURL, newURL string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var replaced int64
+	for _, user := range m.users {
+		if user.AvatarURL == oldURL {
+			user.AvatarURL = newURL
+			replaced++
+		}
+	}
+	return replaced, nil
+}
+
 func (m *mockCommentRepository) Save(ctx context.Context, comment *domain.Comment) (int, error) {
 	if m.saveErr != nil {
 		return 0, m.saveErr
@@ -268,6 +483,22 @@ func (m *mockCommentRepository) FindByPostID(ctx context.Context, postID int) ([
 	return m.postComments[postID], nil
 }
 
+func (m *mockCommentRepository) Delete(ctx context.Context, commentID int) error {
+	comment, exists := m.comments[commentID]
+	if !exists {
+		return errors.New("not found")
+	}
+	delete(m.comments, commentID)
+	siblings := m.postComments[comment.PostID]
+	for i, c := range siblings {
+		if c.ID == commentID {
+			m.postComments[comment.PostID] = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
 func newMockCommentRepo() *mockCommentRepository {
 	return &mockCommentRepository{
 		comments:     make(map[int]*domain.Comment),
@@ -314,8 +545,8 @@ func TestPostService_CreatePost(t *testing.T) {
 			repo := newMockPostRepo()
 			repo.saveErr = tt.saveErr
 
-			service := NewPostService(repo, &mockCommentRepository{}, &mockUserRepository{})
-			post, err := service.CreatePost(context.Background(), tt.userID, tt.username, tt.title, tt.content, tt.imageURL)
+			service := NewPostService(repo, &mockCommentRepository{}, &mockUserRepository{}, newMockAttachmentRepo(), &mockS3Service{}, newMockEventBus(), testBumpLimit)
+			post, err := service.CreatePost(context.Background(), tt.userID, tt.username, tt.title, tt.content, []*domain.Attachment{{URL: tt.imageURL}})
 
 			if tt.expectedErr {
 				if err == nil {
@@ -405,7 +636,7 @@ func TestPostService_GetPostByID(t *testing.T) {
 				})
 			}
 
-			service := NewPostService(repo, &mockCommentRepository{}, &mockUserRepository{})
+			service := NewPostService(repo, &mockCommentRepository{}, &mockUserRepository{}, newMockAttachmentRepo(), &mockS3Service{}, newMockEventBus(), testBumpLimit)
 			post, err := service.GetPostByID(context.Background(), tt.postID)
 
 			if tt.expectedErr {
@@ -481,7 +712,7 @@ func TestPostService_ListPosts(t *testing.T) {
 				repo.Save(context.Background(), post)
 			}
 
-			service := NewPostService(repo, &mockCommentRepository{}, &mockUserRepository{})
+			service := NewPostService(repo, &mockCommentRepository{}, &mockUserRepository{}, newMockAttachmentRepo(), &mockS3Service{}, newMockEventBus(), testBumpLimit)
 			posts, err := service.ListPosts(context.Background(), tt.archived)
 
 			if tt.expectedErr {
@@ -544,7 +775,7 @@ func TestPostService_ArchiveOldPosts(t *testing.T) {
 				repo.Save(context.Background(), post)
 			}
 
-			service := NewPostService(repo, &mockCommentRepository{}, &mockUserRepository{})
+			service := NewPostService(repo, &mockCommentRepository{}, &mockUserRepository{}, newMockAttachmentRepo(), &mockS3Service{}, newMockEventBus(), testBumpLimit)
 			err := service.ArchiveOldPosts(context.Background())
 
 			if tt.expectedErr {
@@ -613,7 +844,7 @@ func TestPostService_ArchiveOldPosts(t *testing.T) {
 // 				originalTime = post.ArchivedAt
 // 			}
 
-// 			service := NewPostService(repo, &mockCommentRepository{}, &mockUserRepository{})
+// 			service := NewPostService(repo, &mockCommentRepository{}, &mockUserRepository{}, newMockAttachmentRepo(), &mockS3Service{}, newMockEventBus(), testBumpLimit)
 // 			err := service.AddTimeToPostLifetime(context.Background(), tt.postID)
 
 // 			if tt.expectedErr {
@@ -680,8 +911,8 @@ func TestCommentService_AddComment(t *testing.T) {
 				postRepo.Save(context.Background(), &domain.Post{ID: tt.postID})
 			}
 
-			service := NewCommentService(commentRepo, postRepo)
-			comment, err := service.AddComment(context.Background(), tt.userID, tt.postID, tt.parentID, tt.content)
+			service := NewCommentService(commentRepo, postRepo, newMockAttachmentRepo(), newMockEventBus())
+			comment, err := service.AddComment(context.Background(), tt.userID, tt.postID, tt.parentID, tt.content, nil)
 
 			if tt.expectedErr {
 				if err == nil {
@@ -748,7 +979,7 @@ func TestCommentService_GetCommentsByPostID(t *testing.T) {
 				commentRepo.Save(context.Background(), &domain.Comment{PostID: tt.postID})
 			}
 
-			service := NewCommentService(commentRepo, newMockPostRepo())
+			service := NewCommentService(commentRepo, newMockPostRepo(), newMockAttachmentRepo(), newMockEventBus())
 			comments, err := service.GetCommentsByPostID(context.Background(), tt.postID)
 
 			if tt.expectedErr {
@@ -795,3 +1026,283 @@ func TestPostRepository_ConcurrentAccess(t *testing.T) {
 		t.Errorf("expected title 'Test', got '%s'", updatedPost.Title)
 	}
 }
+
+func TestServices_PublishEvents(t *testing.T) {
+	t.Run("comment added", func(t *testing.T) {
+		postRepo := newMockPostRepo()
+		postRepo.Save(context.Background(), &domain.Post{Title: "Test"})
+		bus := newMockEventBus()
+
+		service := NewCommentService(newMockCommentRepo(), postRepo, newMockAttachmentRepo(), bus)
+		comment, err := service.AddComment(context.Background(), 1, 1, 0, "hello", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(bus.published) != 1 {
+			t.Fatalf("expected 1 event, got %d", len(bus.published))
+		}
+		event := bus.published[0]
+		if event.Type != domain.EventCommentAdded || event.PostID != 1 || event.CommentID != comment.ID {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	})
+
+	t.Run("post bumped", func(t *testing.T) {
+		repo := newMockPostRepo()
+		repo.Save(context.Background(), &domain.Post{Title: "Test"})
+		bus := newMockEventBus()
+
+		service := NewPostService(repo, newMockCommentRepo(), newMockUserRepo(), newMockAttachmentRepo(), &mockS3Service{}, bus, testBumpLimit)
+		if err := service.AddTimeToPostLifetime(context.Background(), 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(bus.published) != 1 || bus.published[0].Type != domain.EventPostBumped {
+			t.Errorf("expected a bumped event, got %+v", bus.published)
+		}
+	})
+
+	t.Run("posts archived", func(t *testing.T) {
+		repo := newMockPostRepo()
+		repo.Save(context.Background(), &domain.Post{ArchivedAt: time.Now().Add(-time.Hour)})
+		repo.Save(context.Background(), &domain.Post{ArchivedAt: time.Now().Add(-time.Hour)})
+		repo.Save(context.Background(), &domain.Post{ArchivedAt: time.Now().Add(time.Hour)})
+		bus := newMockEventBus()
+
+		service := NewPostService(repo, newMockCommentRepo(), newMockUserRepo(), newMockAttachmentRepo(), &mockS3Service{}, bus, testBumpLimit)
+		if err := service.ArchiveOldPosts(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(bus.published) != 2 {
+			t.Fatalf("expected 2 archive events, got %d", len(bus.published))
+		}
+		for _, event := range bus.published {
+			if event.Type != domain.EventPostArchived {
+				t.Errorf("expected archived event, got %s", event.Type)
+			}
+		}
+	})
+}
+
+func TestPostService_PurgeArchived(t *testing.T) {
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	newRepo := func() *mockPostRepository {
+		repo := newMockPostRepo()
+		repo.Save(context.Background(), &domain.Post{Archived: true, ArchivedAt: old, ImageURL: "http://storage.local/posts/1.png"})
+		repo.Save(context.Background(), &domain.Post{Archived: true, ArchivedAt: old, Pinned: true})
+		repo.Save(context.Background(), &domain.Post{Archived: true, ArchivedAt: time.Now()})
+		repo.Save(context.Background(), &domain.Post{ArchivedAt: old})
+		repo.Save(context.Background(), &domain.Post{Archived: true, ArchivedAt: old})
+		repo.Save(context.Background(), &domain.Post{Archived: true, ArchivedAt: old, ImageURL: "http://storage.local/posts/6.png"})
+		return repo
+	}
+	retention := 30 * 24 * time.Hour
+
+	t.Run("purges in batches and deletes images", func(t *testing.T) {
+		repo := newRepo()
+		s3 := &mockS3Service{}
+		service := NewPostService(repo, newMockCommentRepo(), newMockUserRepo(), newMockAttachmentRepo(), s3, newMockEventBus(), testBumpLimit)
+
+		purged, err := service.PurgeArchived(context.Background(), retention, 2, false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if purged != 3 {
+			t.Errorf("expected 3 purged posts, got %d", purged)
+		}
+		for _, id := range []int{1, 5, 6} {
+			if _, exists := repo.posts[id]; exists {
+				t.Errorf("expected post %d to be purged", id)
+			}
+		}
+		for _, id := range []int{2, 3, 4} {
+			if _, exists := repo.posts[id]; !exists {
+				t.Errorf("expected post %d to be kept", id)
+			}
+		}
+		if len(s3.deleted) != 2 {
+			t.Errorf("expected 2 deleted images, got %v", s3.deleted)
+		}
+	})
+
+	t.Run("dry run deletes nothing", func(t *testing.T) {
+		repo := newRepo()
+		s3 := &mockS3Service{}
+		service := NewPostService(repo, newMockCommentRepo(), newMockUserRepo(), newMockAttachmentRepo(), s3, newMockEventBus(), testBumpLimit)
+
+		purged, err := service.PurgeArchived(context.Background(), retention, 2, true)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if purged != 3 {
+			t.Errorf("expected 3 purgeable posts, got %d", purged)
+		}
+		if len(repo.posts) != 6 || len(s3.deleted) != 0 {
+			t.Errorf("dry run modified state: %d posts left, deleted images %v", len(repo.posts), s3.deleted)
+		}
+	})
+
+	t.Run("purge error", func(t *testing.T) {
+		repo := newRepo()
+		repo.purgeErr = errors.New("db down")
+		s3 := &mockS3Service{}
+		service := NewPostService(repo, newMockCommentRepo(), newMockUserRepo(), newMockAttachmentRepo(), s3, newMockEventBus(), testBumpLimit)
+
+		if _, err := service.PurgeArchived(context.Background(), retention, 2, false); err == nil {
+			t.Error("expected an error")
+		}
+		if len(s3.deleted) != 0 {
+			t.Errorf("images deleted despite failed purge: %v", s3.deleted)
+		}
+	})
+}
+
+func TestPostService_StickyAndLocked(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sticky threads are not archived", func(t *testing.T) {
+		repo := newMockPostRepo()
+		repo.Save(ctx, &domain.Post{ArchivedAt: time.Now().Add(-time.Hour)})
+		repo.Save(ctx, &domain.Post{ArchivedAt: time.Now().Add(-time.Hour)})
+		service := NewPostService(repo, newMockCommentRepo(), newMockUserRepo(), newMockAttachmentRepo(), &mockS3Service{}, newMockEventBus(), testBumpLimit)
+
+		if err := service.SetPostFlag(ctx, 1, domain.PostFlagSticky, true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := service.ArchiveOldPosts(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if repo.posts[1].Archived {
+			t.Error("expected sticky post to stay in the catalog")
+		}
+		if !repo.posts[2].Archived {
+			t.Error("expected regular post to be archived")
+		}
+	})
+
+	t.Run("locked threads reject comments", func(t *testing.T) {
+		repo := newMockPostRepo()
+		repo.Save(ctx, &domain.Post{Title: "Flame war"})
+		postService := NewPostService(repo, newMockCommentRepo(), newMockUserRepo(), newMockAttachmentRepo(), &mockS3Service{}, newMockEventBus(), testBumpLimit)
+		commentService := NewCommentService(newMockCommentRepo(), repo, newMockAttachmentRepo(), newMockEventBus())
+
+		if err := postService.SetPostFlag(ctx, 1, domain.PostFlagLocked, true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := commentService.AddComment(ctx, 1, 1, 0, "one more thing", nil); !errors.Is(err, domain.ErrThreadLocked) {
+			t.Errorf("expected ErrThreadLocked, got %v", err)
+		}
+
+		if err := postService.SetPostFlag(ctx, 1, domain.PostFlagLocked, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := commentService.AddComment(ctx, 1, 1, 0, "one more thing", nil); err != nil {
+			t.Errorf("expected comment on unlocked thread, got %v", err)
+		}
+	})
+
+	t.Run("unknown post", func(t *testing.T) {
+		service := NewPostService(newMockPostRepo(), newMockCommentRepo(), newMockUserRepo(), newMockAttachmentRepo(), &mockS3Service{}, newMockEventBus(), testBumpLimit)
+		if err := service.SetPostFlag(ctx, 42, domain.PostFlagLocked, true); !errors.Is(err, domain.ErrPostNotFound) {
+			t.Errorf("expected ErrPostNotFound, got %v", err)
+		}
+	})
+}
+
+func TestPostService_BumpLimit(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockPostRepo()
+	repo.Save(ctx, &domain.Post{Title: "Long thread"})
+	originalArchivedAt := repo.posts[1].ArchivedAt
+	bus := newMockEventBus()
+	service := NewPostService(repo, newMockCommentRepo(), newMockUserRepo(), newMockAttachmentRepo(), &mockS3Service{}, bus, 2)
+
+	for i := 1; i <= 3; i++ {
+		repo.posts[1].Comments = append(repo.posts[1].Comments, &domain.Comment{ID: i, PostID: 1})
+		if err := service.AddTimeToPostLifetime(ctx, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if got := repo.posts[1].ArchivedAt.Sub(originalArchivedAt); got != 30*time.Minute {
+		t.Errorf("expected only 2 bumps (30m), got %v", got)
+	}
+	if len(bus.published) != 2 {
+		t.Errorf("expected 2 bumped events, got %d", len(bus.published))
+	}
+}
+
+func TestServices_Attachments(t *testing.T) {
+	ctx := context.Background()
+	postRepo := newMockPostRepo()
+	commentRepo := newMockCommentRepo()
+	attachmentRepo := newMockAttachmentRepo()
+	postService := NewPostService(postRepo, commentRepo, newMockUserRepo(), attachmentRepo, &mockS3Service{}, newMockEventBus(), testBumpLimit)
+	commentService := NewCommentService(commentRepo, postRepo, attachmentRepo, newMockEventBus())
+
+	post, err := postService.CreatePost(ctx, 1, "user", "Gallery", "pics", []*domain.Attachment{
+		{URL: "http://storage.local/posts/spoiler.png", Spoiler: true, Position: 0},
+		{URL: "http://storage.local/posts/clip.webm", ContentType: "video/webm", Position: 1},
+		{URL: "http://storage.local/posts/cover.png", Position: 2},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if post.ImageURL != "http://storage.local/posts/cover.png" {
+		t.Errorf("expected the first non-spoiler image as cover, skipping videos without a thumbnail, got %q", post.ImageURL)
+	}
+
+	comment, err := commentService.AddComment(ctx, 1, post.ID, 0, "reply", []*domain.Attachment{
+		{URL: "http://storage.local/posts/reply.png"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The post mock doesn't track comments, so attach it by hand like the DB would.
+	postRepo.posts[post.ID].Comments = []*domain.Comment{comment}
+	postRepo.posts[post.ID].Attachments = nil
+	comment.Attachments = nil
+
+	got, err := postService.GetPostByID(ctx, post.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Attachments) != 3 {
+		t.Errorf("expected 3 post attachments, got %d", len(got.Attachments))
+	}
+	if len(got.Comments[0].Attachments) != 1 || got.Comments[0].Attachments[0].CommentID != comment.ID {
+		t.Errorf("expected the reply attachment on the comment, got %+v", got.Comments[0].Attachments)
+	}
+}
+
+func TestServices_AttachmentSaveFails(t *testing.T) {
+	ctx := context.Background()
+	postRepo := newMockPostRepo()
+	commentRepo := newMockCommentRepo()
+	attachmentRepo := newMockAttachmentRepo()
+	postService := NewPostService(postRepo, commentRepo, newMockUserRepo(), attachmentRepo, &mockS3Service{}, newMockEventBus(), testBumpLimit)
+	commentService := NewCommentService(commentRepo, postRepo, attachmentRepo, newMockEventBus())
+
+	post, err := postService.CreatePost(ctx, 1, "user", "Thread", "text", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	attachmentRepo.saveErr = errors.New("database error")
+	if _, err := postService.CreatePost(ctx, 1, "user", "Gallery", "pics", []*domain.Attachment{{URL: "http://storage.local/posts/a.png"}}); err == nil {
+		t.Error("expected CreatePost to fail")
+	}
+	if len(postRepo.posts) != 1 {
+		t.Errorf("expected the post without attachments to be deleted, %d posts left", len(postRepo.posts))
+	}
+
+	if _, err := commentService.AddComment(ctx, 1, post.ID, 0, "reply", []*domain.Attachment{{URL: "http://storage.local/posts/b.png"}}); err == nil {
+		t.Error("expected AddComment to fail")
+	}
+	if len(commentRepo.comments) != 0 || len(commentRepo.postComments[post.ID]) != 0 {
+		t.Errorf("expected the comment without attachments to be deleted, got %v", commentRepo.comments)
+	}
+}
@@ -4,20 +4,27 @@ import (
 	"1337b04rd/internal/adapters/s3"
 	"1337b04rd/internal/domain"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"mime"
+	"net/http"
 	"path/filepath"
+	"time"
 )
 
 // S3ServiceImpl implements domain.S3Service using the HTTPClient
 type S3ServiceImpl struct {
-	client *s3.HTTPClient
+	client     *s3.HTTPClient
+	presignTTL time.Duration
 }
 
-// NewS3Service creates a new S3ServiceImpl with given base URL and bucket name
-func NewS3Service(baseURL, publicURL string) domain.S3Service {
-	httpClient := s3.NewHTTPClient(baseURL, publicURL)
-	return &S3ServiceImpl{client: httpClient}
+// NewS3Service creates a new S3ServiceImpl with given base URL and bucket name.
+// With a presign secret its requests are signed and PresignUpload hands out
+// URLs valid for presignTTL.
+func NewS3Service(baseURL, publicURL, presignSecret string, presignTTL time.Duration) domain.S3Service {
+	httpClient := s3.NewHTTPClient(baseURL, publicURL).WithPresignSecret(presignSecret)
+	return &S3ServiceImpl{client: httpClient, presignTTL: presignTTL}
 }
 
 // UploadImage reads raw bytes and uploads to S3, returning the public URL
@@ -27,14 +34,86 @@ func (s *S3ServiceImpl) UploadImage(ctx context.Context, fileData []byte, bucket
 		"." + filepath.Ext(objectKey)[1:],
 	)
 	if contentType == "" {
-		// fallback to generic binary
-		contentType = "application/octet-stream"
+		// The stdlib table lacks e.g. .webm and .mp4, sniff those instead;
+		// this also falls back to generic binary
+		contentType = http.DetectContentType(fileData)
 	}
 
-	// Use the HTTPClient to do the upload
 	url, err := s.client.CreateObject(bucketName, objectKey, contentType, fileData)
 	if err != nil {
 		return "", fmt.Errorf("failed to upload image to S3: %w", err)
 	}
 	return url, nil
 }
+
+// UploadFile streams size bytes of file to S3 as contentType, returning the
+// public URL. Large files, videos mostly, go up in parts.
+func (s *S3ServiceImpl) UploadFile(ctx context.Context, file io.Reader, size int64, bucketName, objectKey, contentType string) (string, error) {
+	url, err := s.client.UploadObject(bucketName, objectKey, contentType, file, size)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file to S3: %w", err)
+	}
+	return url, nil
+}
+
+// DeleteImage removes an image previously returned by UploadImage. URLs that
+// don't point into our storage are ignored.
+func (s *S3ServiceImpl) DeleteImage(ctx context.Context, imageURL string) error {
+	bucketName, objectKey, ok := s.client.ObjectFromURL(imageURL)
+	if !ok {
+		return nil
+	}
+
+	if err := s.client.DeleteObject(bucketName, objectKey); err != nil {
+		return fmt.Errorf("failed to delete image from S3: %w", err)
+	}
+	return nil
+}
+
+// PresignUpload returns a URL the browser uploads an attachment to itself,
+// so the file never passes through the app.
+func (s *S3ServiceImpl) PresignUpload(ctx context.Context, bucketName, objectKey, contentType string, size int64) (string, error) {
+	// Presigned PUTs can't create the bucket
+	if err := s.client.CreateBucket(bucketName); err != nil {
+		return "", fmt.Errorf("failed to create bucket: %w", err)
+	}
+
+	url, err := s.client.PresignURL(http.MethodPut, bucketName, objectKey, contentType, size, s.presignTTL)
+	if errors.Is(err, s3.ErrPresignDisabled) {
+		return "", domain.ErrPresignDisabled
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to presign upload: %w", err)
+	}
+	return url, nil
+}
+
+// StatObject checks an object with a HEAD request.
+func (s *S3ServiceImpl) StatObject(ctx context.Context, bucketName, objectKey string) (*domain.StoredObject, error) {
+	info, err := s.client.StatObject(bucketName, objectKey)
+	if errors.Is(err, s3.ErrObjectNotFound) {
+		return nil, domain.ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	return &domain.StoredObject{
+		URL:         s.client.ObjectURL(bucketName, objectKey),
+		ContentType: info.ContentType,
+		Size:        info.Size,
+		Metadata:    info.Metadata,
+	}, nil
+}
+
+// ReadObjectHead reads the start of an object, enough to sniff its type.
+func (s *S3ServiceImpl) ReadObjectHead(ctx context.Context, bucketName, objectKey string, n int64) ([]byte, error) {
+	data, err := s.client.ReadObjectHead(bucketName, objectKey, n)
+	if errors.Is(err, s3.ErrObjectNotFound) {
+		return nil, domain.ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	return data, nil
+}
@@ -6,35 +6,41 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"time"
 )
 
 type UserService struct {
-	userRepo        domain.UserRepository
-	rickAndMortyAPI domain.RickAndMortyAPI
+	userRepo         domain.UserRepository
+	identityProvider domain.IdentityProvider
+	sessionTTL       time.Duration
 }
 
-func NewUserService(userRepo domain.UserRepository, api domain.RickAndMortyAPI) domain.UserService {
-	return &UserService{userRepo: userRepo, rickAndMortyAPI: api}
+func NewUserService(userRepo domain.UserRepository, identityProvider domain.IdentityProvider, sessionTTL time.Duration) domain.UserService {
+	return &UserService{userRepo: userRepo, identityProvider: identityProvider, sessionTTL: sessionTTL}
 }
 
+// GetOrCreateUser returns the user owning a live session token and slides its
+// expiry forward. Missing, unknown and expired tokens get a freshly issued one.
 func (s *UserService) GetOrCreateUser(ctx context.Context, sessionToken string) (*domain.User, bool, error) {
-	var isNew bool
-	if sessionToken == "" {
-		newSessionToken, err := s.generateSession()
-		isNew = true
-		if err != nil {
-			return nil, isNew, fmt.Errorf("failed to create new session token")
-		}
-		sessionToken = newSessionToken
-	} else {
+	if sessionToken != "" {
 		user, err := s.userRepo.FindBySessionToken(ctx, sessionToken)
 		if err == nil {
-			return user, isNew, nil
+			expiresAt := time.Now().Add(s.sessionTTL)
+			if err := s.userRepo.ExtendSession(ctx, user.ID, expiresAt); err != nil {
+				return nil, false, err
+			}
+			user.ExpiresAt = expiresAt
+			return user, false, nil
 		}
-		isNew = true
 	}
 
-	name, avatarURL, err := s.rickAndMortyAPI.GetRandomCharacter(ctx)
+	isNew := true
+	sessionToken, err := s.generateSession()
+	if err != nil {
+		return nil, isNew, fmt.Errorf("failed to create new session token")
+	}
+
+	name, avatarURL, err := s.identityProvider.GenerateIdentity(ctx)
 	if err != nil {
 		return nil, isNew, err
 	}
@@ -43,6 +49,7 @@ func (s *UserService) GetOrCreateUser(ctx context.Context, sessionToken string)
 		Name:         name,
 		AvatarURL:    avatarURL,
 		SessionToken: sessionToken,
+		ExpiresAt:    time.Now().Add(s.sessionTTL),
 	}
 	id, err := s.userRepo.Save(ctx, newUser)
 	if err != nil {
@@ -64,6 +71,10 @@ func (s *UserService) UpdateUserName(ctx context.Context, userID int, newName st
 	return s.userRepo.UpdateName(ctx, userID, newName)
 }
 
+func (s *UserService) PurgeExpiredSessions(ctx context.Context) (int64, error) {
+	return s.userRepo.DeleteExpired(ctx)
+}
+
 func (s *UserService) generateSession() (string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
@@ -3,19 +3,24 @@ package services
 import (
 	"1337b04rd/internal/domain"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"io"
+	"strings"
 	"testing"
+	"time"
 )
 
-type mockRickAndMortyAPI struct {
-	getRandomCharacterErr error
-	name                  string
-	avatarURL             string
+type mockIdentityProvider struct {
+	generateIdentityErr error
+	name                string
+	avatarURL           string
 }
 
-func (m *mockRickAndMortyAPI) GetRandomCharacter(ctx context.Context) (string, string, error) {
-	if m.getRandomCharacterErr != nil {
-		return "", "", m.getRandomCharacterErr
+func (m *mockIdentityProvider) GenerateIdentity(ctx context.Context) (string, string, error) {
+	if m.generateIdentityErr != nil {
+		return "", "", m.generateIdentityErr
 	}
 	return m.name, m.avatarURL, nil
 }
@@ -40,12 +45,12 @@ func TestUserService_GetOrCreateUser(t *testing.T) {
 			expectSessionGen: false,
 		},
 		{
-			name:             "new user with existing token",
+			name:             "new user with unknown token",
 			sessionToken:     "existing_token",
 			findByTokenErr:   errors.New("not found"),
 			expectedIsNew:    true,
 			expectedErr:      false,
-			expectSessionGen: false,
+			expectSessionGen: true,
 		},
 		{
 			name:             "new user with empty token",
@@ -61,7 +66,7 @@ func TestUserService_GetOrCreateUser(t *testing.T) {
 			apiErr:           errors.New("api error"),
 			expectedIsNew:    true,
 			expectedErr:      true,
-			expectSessionGen: false,
+			expectSessionGen: true,
 		},
 		{
 			name:             "save error",
@@ -70,7 +75,7 @@ func TestUserService_GetOrCreateUser(t *testing.T) {
 			saveErr:          errors.New("save error"),
 			expectedIsNew:    true,
 			expectedErr:      true,
-			expectSessionGen: false,
+			expectSessionGen: true,
 		},
 	}
 
@@ -80,13 +85,13 @@ func TestUserService_GetOrCreateUser(t *testing.T) {
 			userRepo.findByTokenErr = tt.findByTokenErr
 			userRepo.saveErr = tt.saveErr
 
-			api := &mockRickAndMortyAPI{
-				name:                  "Test User",
-				avatarURL:             "http://example.com/avatar.jpg",
-				getRandomCharacterErr: tt.apiErr,
+			api := &mockIdentityProvider{
+				name:                "Test User",
+				avatarURL:           "http://example.com/avatar.jpg",
+				generateIdentityErr: tt.apiErr,
 			}
 
-			service := NewUserService(userRepo, api)
+			service := NewUserService(userRepo, api, time.Hour)
 
 			// Pre-populate for existing user case
 			if tt.sessionToken != "" && tt.findByTokenErr == nil {
@@ -132,10 +137,71 @@ func TestUserService_GetOrCreateUser(t *testing.T) {
 			if user.AvatarURL == "" {
 				t.Error("expected avatar URL to be set")
 			}
+			if !user.ExpiresAt.After(time.Now()) {
+				t.Errorf("expected session expiry in the future, got %v", user.ExpiresAt)
+			}
 		})
 	}
 }
 
+func TestUserService_GetOrCreateUser_ExpiredSession(t *testing.T) {
+	userRepo := newMockUserRepo()
+	userRepo.Save(context.Background(), &domain.User{
+		SessionToken: "expired_token",
+		Name:         "Expired User",
+		AvatarURL:    "http://example.com/expired.jpg",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	})
+
+	service := NewUserService(userRepo, &mockIdentityProvider{name: "Fresh User", avatarURL: "http://example.com/fresh.jpg"}, time.Hour)
+	user, isNew, err := service.GetOrCreateUser(context.Background(), "expired_token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !isNew {
+		t.Error("expected expired session to be replaced with a new one")
+	}
+	if user.SessionToken == "expired_token" {
+		t.Error("expected a freshly issued session token")
+	}
+}
+
+func TestUserService_GetOrCreateUser_SlidingExpiry(t *testing.T) {
+	userRepo := newMockUserRepo()
+	userRepo.Save(context.Background(), &domain.User{
+		SessionToken: "live_token",
+		Name:         "Live User",
+		ExpiresAt:    time.Now().Add(time.Minute),
+	})
+
+	service := NewUserService(userRepo, &mockIdentityProvider{}, 24*time.Hour)
+	user, isNew, err := service.GetOrCreateUser(context.Background(), "live_token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if isNew {
+		t.Error("expected existing session to be reused")
+	}
+	if time.Until(user.ExpiresAt) < 23*time.Hour {
+		t.Errorf("expected expiry to slide forward, got %v", user.ExpiresAt)
+	}
+}
+
+func TestUserService_PurgeExpiredSessions(t *testing.T) {
+	userRepo := newMockUserRepo()
+	userRepo.Save(context.Background(), &domain.User{SessionToken: "old", ExpiresAt: time.Now().Add(-time.Hour)})
+	userRepo.Save(context.Background(), &domain.User{SessionToken: "new", ExpiresAt: time.Now().Add(time.Hour)})
+
+	service := NewUserService(userRepo, &mockIdentityProvider{}, time.Hour)
+	purged, err := service.PurgeExpiredSessions(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("expected 1 purged session, got %d", purged)
+	}
+}
+
 func TestUserService_GetUserByID(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -176,7 +242,7 @@ func TestUserService_GetUserByID(t *testing.T) {
 				userRepo.Save(context.Background(), &domain.User{ID: tt.userID})
 			}
 
-			service := NewUserService(userRepo, &mockRickAndMortyAPI{})
+			service := NewUserService(userRepo, &mockIdentityProvider{}, time.Hour)
 			_, err := service.GetUserByID(context.Background(), tt.userID)
 
 			if tt.expectedErr {
@@ -239,7 +305,7 @@ func TestUserService_UpdateUserName(t *testing.T) {
 				})
 			}
 
-			service := NewUserService(userRepo, &mockRickAndMortyAPI{})
+			service := NewUserService(userRepo, &mockIdentityProvider{}, time.Hour)
 			err := service.UpdateUserName(context.Background(), tt.userID, tt.newName)
 
 			if tt.expectedErr {
@@ -260,3 +326,183 @@ func TestUserService_UpdateUserName(t *testing.T) {
 		})
 	}
 }
+
+type mockS3Service struct {
+	uploads map[string][]byte
+	deleted []string
+	err     error
+}
+
+func (m *mockS3Service) UploadImage(ctx context.Context, fileData []byte, bucketName, objectKey string) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	if m.uploads == nil {
+		m.uploads = make(map[string][]byte)
+	}
+	m.uploads[bucketName+"/"+objectKey] = fileData
+	return "http://storage.local/" + bucketName + "/" + objectKey, nil
+}
+
+func (m *mockS3Service) UploadFile(ctx context.Context, file io.Reader, size int64, bucketName, objectKey, contentType string) (string, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	return m.UploadImage(ctx, data, bucketName, objectKey)
+}
+
+func (m *mockS3Service) DeleteImage(ctx context.Context, imageURL string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.deleted = append(m.deleted, imageURL)
+	return nil
+}
+
+func (m *mockS3Service) PresignUpload(ctx context.Context, bucketName, objectKey, contentType string, size int64) (string, error) {
+	return "", domain.ErrPresignDisabled
+}
+
+func (m *mockS3Service) StatObject(ctx context.Context, bucketName, objectKey string) (*domain.StoredObject, error) {
+	data, ok := m.uploads[bucketName+"/"+objectKey]
+	if !ok {
+		return nil, domain.ErrObjectNotFound
+	}
+	return &domain.StoredObject{URL: "http://storage.local/" + bucketName + "/" + objectKey, Size: int64(len(data))}, nil
+}
+
+func (m *mockS3Service) ReadObjectHead(ctx context.Context, bucketName, objectKey string, n int64) ([]byte, error) {
+	data, ok := m.uploads[bucketName+"/"+objectKey]
+	if !ok {
+		return nil, domain.ErrObjectNotFound
+	}
+	return data[:min(int64(len(data)), n)], nil
+}
+
+func TestAvatarMirror_GenerateIdentity(t *testing.T) {
+	fetch := func(ctx context.Context, url string) ([]byte, error) {
+		return []byte("image"), nil
+	}
+
+	tests := []struct {
+		name        string
+		avatarURL   string
+		s3Err       error
+		expectedURL string
+	}{
+		{
+			name:        "remote avatar is mirrored",
+			avatarURL:   "https://rickandmortyapi.com/api/character/avatar/1.jpeg",
+			expectedURL: "http://storage.local/avatars/" + mirroredName("https://rickandmortyapi.com/api/character/avatar/1.jpeg") + ".jpeg",
+		},
+		{
+			name:        "local avatar is left alone",
+			avatarURL:   "/avatars/abc.png",
+			expectedURL: "/avatars/abc.png",
+		},
+		{
+			name:        "already mirrored avatar is left alone",
+			avatarURL:   "http://storage.local/avatars/2.jpeg",
+			expectedURL: "http://storage.local/avatars/2.jpeg",
+		},
+		{
+			name:        "upload failure falls back to an identicon",
+			avatarURL:   "https://rickandmortyapi.com/api/character/avatar/3.jpeg",
+			s3Err:       errors.New("storage down"),
+			expectedURL: FallbackAvatarURL("https://rickandmortyapi.com/api/character/avatar/3.jpeg"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &mockIdentityProvider{name: "Rick", avatarURL: tt.avatarURL}
+			mirror := NewAvatarMirror(api, &mockS3Service{err: tt.s3Err}, fetch, "http://storage.local")
+
+			_, avatarURL, err := mirror.GenerateIdentity(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if avatarURL != tt.expectedURL {
+				t.Errorf("expected avatar URL %s, got %s", tt.expectedURL, avatarURL)
+			}
+		})
+	}
+}
+
+// mirroredName is the object name of a mirrored avatar without its
+// extension.
+func mirroredName(sourceURL string) string {
+	sum := sha256.Sum256([]byte(sourceURL))
+	return hex.EncodeToString(sum[:8])
+}
+
+func TestAvatarMirror_ObjectKeys(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n")
+	images := map[string][]byte{
+		"https://a.example/x/avatar.png":         []byte("first"),
+		"https://b.example/y/avatar.png":         []byte("second"),
+		"https://gravatar.example/avatar/ab12cd": png,
+	}
+	fetch := func(ctx context.Context, url string) ([]byte, error) {
+		return images[url], nil
+	}
+	s3 := &mockS3Service{}
+	mirror := NewAvatarMirror(nil, s3, fetch, "http://storage.local")
+
+	for source, data := range images {
+		mirrored, err := mirror.Mirror(context.Background(), source)
+		if err != nil {
+			t.Fatalf("Mirror(%s): %v", source, err)
+		}
+		key := strings.TrimPrefix(mirrored, "http://storage.local/")
+		if string(s3.uploads[key]) != string(data) {
+			t.Errorf("Mirror(%s) stored %q at %s, want %q", source, s3.uploads[key], key, data)
+		}
+	}
+	if len(s3.uploads) != len(images) {
+		t.Errorf("expected %d avatars, got %d: avatars sharing a file name collided", len(images), len(s3.uploads))
+	}
+
+	// A URL without extension is named after the sniffed format.
+	if want := "avatars/" + mirroredName("https://gravatar.example/avatar/ab12cd") + ".png"; s3.uploads[want] == nil {
+		t.Errorf("extensionless avatar not stored as %s", want)
+	}
+	if _, err := mirror.Mirror(context.Background(), "https://c.example/avatar"); err == nil {
+		t.Error("expected an avatar of unknown format to fail")
+	}
+}
+
+func TestFallbackAvatarURL(t *testing.T) {
+	source := "https://rickandmortyapi.com/api/character/avatar/3.jpeg"
+	fallback := FallbackAvatarURL(source)
+	if !strings.HasPrefix(fallback, "/avatars/") || strings.Contains(fallback, "://") {
+		t.Errorf("fallback %s is not a local identicon", fallback)
+	}
+	if got, ok := PendingAvatarSource(fallback); !ok || got != source {
+		t.Errorf("PendingAvatarSource(%s) = %s, %v; want %s", fallback, got, ok, source)
+	}
+	for _, avatarURL := range []string{"/avatars/abc.png", "http://storage.local/avatars/1.jpeg", source} {
+		if _, ok := PendingAvatarSource(avatarURL); ok {
+			t.Errorf("PendingAvatarSource(%s) reports a pending source", avatarURL)
+		}
+	}
+}
+
+func TestAvatarMirror_FetchesOnce(t *testing.T) {
+	fetches := 0
+	fetch := func(ctx context.Context, url string) ([]byte, error) {
+		fetches++
+		return []byte("image"), nil
+	}
+	mirror := NewAvatarMirror(nil, &mockS3Service{}, fetch, "http://storage.local")
+
+	for i := 0; i < 3; i++ {
+		if _, err := mirror.Mirror(context.Background(), "https://rickandmortyapi.com/api/character/avatar/1.jpeg"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("expected avatar to be fetched once, got %d", fetches)
+	}
+}
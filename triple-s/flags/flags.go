@@ -5,16 +5,31 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 )
 
 var (
-	Port int
-	Dir  string
+	Port            int
+	Dir             string
+	Metadata        string
+	CompactInterval time.Duration
+	ScrubInterval   time.Duration
+	AdminToken      string
+	MultipartTTL    time.Duration
+	PresignSecret   string
+	CORSOrigin      string
 )
 
 func ParseFlags() error {
 	flag.IntVar(&Port, "port", 8080, "Port to serve one")
 	flag.StringVar(&Dir, "dir", "./data", "The directory of files to host")
+	flag.StringVar(&Metadata, "metadata", "csv", "Object metadata store: csv or log")
+	flag.DurationVar(&CompactInterval, "compact-interval", 10*time.Minute, "How often the log metadata store is compacted")
+	flag.DurationVar(&ScrubInterval, "scrub-interval", 0, "How often objects are verified in the background, 0 disables")
+	flag.StringVar(&AdminToken, "admin-token", "", "Bearer token for the /_admin endpoints, empty disables them")
+	flag.DurationVar(&MultipartTTL, "multipart-ttl", 24*time.Hour, "How long unfinished multipart uploads are kept, 0 keeps them forever")
+	flag.StringVar(&PresignSecret, "presign-secret", "", "HMAC secret of presigned URLs, writes must be signed once it is set")
+	flag.StringVar(&CORSOrigin, "cors-origin", "", "Origin allowed to call the API from a browser, empty disables CORS")
 	flag.Usage = PrintHelp
 
 	flag.Parse()
@@ -34,21 +49,68 @@ func ParseFlags() error {
 		}
 	}
 
+	if Metadata != "csv" && Metadata != "log" {
+		log.Fatalf("Invalid metadata store %q, use csv or log", Metadata)
+	}
+
 	log.Printf("Serving files from directory: %s", Dir)
 	log.Printf("Listening port on: %d", Port)
 
 	return nil
 }
 
+// ParseMigrateFlags reads the arguments of the migrate subcommand.
+func ParseMigrateFlags(args []string) (from, to string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.StringVar(&Dir, "dir", "./data", "The directory of files to host")
+	fs.StringVar(&from, "from", "csv", "Metadata store to read: csv or log")
+	fs.StringVar(&to, "to", "log", "Metadata store to write: csv or log")
+	fs.Usage = PrintHelp
+	fs.Parse(args)
+
+	if from == to {
+		log.Fatalf("Nothing to migrate: -from and -to are both %s", from)
+	}
+	return from, to
+}
+
+// ParseScrubFlags reads the arguments of the scrub subcommand.
+func ParseScrubFlags(args []string) (repair bool) {
+	fs := flag.NewFlagSet("scrub", flag.ExitOnError)
+	fs.StringVar(&Dir, "dir", "./data", "The directory of files to host")
+	fs.StringVar(&Metadata, "metadata", "csv", "Object metadata store: csv or log")
+	fs.BoolVar(&repair, "repair", false, "Fix metadata drift instead of only reporting it")
+	fs.Usage = PrintHelp
+	fs.Parse(args)
+	return repair
+}
+
 func PrintHelp() {
 	fmt.Println(`Simple Storage Service.
 
 	**Usage:**
-		triple-s [-port <N>] [-dir <S>]  
+		triple-s [-port <N>] [-dir <S>] [-metadata <csv|log>] [-compact-interval <D>]
+		         [-scrub-interval <D>] [-admin-token <T>] [-multipart-ttl <D>]
+		         [-presign-secret <K>] [-cors-origin <O>]
+		triple-s migrate [-dir <S>] [-from <csv|log>] [-to <csv|log>]
+		triple-s scrub [-dir <S>] [-metadata <csv|log>] [-repair]
 		triple-s --help
 	
 	**Options:**
-	- --help     Show this screen.
-	- --port N   Port number
-	- --dir S    Path to the directory`)
+	- --help                 Show this screen.
+	- --port N               Port number
+	- --dir S                Path to the directory
+	- --metadata M           Object metadata store, csv (default) or log
+	- --compact-interval D   How often the log store is compacted (default 10m)
+	- --scrub-interval D     How often objects are verified in the background (default off)
+	- --admin-token T        Bearer token for the /_admin endpoints (default off)
+	- --multipart-ttl D      How long unfinished multipart uploads are kept (default 24h)
+	- --presign-secret K     HMAC secret of presigned URLs, writes must be signed (default off)
+	- --cors-origin O        Origin allowed to call the API from a browser (default off)
+
+	**Commands:**
+	- migrate                Copy object metadata between stores, offline.
+	                         The server must not run on the same directory.
+	- scrub                  Verify every object and report drift, offline.
+	                         Exits with status 1 if unrepaired issues remain.`)
 }
@@ -6,7 +6,7 @@ const DefaultDir = "data"
 
 var (
 	BucketsHeader = []string{"Name", "CreationTime", "LastModifiedTime", "Status"}
-	ObjectsHeader = []string{"ObjectKey", "ContentType", "Size", "LastModified"}
+	ObjectsHeader = []string{"ObjectKey", "ContentType", "Size", "LastModified", "ETag", "Metadata", "SHA256"}
 )
 
 type Bucket struct {
@@ -23,11 +23,14 @@ type Buckets struct {
 }
 
 type Object struct {
-	XMLName      xml.Name `xml:"object"`
-	ObjectKey    string   `xml:"objectKey"`
-	ContentType  string   `xml:"contentType"`
-	Size         string   `xml:"size"`
-	LastModified string   `xml:"lastModified"`
+	XMLName      xml.Name `xml:"object" json:"-"`
+	ObjectKey    string   `xml:"objectKey" json:"key"`
+	ContentType  string   `xml:"contentType" json:"contentType"`
+	Size         string   `xml:"size" json:"size"`
+	LastModified string   `xml:"lastModified" json:"lastModified"`
+	ETag         string   `xml:"eTag,omitempty" json:"etag,omitempty"`
+	Metadata     string   `xml:"-" json:"metadata,omitempty"` // x-amz-meta-* headers, URL query encoded
+	SHA256       string   `xml:"-" json:"sha256,omitempty"`   // hex, like ETag
 }
 
 type Objects struct {
@@ -35,7 +38,85 @@ type Objects struct {
 	Objects []Object `xml:"object"`
 }
 
+// ListBucketResult is the S3 ListObjectsV2 response.
+type ListBucketResult struct {
+	XMLName               xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	Contents              []ListContents `xml:"Contents"`
+	CommonPrefixes        []CommonPrefix `xml:"CommonPrefixes"`
+}
+
+type ListContents struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag,omitempty"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// Multipart upload messages, shaped like their S3 counterparts.
+type InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type ListPartsResult struct {
+	XMLName     xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListPartsResult"`
+	Bucket      string   `xml:"Bucket"`
+	Key         string   `xml:"Key"`
+	UploadID    string   `xml:"UploadId"`
+	IsTruncated bool     `xml:"IsTruncated"`
+	Parts       []Part   `xml:"Part"`
+}
+
+type Part struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+}
+
+// CompleteMultipartUpload is the request body naming the parts to join.
+type CompleteMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []CompletedPart `xml:"Part"`
+}
+
+type CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type CompleteMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
 type ErrResp struct {
 	Code    int    `xml:"Code"`
 	Message string `xml:"Message"`
 }
+
+// S3Error is the error body of S3, Code names the error, e.g. BadDigest.
+type S3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
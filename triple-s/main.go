@@ -4,18 +4,47 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"triple-s/flags"
 	"triple-s/routes"
 	"triple-s/storage"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			migrate(os.Args[2:])
+			return
+		case "scrub":
+			scrub(os.Args[2:])
+			return
+		}
+	}
+
 	flags.ParseFlags()
 	err := storage.InitDir()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	storage.Metadata, err = storage.OpenMetadataStore(flags.Metadata, flags.CompactInterval)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if moved, err := storage.MigrateLayout(); err != nil {
+		log.Fatal(err)
+	} else if moved > 0 {
+		log.Printf("Moved %d objects to the sharded layout", moved)
+	}
+
+	if flags.ScrubInterval > 0 {
+		storage.StartScrubWorker(flags.ScrubInterval)
+	}
+	if flags.MultipartTTL > 0 {
+		storage.StartMultipartCleaner(flags.MultipartTTL)
+	}
+
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", flags.Port),
 		Handler: routes.Routes(),
@@ -23,7 +52,63 @@ func main() {
 
 	log.Printf("Starting the server on http://localhost:%d", flags.Port)
 	log.Printf("Data directory: %s", flags.Dir)
+	log.Printf("Metadata store: %s", flags.Metadata)
 
 	err = server.ListenAndServe()
 	log.Fatal(err)
 }
+
+func migrate(args []string) {
+	from, to := flags.ParseMigrateFlags(args)
+
+	src, err := storage.OpenMetadataStore(from, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer src.Close()
+
+	dst, err := storage.OpenMetadataStore(to, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	migrated, err := storage.MigrateMetadata(src, dst)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Fatalf("Migration failed after %d objects: %v", migrated, err)
+	}
+	log.Printf("Migrated %d objects from %s to %s metadata in %s", migrated, from, to, flags.Dir)
+}
+
+func scrub(args []string) {
+	repair := flags.ParseScrubFlags(args)
+
+	var err error
+	storage.Metadata, err = storage.OpenMetadataStore(flags.Metadata, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report, err := storage.Scrub(repair)
+	if closeErr := storage.Metadata.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Fatalf("Scrub failed: %v", err)
+	}
+
+	for _, issue := range report.Issues {
+		status := ""
+		if issue.Repaired {
+			status = " (repaired)"
+		}
+		fmt.Printf("%s\t%s/%s%s\t%s%s\n", issue.Problem, issue.Bucket, issue.ObjectKey, issue.Path, issue.Detail, status)
+	}
+	fmt.Printf("Scrubbed %d buckets, %d objects: %d issues, %d unrepaired\n", report.Buckets, report.Objects, len(report.Issues), report.Unrepaired())
+
+	if report.Unrepaired() > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,97 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"triple-s/info"
+	"triple-s/utils"
+)
+
+const csvFile = "objects.csv"
+
+// CSVStore keeps metadata in <bucket>/objects.csv. Every call reads the
+// whole file, which is simple and easy to inspect but O(n) per lookup.
+type CSVStore struct{}
+
+func NewCSVStore() *CSVStore {
+	return &CSVStore{}
+}
+
+func (s *CSVStore) InitBucket(bucketPath string) error {
+	path := filepath.Join(bucketPath, csvFile)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	return utils.WriteCSV(path, info.ObjectsHeader, nil)
+}
+
+func (s *CSVStore) Get(bucketPath, objectKey string) (info.Object, error) {
+	objects, err := utils.ReadObjects(bucketPath)
+	if err != nil {
+		return info.Object{}, err
+	}
+	objectIDX := indexOf(objects.Objects, objectKey)
+	if objectIDX == -1 {
+		return info.Object{}, ErrNotFound
+	}
+	return objects.Objects[objectIDX], nil
+}
+
+func (s *CSVStore) List(bucketPath string) ([]info.Object, error) {
+	objects, err := utils.ReadObjects(bucketPath)
+	if err != nil {
+		return nil, err
+	}
+	return objects.Objects, nil
+}
+
+func (s *CSVStore) Update(bucketPath, objectKey string, fn UpdateFunc) error {
+	unlock := s.lock(bucketPath)
+	defer unlock()
+
+	objects, err := utils.ReadObjects(bucketPath)
+	if err != nil {
+		return err
+	}
+
+	var current *info.Object
+	objectIDX := indexOf(objects.Objects, objectKey)
+	if objectIDX != -1 {
+		existing := objects.Objects[objectIDX]
+		current = &existing
+	}
+
+	updated, err := fn(current)
+	if err != nil {
+		return err
+	}
+
+	// A replaced entry moves to the end, like a fresh upload always did.
+	if objectIDX != -1 {
+		objects.Objects = append(objects.Objects[:objectIDX], objects.Objects[objectIDX+1:]...)
+	}
+	if updated != nil {
+		objects.Objects = append(objects.Objects, *updated)
+	}
+	return utils.WriteObject(bucketPath, objects)
+}
+
+func (s *CSVStore) RemoveBucket(bucketPath string, fn RemoveFunc) error {
+	unlock := s.lock(bucketPath)
+	defer unlock()
+
+	objects, err := utils.ReadObjects(bucketPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	_, err = fn(objects.Objects)
+	return err
+}
+
+func (s *CSVStore) Close() error {
+	return nil
+}
+
+func (s *CSVStore) lock(bucketPath string) (unlock func()) {
+	return utils.LockFile(filepath.Join(bucketPath, csvFile))
+}
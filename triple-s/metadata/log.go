@@ -0,0 +1,404 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"triple-s/info"
+	"triple-s/utils"
+)
+
+const logFile = "objects.log"
+
+// logRecord is one line of objects.log. A put carries the whole entry, a
+// delete only the key.
+type logRecord struct {
+	Op     string       `json:"op"`
+	Key    string       `json:"key,omitempty"`
+	Object *info.Object `json:"object,omitempty"`
+}
+
+const (
+	opPut    = "put"
+	opDelete = "del"
+)
+
+// LogStore appends every change of a bucket to <bucket>/objects.log and
+// keeps the live entries in memory, so lookups don't touch the disk. The
+// log is replayed when a bucket is first used and compacted periodically,
+// dropping overwritten and deleted entries.
+type LogStore struct {
+	mu      sync.Mutex
+	buckets map[string]*logBucket
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// logHandle is the open objects.log, an *os.File outside of tests.
+type logHandle interface {
+	io.ReadWriteSeeker
+	io.Closer
+	Truncate(size int64) error
+	Sync() error
+}
+
+type logBucket struct {
+	mu      sync.RWMutex
+	path    string
+	file    logHandle
+	objects map[string]info.Object
+	records int  // lines in the log, superseded ones included
+	removed bool // set once RemoveBucket dropped it
+}
+
+// NewLogStore starts a store compacting its buckets every compactInterval;
+// zero disables the background compaction.
+func NewLogStore(compactInterval time.Duration) *LogStore {
+	s := &LogStore{
+		buckets: make(map[string]*logBucket),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.compactLoop(compactInterval)
+	return s
+}
+
+func (s *LogStore) InitBucket(bucketPath string) error {
+	_, err := s.bucket(bucketPath)
+	return err
+}
+
+func (s *LogStore) Get(bucketPath, objectKey string) (info.Object, error) {
+	b, err := s.bucket(bucketPath)
+	if err != nil {
+		return info.Object{}, err
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	object, ok := b.objects[objectKey]
+	if !ok {
+		return info.Object{}, ErrNotFound
+	}
+	return object, nil
+}
+
+// List returns the entries sorted by key.
+func (s *LogStore) List(bucketPath string) ([]info.Object, error) {
+	b, err := s.bucket(bucketPath)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.sorted(), nil
+}
+
+func (s *LogStore) Update(bucketPath, objectKey string, fn UpdateFunc) error {
+	b, err := s.bucket(bucketPath)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// The bucket can be removed while this call waited for the lock.
+	if b.removed {
+		return fmt.Errorf("bucket %s: %w", bucketPath, fs.ErrNotExist)
+	}
+
+	var current *info.Object
+	if existing, ok := b.objects[objectKey]; ok {
+		current = &existing
+	}
+
+	updated, err := fn(current)
+	if err != nil {
+		return err
+	}
+
+	record := logRecord{Op: opDelete, Key: objectKey}
+	if updated != nil {
+		record = logRecord{Op: opPut, Object: updated}
+	} else if current == nil {
+		return nil
+	}
+	if err := b.append(record); err != nil {
+		return err
+	}
+
+	if updated != nil {
+		b.objects[objectKey] = *updated
+	} else {
+		delete(b.objects, objectKey)
+	}
+	return nil
+}
+
+func (s *LogStore) RemoveBucket(bucketPath string, fn RemoveFunc) error {
+	b, err := s.bucket(bucketPath)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	removed, err := fn(b.sorted())
+	if err != nil || !removed {
+		return err
+	}
+
+	b.removed = true
+	b.file.Close()
+
+	s.mu.Lock()
+	delete(s.buckets, filepath.Clean(bucketPath))
+	s.mu.Unlock()
+	return nil
+}
+
+// Close stops the compaction, compacts every bucket one last time so the
+// next start replays short logs, and closes the files.
+func (s *LogStore) Close() error {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, b := range s.buckets {
+		b.mu.Lock()
+		if err := b.compact(); err != nil {
+			errs = append(errs, err)
+		}
+		b.file.Close()
+		b.removed = true
+		b.mu.Unlock()
+	}
+	s.buckets = make(map[string]*logBucket)
+	return errors.Join(errs...)
+}
+
+// Compact rewrites every bucket log that holds superseded records.
+func (s *LogStore) Compact() error {
+	s.mu.Lock()
+	buckets := make([]*logBucket, 0, len(s.buckets))
+	for _, b := range s.buckets {
+		buckets = append(buckets, b)
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, b := range buckets {
+		b.mu.Lock()
+		if !b.removed && b.records > len(b.objects) {
+			if err := b.compact(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		b.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+func (s *LogStore) compactLoop(interval time.Duration) {
+	defer close(s.done)
+	if interval <= 0 {
+		<-s.stop
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Compact(); err != nil {
+				log.Printf("Failed to compact metadata logs: %v\n", err)
+			}
+		}
+	}
+}
+
+// bucket returns the loaded bucket, replaying its log on first use.
+func (s *LogStore) bucket(bucketPath string) (*logBucket, error) {
+	bucketPath = filepath.Clean(bucketPath)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.buckets[bucketPath]; ok {
+		return b, nil
+	}
+	b, err := openLogBucket(bucketPath)
+	if err != nil {
+		return nil, err
+	}
+	s.buckets[bucketPath] = b
+	return b, nil
+}
+
+func openLogBucket(bucketPath string) (*logBucket, error) {
+	path := filepath.Join(bucketPath, logFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &logBucket{path: path, file: file, objects: make(map[string]info.Object)}
+	if err := b.replay(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to replay %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// replay rebuilds the index from the log. A last line without its newline
+// is an append cut short by a crash and is truncated away; a broken line in
+// the middle of the log is corruption and fails the load.
+func (b *logBucket) replay() error {
+	reader := bufio.NewReader(b.file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				log.Printf("Truncating partial record at offset %d of %s\n", offset, b.path)
+				if err := b.file.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var record logRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &record); err != nil {
+			return fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+		b.apply(record)
+		offset += int64(len(line))
+	}
+
+	_, err := b.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (b *logBucket) apply(record logRecord) {
+	b.records++
+	switch record.Op {
+	case opPut:
+		if record.Object != nil {
+			b.objects[record.Object.ObjectKey] = *record.Object
+		}
+	case opDelete:
+		delete(b.objects, record.Key)
+	}
+}
+
+// append writes one record and syncs it before the caller updates the index.
+// A failed write or sync is cut off the log again: later appends would land
+// behind the partial line, and replay refuses a broken line mid-log.
+func (b *logBucket) append(record logRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	offset, err := b.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.file.Write(append(line, '\n'))
+	if err == nil {
+		err = b.file.Sync()
+	}
+	if err != nil {
+		if truncErr := b.rewind(offset); truncErr != nil {
+			log.Printf("Failed to cut failed append off %s: %v\n", b.path, truncErr)
+		}
+		return err
+	}
+	b.records++
+	return nil
+}
+
+// rewind truncates the log back to offset and continues appending there.
+func (b *logBucket) rewind(offset int64) error {
+	if err := b.file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := b.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// compact replaces the log with one put per live entry, through a synced
+// temporary file and a rename so a crash keeps either log intact.
+func (b *logBucket) compact() error {
+	dir := filepath.Dir(b.path)
+	tmp, err := os.CreateTemp(dir, "."+logFile+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	objects := b.sorted()
+	for i := range objects {
+		if err := encoder.Encode(logRecord{Op: opPut, Object: &objects[i]}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), b.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := utils.SyncDir(dir); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	// The renamed temporary file is the log now; keep appending to it.
+	if _, err := tmp.Seek(0, io.SeekEnd); err != nil {
+		tmp.Close()
+		return err
+	}
+	b.file.Close()
+	b.file = tmp
+	b.records = len(objects)
+	return nil
+}
+
+func (b *logBucket) sorted() []info.Object {
+	objects := make([]info.Object, 0, len(b.objects))
+	for _, object := range b.objects {
+		objects = append(objects, object)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].ObjectKey < objects[j].ObjectKey })
+	return objects
+}
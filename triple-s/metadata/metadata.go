@@ -0,0 +1,30 @@
+// Package metadata keeps the object metadata of triple-s buckets. The CSV
+// store is the original objects.csv format; the log store appends every
+// change to objects.log and answers lookups from an in-memory index.
+package metadata
+
+import (
+	"errors"
+	"triple-s/info"
+)
+
+var ErrNotFound = errors.New("object metadata not found")
+
+// UpdateFunc receives the current entry of a key, nil when there is none,
+// and returns the entry to store, nil to delete it. It runs under the
+// bucket lock, so file moves that must agree with the metadata go in it.
+// Returning an error leaves the metadata untouched.
+type UpdateFunc func(current *info.Object) (*info.Object, error)
+
+// RemoveFunc runs under the bucket lock with the current objects and
+// reports whether the bucket is gone, after which the store forgets it.
+type RemoveFunc func(objects []info.Object) (removed bool, err error)
+
+func indexOf(objects []info.Object, key string) int {
+	for i, object := range objects {
+		if object.ObjectKey == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,316 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"triple-s/info"
+)
+
+type store interface {
+	InitBucket(bucketPath string) error
+	Get(bucketPath, objectKey string) (info.Object, error)
+	List(bucketPath string) ([]info.Object, error)
+	Update(bucketPath, objectKey string, fn UpdateFunc) error
+	RemoveBucket(bucketPath string, fn RemoveFunc) error
+	Close() error
+}
+
+func forEachStore(t *testing.T, test func(t *testing.T, s store, bucketPath string)) {
+	stores := map[string]func() store{
+		"csv": func() store { return NewCSVStore() },
+		"log": func() store { return NewLogStore(0) },
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			bucketPath := filepath.Join(t.TempDir(), "bucket")
+			if err := os.Mkdir(bucketPath, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			s := open()
+			defer s.Close()
+			if err := s.InitBucket(bucketPath); err != nil {
+				t.Fatalf("InitBucket: %v", err)
+			}
+			test(t, s, bucketPath)
+		})
+	}
+}
+
+func put(t *testing.T, s store, bucketPath string, object info.Object) {
+	t.Helper()
+	err := s.Update(bucketPath, object.ObjectKey, func(*info.Object) (*info.Object, error) {
+		return &object, nil
+	})
+	if err != nil {
+		t.Fatalf("put %s: %v", object.ObjectKey, err)
+	}
+}
+
+func TestStore_CRUD(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store, bucketPath string) {
+		if _, err := s.Get(bucketPath, "a.txt"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get on empty bucket: %v, want ErrNotFound", err)
+		}
+
+		put(t, s, bucketPath, info.Object{ObjectKey: "b.txt", ContentType: "text/plain", Size: "1", ETag: "b1"})
+		put(t, s, bucketPath, info.Object{ObjectKey: "a.txt", ContentType: "text/plain", Size: "2", ETag: "a1"})
+		put(t, s, bucketPath, info.Object{ObjectKey: "b.txt", ContentType: "text/plain", Size: "3", ETag: "b2", Metadata: "author=anon"})
+
+		object, err := s.Get(bucketPath, "b.txt")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if object.ETag != "b2" || object.Size != "3" || object.Metadata != "author=anon" {
+			t.Errorf("Get returned %+v, want the overwritten entry", object)
+		}
+
+		objects, err := s.List(bucketPath)
+		if err != nil || len(objects) != 2 {
+			t.Fatalf("List = %v, %v; want 2 objects", objects, err)
+		}
+
+		err = s.Update(bucketPath, "a.txt", func(current *info.Object) (*info.Object, error) {
+			if current == nil || current.ETag != "a1" {
+				t.Errorf("current = %+v, want a.txt", current)
+			}
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if _, err := s.Get(bucketPath, "a.txt"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleted object still found: %v", err)
+		}
+	})
+}
+
+func TestStore_UpdateErrorKeepsMetadata(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store, bucketPath string) {
+		put(t, s, bucketPath, info.Object{ObjectKey: "a.txt", ETag: "a1"})
+
+		boom := errors.New("boom")
+		err := s.Update(bucketPath, "a.txt", func(*info.Object) (*info.Object, error) {
+			return nil, boom
+		})
+		if !errors.Is(err, boom) {
+			t.Fatalf("Update error = %v, want boom", err)
+		}
+		if object, err := s.Get(bucketPath, "a.txt"); err != nil || object.ETag != "a1" {
+			t.Errorf("Get = %+v, %v; want the untouched entry", object, err)
+		}
+	})
+}
+
+func TestStore_ConcurrentUpdates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store, bucketPath string) {
+		var wg sync.WaitGroup
+		for i := 0; i < 200; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				key := fmt.Sprintf("object-%03d", i)
+				err := s.Update(bucketPath, key, func(*info.Object) (*info.Object, error) {
+					return &info.Object{ObjectKey: key}, nil
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		objects, err := s.List(bucketPath)
+		if err != nil || len(objects) != 200 {
+			t.Errorf("List returned %d objects, %v; want 200", len(objects), err)
+		}
+	})
+}
+
+func TestStore_RemoveBucket(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s store, bucketPath string) {
+		put(t, s, bucketPath, info.Object{ObjectKey: "a.txt"})
+
+		err := s.RemoveBucket(bucketPath, func(objects []info.Object) (bool, error) {
+			if len(objects) != 1 {
+				t.Errorf("RemoveBucket saw %d objects, want 1", len(objects))
+			}
+			return true, os.RemoveAll(bucketPath)
+		})
+		if err != nil {
+			t.Fatalf("RemoveBucket: %v", err)
+		}
+
+		err = s.Update(bucketPath, "b.txt", func(*info.Object) (*info.Object, error) {
+			return &info.Object{ObjectKey: "b.txt"}, nil
+		})
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Update on removed bucket: %v, want ErrNotExist", err)
+		}
+	})
+}
+
+func TestLogStore_Replay(t *testing.T) {
+	bucketPath := t.TempDir()
+
+	s := NewLogStore(0)
+	put(t, s, bucketPath, info.Object{ObjectKey: "a.txt", ETag: "a1"})
+	put(t, s, bucketPath, info.Object{ObjectKey: "b.txt", ETag: "b1"})
+	put(t, s, bucketPath, info.Object{ObjectKey: "a.txt", ETag: "a2"})
+	err := s.Update(bucketPath, "b.txt", func(*info.Object) (*info.Object, error) { return nil, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash: no Close, so no final compaction.
+	reopened := NewLogStore(0)
+	defer reopened.Close()
+
+	objects, err := reopened.List(bucketPath)
+	if err != nil {
+		t.Fatalf("List after replay: %v", err)
+	}
+	if len(objects) != 1 || objects[0].ObjectKey != "a.txt" || objects[0].ETag != "a2" {
+		t.Errorf("replayed %+v, want only a.txt with ETag a2", objects)
+	}
+}
+
+func TestLogStore_TruncatedTail(t *testing.T) {
+	bucketPath := t.TempDir()
+	path := filepath.Join(bucketPath, logFile)
+
+	log := `{"op":"put","object":{"key":"a.txt","etag":"a1"}}` + "\n" +
+		`{"op":"put","object":{"key":"b.t` // cut short mid-append
+	if err := os.WriteFile(path, []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewLogStore(0)
+	defer s.Close()
+
+	objects, err := s.List(bucketPath)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(objects) != 1 || objects[0].ObjectKey != "a.txt" {
+		t.Fatalf("objects = %+v, want only a.txt", objects)
+	}
+
+	// New appends must start on a clean line.
+	put(t, s, bucketPath, info.Object{ObjectKey: "c.txt"})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "b.t") || strings.Count(string(data), "\n") != 2 {
+		t.Errorf("log after recovery:\n%s", data)
+	}
+}
+
+// shortWriter writes half of the next record and fails, like a full disk.
+type shortWriter struct {
+	logHandle
+	fail bool
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if !w.fail {
+		return w.logHandle.Write(p)
+	}
+	w.fail = false
+	n, _ := w.logHandle.Write(p[:len(p)/2])
+	return n, errors.New("no space left on device")
+}
+
+func TestLogStore_FailedAppend(t *testing.T) {
+	bucketPath := t.TempDir()
+	s := NewLogStore(0)
+	put(t, s, bucketPath, info.Object{ObjectKey: "a.txt"})
+
+	b, err := s.bucket(bucketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.file = &shortWriter{logHandle: b.file, fail: true}
+
+	err = s.Update(bucketPath, "b.txt", func(*info.Object) (*info.Object, error) {
+		return &info.Object{ObjectKey: "b.txt"}, nil
+	})
+	if err == nil {
+		t.Fatal("Update succeeded with a failing write")
+	}
+	put(t, s, bucketPath, info.Object{ObjectKey: "c.txt"})
+	defer s.Close()
+
+	// The partial record is gone, so the log loads after a crash, before
+	// Close compacted it.
+	reopened := NewLogStore(0)
+	defer reopened.Close()
+	objects, err := reopened.List(bucketPath)
+	if err != nil {
+		t.Fatalf("List after a failed append: %v", err)
+	}
+	if len(objects) != 2 || objects[0].ObjectKey != "a.txt" || objects[1].ObjectKey != "c.txt" {
+		t.Errorf("objects = %+v, want a.txt and c.txt", objects)
+	}
+}
+
+func TestLogStore_CorruptRecord(t *testing.T) {
+	bucketPath := t.TempDir()
+	log := "not json\n" + `{"op":"put","object":{"key":"a.txt"}}` + "\n"
+	if err := os.WriteFile(filepath.Join(bucketPath, logFile), []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewLogStore(0)
+	defer s.Close()
+	if _, err := s.List(bucketPath); err == nil {
+		t.Error("expected a corrupt record in the middle of the log to fail the load")
+	}
+}
+
+func TestLogStore_Compact(t *testing.T) {
+	bucketPath := t.TempDir()
+	path := filepath.Join(bucketPath, logFile)
+
+	s := NewLogStore(0)
+	for i := 0; i < 50; i++ {
+		put(t, s, bucketPath, info.Object{ObjectKey: "hot.txt", ETag: fmt.Sprint(i)})
+	}
+	put(t, s, bucketPath, info.Object{ObjectKey: "cold.txt"})
+
+	before, _ := os.Stat(path)
+	if err := s.Compact(); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("log grew from %d to %d bytes", before.Size(), after.Size())
+	}
+
+	// Appends after compaction land in the new log.
+	put(t, s, bucketPath, info.Object{ObjectKey: "new.txt"})
+	s.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("compacted log has %d records, want 3:\n%s", lines, data)
+	}
+
+	reopened := NewLogStore(0)
+	defer reopened.Close()
+	object, err := reopened.Get(bucketPath, "hot.txt")
+	if err != nil || object.ETag != "49" {
+		t.Errorf("Get(hot.txt) = %+v, %v; want ETag 49", object, err)
+	}
+	if _, err := reopened.Get(bucketPath, "new.txt"); err != nil {
+		t.Errorf("Get(new.txt): %v", err)
+	}
+}
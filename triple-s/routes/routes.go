@@ -2,21 +2,45 @@ package routes
 
 import (
 	"net/http"
+	"strings"
 	"triple-s/storage"
 )
 
-func Routes() *http.ServeMux {
+func Routes() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("PUT /{BucketName}", storage.CreateBucket)
+	// With a -presign-secret, writes to buckets and objects must carry a
+	// valid signature, see storage.RequireSignature.
+	mux.HandleFunc("PUT /{BucketName}", storage.RequireSignature(storage.CreateBucket))
 	mux.HandleFunc("GET /", storage.ListBuckets)
-	mux.HandleFunc("DELETE /{BucketName}", storage.DeleteBucket)
+	mux.HandleFunc("DELETE /{BucketName}", storage.RequireSignature(storage.DeleteBucket))
 
-	mux.HandleFunc("PUT /{BucketName}/{ObjectKey}", storage.CreateObject)
-	mux.HandleFunc("GET /{BucketName}", storage.ListObjects)
-	mux.HandleFunc("GET /{BucketName}/{ObjectKey}", storage.GetObject)
-	mux.HandleFunc("DELETE /{BucketName}/{ObjectKey}", storage.DeleteObject)
+	// Object keys may contain slashes, e.g. posts/2026/10/abc.png.
+	mux.HandleFunc("PUT /{BucketName}/{ObjectKey...}", storage.RequireSignature(storage.CreateObject))
+	// GET patterns also match HEAD. A separate "HEAD /{BucketName}" would
+	// conflict with "GET /health", so ListObjects hands HEAD to HeadBucket.
+	mux.HandleFunc("GET /{BucketName}", storage.RequireSignature(storage.ListObjects))
+	mux.HandleFunc("GET /{BucketName}/{ObjectKey...}", storage.RequireSignature(storage.GetObject))
+	mux.HandleFunc("HEAD /{BucketName}/{ObjectKey...}", storage.RequireSignature(storage.HeadObject))
+	mux.HandleFunc("DELETE /{BucketName}/{ObjectKey...}", storage.RequireSignature(storage.DeleteObject))
+	// Multipart uploads: POST starts and completes them, their ?uploadId
+	// requests on the routes above upload, list and abort parts.
+	mux.HandleFunc("POST /{BucketName}/{ObjectKey...}", storage.RequireSignature(storage.PostObject))
 	mux.HandleFunc("GET /health", storage.HealthCheckHandler)
 
-	return mux
+	// The admin endpoints get their own mux: in the same one "GET
+	// /_admin/scrub" and "HEAD /{BucketName}/{ObjectKey...}" would both
+	// match HEAD /_admin/scrub and conflict. Bucket names can't contain
+	// "_", so the prefix never shadows a bucket.
+	admin := http.NewServeMux()
+	admin.HandleFunc("GET /_admin/scrub", storage.GetScrubReport)
+	admin.HandleFunc("POST /_admin/scrub", storage.RunScrub)
+
+	return storage.CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/_admin/") {
+			admin.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
 }
@@ -0,0 +1,125 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"triple-s/flags"
+	"triple-s/info"
+	"triple-s/storage"
+	"triple-s/utils"
+)
+
+func TestRoutes_Head(t *testing.T) {
+	flags.Dir = t.TempDir()
+	if err := utils.WriteBucket(info.Buckets{Buckets: []info.Bucket{{Name: "photos", Status: "Available"}}}); err != nil {
+		t.Fatal(err)
+	}
+	mux := Routes()
+
+	tests := []struct {
+		method, path string
+		wantStatus   int
+	}{
+		{http.MethodHead, "/photos", http.StatusOK},
+		{http.MethodHead, "/videos", http.StatusNotFound},
+		{http.MethodHead, "/photos/missing.png", http.StatusNotFound},
+		{http.MethodGet, "/health", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, w.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestRoutes_Admin(t *testing.T) {
+	flags.Dir = t.TempDir()
+	flags.AdminToken = "secret"
+	defer func() { flags.AdminToken = "" }()
+	mux := Routes()
+
+	// A wrong token reaches the admin handlers, which refuse it, instead of
+	// being taken for a bucket named "_admin".
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPost} {
+		r := httptest.NewRequest(method, "/_admin/scrub", nil)
+		r.Header.Set("Authorization", "Bearer wrong")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s /_admin/scrub: status = %d, want 401", method, w.Code)
+		}
+	}
+}
+
+func TestRoutes_NestedKeys(t *testing.T) {
+	flags.Dir = t.TempDir()
+	if err := storage.InitObjectFile("photos"); err != nil {
+		t.Fatal(err)
+	}
+	mux := Routes()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := serve(http.MethodPut, "/photos/posts/2026/10/abc.png", "nested"); w.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodGet, "/photos/posts/2026/10/abc.png", ""); w.Code != http.StatusOK || w.Body.String() != "nested" {
+		t.Errorf("GET: status %d, body %q", w.Code, w.Body.String())
+	}
+	// The mux cleans dot segments and redirects, so they never reach a handler.
+	if w := serve(http.MethodPut, "/photos/../buckets.csv", "overwrite"); w.Code == http.StatusOK {
+		t.Errorf("PUT with ..: status %d", w.Code)
+	}
+	if w := serve(http.MethodDelete, "/photos/posts/2026/10/abc.png", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE: status %d", w.Code)
+	}
+}
+
+func TestRoutes_CORS(t *testing.T) {
+	flags.Dir = t.TempDir()
+	flags.CORSOrigin = "http://localhost:8081"
+	defer func() { flags.CORSOrigin = "" }()
+	mux := Routes()
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodOptions, "/photos/a.png", nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", "PUT")
+		r.Header.Set("Access-Control-Request-Headers", "content-type,x-amz-meta-filename")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := preflight("http://localhost:8081")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight: status %d", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "http://localhost:8081" ||
+		!strings.Contains(w.Header().Get("Access-Control-Allow-Methods"), "PUT") ||
+		w.Header().Get("Access-Control-Allow-Headers") != "content-type,x-amz-meta-filename" {
+		t.Errorf("preflight headers: %v", w.Header())
+	}
+
+	if w := preflight("http://evil.example"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("other origin allowed: %v", w.Header())
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/health", nil)
+	r.Header.Set("Origin", "http://localhost:8081")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Expose-Headers") != "ETag" {
+		t.Errorf("GET: status %d, headers %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"triple-s/flags"
+)
+
+// adminAuthorized checks the bearer token of an admin request. Without an
+// -admin-token the admin endpoints answer 404, as if they didn't exist.
+func adminAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	if flags.AdminToken == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(flags.AdminToken)) != 1 {
+		ErrXMLResponse(w, http.StatusUnauthorized, "Invalid admin token")
+		return false
+	}
+	return true
+}
+
+// GetScrubReport returns the report of the latest scrub.
+func GetScrubReport(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r) {
+		return
+	}
+
+	report := LastScrub()
+	if report == nil {
+		ErrXMLResponse(w, http.StatusNotFound, "No scrub has run yet")
+		return
+	}
+	WriteXMLResponse(w, http.StatusOK, report)
+}
+
+// RunScrub scrubs now and returns the report; ?repair=true also repairs.
+func RunScrub(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r) {
+		return
+	}
+
+	repair := r.URL.Query().Get("repair") == "true"
+	report, err := Scrub(repair)
+	if err != nil {
+		if errors.Is(err, ErrScrubRunning) {
+			ErrXMLResponse(w, http.StatusConflict, "A scrub is already running")
+			return
+		}
+		log.Printf("Scrub failed: %v\n", err)
+		ErrXMLResponse(w, http.StatusInternalServerError, "Scrub failed")
+		return
+	}
+
+	log.Printf("Scrub finished: %d buckets, %d objects, %d issues, repair %t", report.Buckets, report.Objects, len(report.Issues), repair)
+	WriteXMLResponse(w, http.StatusOK, report)
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -17,41 +19,34 @@ func CreateBucket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bucketsData, err := utils.ReadBucket()
-	if err != nil {
-		log.Printf("Error reading bucket file: %v\n", err)
-		ErrXMLResponse(w, http.StatusInternalServerError, "Internal Server Error")
-		return
-	}
-
-	if SearchBucketIDX(bucketsData.Buckets, bucketName) != -1 {
-		log.Printf("Bucket %s already exists\n", bucketName)
-		ErrXMLResponse(w, http.StatusConflict, "Bucket already exists")
-		return
-	}
-
-	newBucket := info.Bucket{
-		Name:             bucketName,
-		CreationTime:     time.Now().Format(time.RFC3339Nano),
-		LastModifiedTime: time.Now().Format(time.RFC3339Nano),
-		Status:           "Available",
-	}
-	bucketsData.Buckets = append(bucketsData.Buckets, newBucket)
-
-	if err := utils.WriteBucket(bucketsData); err != nil {
-		log.Printf("Error writing buckets file: %v\n", err)
-		ErrXMLResponse(w, http.StatusInternalServerError, "Internal server error")
-		return
-	}
-
-	if err := CreateBucketDir(bucketName); err != nil {
-		log.Printf("Error creating bucket directory: %v\n", err)
-		ErrXMLResponse(w, http.StatusInternalServerError, "Internal server error")
-		return
-	}
+	// The directory is created under the buckets.csv lock so a bucket is
+	// never listed before it can take objects.
+	err := utils.UpdateBuckets(func(bucketsData *info.Buckets) error {
+		if SearchBucketIDX(bucketsData.Buckets, bucketName) != -1 {
+			return ErrBucketExists
+		}
+		if err := CreateBucketDir(bucketName); err != nil {
+			return err
+		}
+		if err := InitObjectFile(bucketName); err != nil {
+			return fmt.Errorf("failed to initialize object file: %w", err)
+		}
 
-	if err := InitObjectFile(bucketName); err != nil {
-		log.Printf("Error initializing object file: %v\n", err)
+		bucketsData.Buckets = append(bucketsData.Buckets, info.Bucket{
+			Name:             bucketName,
+			CreationTime:     time.Now().Format(time.RFC3339Nano),
+			LastModifiedTime: time.Now().Format(time.RFC3339Nano),
+			Status:           "Available",
+		})
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrBucketExists) {
+			log.Printf("Bucket %s already exists\n", bucketName)
+			ErrXMLResponse(w, http.StatusConflict, "Bucket already exists")
+			return
+		}
+		log.Printf("Error creating bucket %s: %v\n", bucketName, err)
 		ErrXMLResponse(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
@@ -72,55 +67,81 @@ func ListBuckets(w http.ResponseWriter, r *http.Request) {
 	WriteXMLResponse(w, http.StatusOK, bucketData)
 }
 
-func DeleteBucket(w http.ResponseWriter, r *http.Request) {
+// HeadBucket reports whether a bucket exists. Like every HEAD response it
+// carries no body, errors included.
+func HeadBucket(w http.ResponseWriter, r *http.Request) {
 	bucketName := strings.TrimPrefix(r.URL.Path, "/")
 
 	bucketsData, err := utils.ReadBucket()
 	if err != nil {
 		log.Printf("Error reading bucket file: %v\n", err)
-		ErrXMLResponse(w, http.StatusInternalServerError, "Internal Server Error")
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	bucketIDX := SearchBucketIDX(bucketsData.Buckets, bucketName)
 	if bucketIDX == -1 {
-		log.Printf("Bucket doesn't exist)")
-		ErrXMLResponse(w, http.StatusNotFound, "Bucket not found")
+		log.Printf("Bucket %s not found\n", bucketName)
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	if !isBucketEmpty(bucketName) {
-		log.Printf("Bucket %s is not empty\n", bucketName)
-		ErrXMLResponse(w, http.StatusConflict, "Bucket is not empty")
-		return
+	if modTime, err := time.Parse(time.RFC3339Nano, bucketsData.Buckets[bucketIDX].LastModifiedTime); err == nil {
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
 	}
+	w.WriteHeader(http.StatusOK)
+}
 
-	if bucketsData.Buckets[bucketIDX].Status == "Marked for delete" {
-		if err := RemoveBucket(bucketName); err != nil {
-			log.Printf("Error removing bucket directory: %v\n", err)
-			ErrXMLResponse(w, http.StatusInternalServerError, "Internal server error")
-			return
-		}
+func DeleteBucket(w http.ResponseWriter, r *http.Request) {
+	bucketName := strings.TrimPrefix(r.URL.Path, "/")
 
-		bucketsData.Buckets = append(bucketsData.Buckets[:bucketIDX], bucketsData.Buckets[bucketIDX+1:]...)
+	permanent := false
+	err := utils.UpdateBuckets(func(bucketsData *info.Buckets) error {
+		bucketIDX := SearchBucketIDX(bucketsData.Buckets, bucketName)
+		if bucketIDX == -1 {
+			return ErrBucketNotFound
+		}
 
-		if err := utils.WriteBucket(bucketsData); err != nil {
-			log.Printf("Error writing buckets file: %v\n", err)
+		// The metadata store holds the bucket lock while the callback runs,
+		// keeping uploads out between the emptiness check and the removal;
+		// lock order is always buckets, then objects.
+		return Metadata.RemoveBucket(GetBucketPath(bucketName), func(objects []info.Object) (bool, error) {
+			if len(objects) != 0 {
+				return false, ErrBucketNotEmpty
+			}
+
+			if bucketsData.Buckets[bucketIDX].Status == "Marked for delete" {
+				if err := RemoveBucket(bucketName); err != nil {
+					return false, err
+				}
+				bucketsData.Buckets = append(bucketsData.Buckets[:bucketIDX], bucketsData.Buckets[bucketIDX+1:]...)
+				permanent = true
+				return true, nil
+			}
+
+			bucketsData.Buckets[bucketIDX].Status = "Marked for delete"
+			bucketsData.Buckets[bucketIDX].LastModifiedTime = time.Now().Format(time.RFC3339Nano)
+			return false, nil
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrBucketNotFound):
+			log.Printf("Bucket %s doesn't exist\n", bucketName)
+			ErrXMLResponse(w, http.StatusNotFound, "Bucket not found")
+		case errors.Is(err, ErrBucketNotEmpty):
+			log.Printf("Bucket %s is not empty\n", bucketName)
+			ErrXMLResponse(w, http.StatusConflict, "Bucket is not empty")
+		default:
+			log.Printf("Error deleting bucket %s: %v\n", bucketName, err)
 			ErrXMLResponse(w, http.StatusInternalServerError, "Internal server error")
-			return
 		}
-
-		log.Printf("Bucket %s permanently deleted", bucketName)
-		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	bucketsData.Buckets[bucketIDX].Status = "Marked for delete"
-	bucketsData.Buckets[bucketIDX].LastModifiedTime = time.Now().Format(time.RFC3339Nano)
-
-	if err := utils.WriteBucket(bucketsData); err != nil {
-		log.Printf("Error writing buckets file: %v\n", err)
-		ErrXMLResponse(w, http.StatusInternalServerError, "Internal server error")
+	if permanent {
+		log.Printf("Bucket %s permanently deleted", bucketName)
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"triple-s/flags"
+	"triple-s/info"
+	"triple-s/utils"
+)
+
+func quietLogs(t *testing.T) {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+}
+
+func TestCreateObject_Concurrent(t *testing.T) {
+	t.Run("csv", testCreateObjectConcurrent)
+	t.Run("log", func(t *testing.T) {
+		useLogStore(t)
+		testCreateObjectConcurrent(t)
+	})
+}
+
+func testCreateObjectConcurrent(t *testing.T) {
+	quietLogs(t)
+	bucketPath := setupBucket(t)
+
+	const uploads = 300
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("object-%03d.txt", i)
+			r := httptest.NewRequest(http.MethodPut, "/"+testBucket+"/"+key, strings.NewReader(key))
+			r.Header.Set("Content-Type", "text/plain")
+			w := httptest.NewRecorder()
+			CreateObject(w, r)
+			if w.Code != http.StatusOK {
+				failed.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := failed.Load(); n != 0 {
+		t.Fatalf("%d uploads failed", n)
+	}
+
+	objects, err := Metadata.List(bucketPath)
+	if err != nil {
+		t.Fatalf("failed to list objects: %v", err)
+	}
+	if len(objects) != uploads {
+		t.Fatalf("metadata has %d entries, want %d", len(objects), uploads)
+	}
+
+	for _, object := range objects {
+		data, err := os.ReadFile(ObjectPath(bucketPath, object.ObjectKey))
+		if err != nil {
+			t.Errorf("object %s: %v", object.ObjectKey, err)
+			continue
+		}
+		if string(data) != object.ObjectKey {
+			t.Errorf("object %s has content %q", object.ObjectKey, data)
+		}
+	}
+
+	assertNoTempFiles(t, bucketPath)
+}
+
+// Overwrites of one key must leave exactly one entry whose ETag matches the
+// file on disk, and deletes racing them must never remove a newer file.
+func TestCreateAndDeleteObject_SameKey(t *testing.T) {
+	quietLogs(t)
+	bucketPath := setupBucket(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodPut, "/"+testBucket+"/shared.txt", strings.NewReader(fmt.Sprintf("version %d", i)))
+			CreateObject(httptest.NewRecorder(), r)
+		}(i)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodDelete, "/"+testBucket+"/shared.txt", nil)
+			DeleteObject(httptest.NewRecorder(), r)
+		}()
+	}
+	wg.Wait()
+
+	objects, err := utils.ReadObjects(bucketPath)
+	if err != nil {
+		t.Fatalf("failed to read objects.csv: %v", err)
+	}
+
+	_, statErr := os.Stat(ObjectPath(bucketPath, "shared.txt"))
+	switch len(objects.Objects) {
+	case 0:
+		if statErr == nil {
+			t.Error("object file left behind without a metadata entry")
+		}
+	case 1:
+		if statErr != nil {
+			t.Errorf("metadata entry without an object file: %v", statErr)
+		}
+		w := getObject(t, "shared.txt", nil)
+		if got, want := w.Header().Get("ETag"), `"`+objects.Objects[0].ETag+`"`; got != want {
+			t.Errorf("ETag = %s, want %s", got, want)
+		}
+	default:
+		t.Errorf("objects.csv has %d entries for one key", len(objects.Objects))
+	}
+
+	assertNoTempFiles(t, bucketPath)
+}
+
+// Writes replace objects.csv by rename, so a reader running next to them
+// must always parse a complete file.
+func TestReadObjects_NeverTruncated(t *testing.T) {
+	quietLogs(t)
+	bucketPath := setupBucket(t)
+
+	done := make(chan struct{})
+	var readErrors atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			last := 0
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				objects, err := utils.ReadObjects(bucketPath)
+				if err != nil || len(objects.Objects) < last {
+					readErrors.Add(1)
+					continue
+				}
+				last = len(objects.Objects)
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		putObject(t, fmt.Sprintf("file-%d", i), "text/plain", "data")
+	}
+	close(done)
+	wg.Wait()
+
+	if n := readErrors.Load(); n != 0 {
+		t.Errorf("%d reads saw a truncated or stale objects.csv", n)
+	}
+}
+
+func TestCreateBucket_Concurrent(t *testing.T) {
+	quietLogs(t)
+	flags.Dir = t.TempDir()
+	if err := utils.WriteBucket(info.Buckets{}); err != nil {
+		t.Fatal(err)
+	}
+
+	const buckets = 50
+	var wg sync.WaitGroup
+	var conflicts atomic.Int32
+	for i := 0; i < buckets; i++ {
+		// Every name is requested twice, exactly one of each pair must win.
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				r := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/bucket-%02d", i), nil)
+				w := httptest.NewRecorder()
+				CreateBucket(w, r)
+				if w.Code == http.StatusConflict {
+					conflicts.Add(1)
+				}
+			}(i)
+		}
+	}
+	wg.Wait()
+
+	data, err := utils.ReadBucket()
+	if err != nil {
+		t.Fatalf("failed to read buckets.csv: %v", err)
+	}
+	if len(data.Buckets) != buckets {
+		t.Errorf("buckets.csv has %d entries, want %d", len(data.Buckets), buckets)
+	}
+	if n := conflicts.Load(); n != buckets {
+		t.Errorf("%d conflicts, want %d", n, buckets)
+	}
+	assertNoTempFiles(t, flags.Dir)
+}
+
+func TestWriteCSV_KeepsOldFileOnFailure(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "objects.csv")
+	if err := utils.WriteCSV(path, []string{"a", "b"}, [][]string{{"1", "2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A read-only directory makes the temporary file impossible, which is
+	// where a real crash would interrupt the write as well.
+	if err := os.Chmod(dir, 0o500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0o700)
+
+	if err := utils.WriteCSV(path, []string{"a", "b"}, nil); err == nil {
+		t.Fatal("expected the write to fail in a read-only directory")
+	}
+
+	records, err := utils.ReadCSV(path)
+	if err != nil || len(records) != 1 {
+		t.Errorf("old content lost: records %v, err %v", records, err)
+	}
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			t.Errorf("temporary file left behind: %s", entry.Name())
+		}
+	}
+}
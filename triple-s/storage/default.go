@@ -64,5 +64,5 @@ func InitObjectFile(bucketName string) error {
 	if err != nil {
 		return err
 	}
-	return writeFileWithHeader(filepath.Join(pathBucket, "objects.csv"), info.ObjectsHeader)
+	return Metadata.InitBucket(pathBucket)
 }
@@ -1,17 +1,23 @@
 package storage
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 	"triple-s/flags"
 	"triple-s/info"
-	"triple-s/utils"
+	"triple-s/metadata"
 )
 
 func validateBucketName(name string) error {
@@ -54,15 +60,6 @@ func SearchBucketIDX(buckets []info.Bucket, name string) int {
 	return -1
 }
 
-func SearchObjectIDX(objects []info.Object, key string) int {
-	for i, object := range objects {
-		if object.ObjectKey == key {
-			return i
-		}
-	}
-	return -1
-}
-
 func CreateBucketDir(bucketName string) error {
 	dirPath := filepath.Join(flags.Dir, bucketName)
 	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
@@ -71,22 +68,6 @@ func CreateBucketDir(bucketName string) error {
 	return nil
 }
 
-func isBucketEmpty(bucketName string) bool {
-	bucketPath := GetBucketPath(bucketName)
-	objectsMetaDataPath := filepath.Join(bucketPath, "objects.csv")
-	if _, err := os.Stat(objectsMetaDataPath); os.IsNotExist(err) {
-		return true
-	}
-
-	objects, err := utils.ReadCSV(objectsMetaDataPath)
-	if err != nil {
-		fmt.Printf("Error reading objects metadata: %v\n", err)
-		return false
-	}
-
-	return len(objects) == 0
-}
-
 func RemoveBucket(bucketname string) error {
 	dirPath := filepath.Join(flags.Dir, bucketname)
 	if err := os.RemoveAll(dirPath); err != nil {
@@ -110,19 +91,66 @@ func ValidatePath(path string) (bucketName, objectKey string) {
 	return
 }
 
-func GetMetaDataType(bucketPath, objectPath string) (string, error) {
-	metaDataPath := filepath.Join(bucketPath, "objects.csv")
-	records, err := utils.ReadCSV(metaDataPath)
+var (
+	ErrObjectNotFound = errors.New("object not found")
+	ErrBucketNotFound = errors.New("bucket not found")
+	ErrBucketExists   = errors.New("bucket already exists")
+	ErrBucketNotEmpty = errors.New("bucket is not empty")
+
+	errObjectExists = errors.New("object already exists")
+)
+
+func GetObjectMeta(bucketPath, objectKey string) (info.Object, error) {
+	object, err := Metadata.Get(bucketPath, objectKey)
+	if errors.Is(err, metadata.ErrNotFound) {
+		return info.Object{}, ErrObjectNotFound
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to read metadata: %w", err)
+		return info.Object{}, fmt.Errorf("failed to read metadata: %w", err)
 	}
+	return object, nil
+}
+
+const userMetadataPrefix = "X-Amz-Meta-"
 
-	for _, record := range records {
-		if record[0] == objectPath {
-			return record[1], nil
+// EncodeUserMetadata keeps the x-amz-meta-* request headers for the metadata store.
+func EncodeUserMetadata(header http.Header) string {
+	values := url.Values{}
+	for name, vals := range header {
+		if key, ok := strings.CutPrefix(name, userMetadataPrefix); ok && key != "" {
+			values[strings.ToLower(key)] = vals
 		}
 	}
-	return "", fmt.Errorf("metadata type not found")
+	return values.Encode()
+}
+
+// SetObjectHeaders writes the stored metadata of an object as S3 response
+// headers and returns its modification time. Objects uploaded before hashes
+// were stored have no ETag and are validated by Last-Modified alone.
+func SetObjectHeaders(header http.Header, object info.Object, fallback time.Time) time.Time {
+	header.Set("Content-Type", object.ContentType)
+	if object.ETag != "" {
+		header.Set("ETag", `"`+object.ETag+`"`)
+	}
+	if sum, err := hex.DecodeString(object.SHA256); err == nil && len(sum) == sha256.Size {
+		header.Set("X-Amz-Checksum-Sha256", base64.StdEncoding.EncodeToString(sum))
+	}
+
+	values, err := url.ParseQuery(object.Metadata)
+	if err != nil {
+		log.Printf("Ignoring malformed metadata of object %s: %v\n", object.ObjectKey, err)
+	}
+	for key, vals := range values {
+		for _, val := range vals {
+			header.Add(userMetadataPrefix+key, val)
+		}
+	}
+
+	modTime, err := time.Parse(time.RFC3339Nano, object.LastModified)
+	if err != nil {
+		return fallback
+	}
+	return modTime
 }
 
 func WriteXMLResponse(w http.ResponseWriter, statusCode int, v interface{}) {
@@ -137,3 +165,24 @@ func WriteXMLResponse(w http.ResponseWriter, statusCode int, v interface{}) {
 func ErrXMLResponse(w http.ResponseWriter, code int, message string) {
 	WriteXMLResponse(w, code, info.ErrResp{Code: code, Message: message})
 }
+
+// ErrS3Response answers with the <Error> body of S3, for errors S3 clients
+// tell apart by name.
+func ErrS3Response(w http.ResponseWriter, code int, errorCode, message string) {
+	WriteXMLResponse(w, code, info.S3Error{Code: errorCode, Message: message})
+}
+
+// requestDigest decodes a base64 digest header such as Content-MD5. It
+// returns nil when the header is absent and an error when it can't be the
+// digest of the given size.
+func requestDigest(header http.Header, name string, size int) ([]byte, error) {
+	value := header.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	digest, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(digest) != size {
+		return nil, fmt.Errorf("invalid %s header", name)
+	}
+	return digest, nil
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"triple-s/info"
+	"triple-s/utils"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxKeyLength = 1024
+
+var (
+	errKeyTooLong = fmt.Errorf("object key is longer than %d bytes", maxKeyLength)
+	errInvalidKey = errors.New("invalid object key")
+	errLayoutSkip = errors.New("object has no metadata entry")
+)
+
+// validateObjectKey applies the S3 key rules: up to 1024 bytes of UTF-8.
+// Control characters can't be listed in XML and "." or ".." segments would
+// be resolved away by clients that map keys to paths, so both are refused.
+func validateObjectKey(key string) error {
+	if len(key) > maxKeyLength {
+		return errKeyTooLong
+	}
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("%w: not valid UTF-8", errInvalidKey)
+	}
+	for _, r := range key {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w: contains control characters", errInvalidKey)
+		}
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("%w: contains a %q segment", errInvalidKey, segment)
+		}
+	}
+	return nil
+}
+
+// ObjectPath returns where the content of an object is stored. The file is
+// named after the SHA-256 of the key and sharded two directory levels deep,
+// bucket/ab/cd/abcd..., so keys never reach the filesystem: they can't
+// escape the bucket, any length fits in a file name and a bucket of
+// millions of objects keeps a few dozen files per directory.
+func ObjectPath(bucketPath, objectKey string) string {
+	sum := sha256.Sum256([]byte(objectKey))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(bucketPath, name[:2], name[2:4], name)
+}
+
+// isShardDir matches the two hex digit directories of ObjectPath.
+func isShardDir(name string) bool {
+	if len(name) != 2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil && strings.ToLower(name) == name
+}
+
+// moveObject renames a file into its shard, creating the shard as needed.
+func moveObject(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+// MigrateLayout moves objects stored flat in their bucket directory, the
+// layout before keys were hashed, to their ObjectPath. Files without a
+// metadata entry are left for the scrubber to adopt.
+func MigrateLayout() (int, error) {
+	buckets, err := utils.ReadBucket()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read buckets: %w", err)
+	}
+
+	moved := 0
+	for _, bucket := range buckets.Buckets {
+		n, err := migrateBucketLayout(GetBucketPath(bucket.Name))
+		moved += n
+		if err != nil {
+			return moved, fmt.Errorf("failed to migrate bucket %s: %w", bucket.Name, err)
+		}
+	}
+	return moved, nil
+}
+
+func migrateBucketLayout(bucketPath string) (int, error) {
+	entries, err := os.ReadDir(bucketPath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, entry := range entries {
+		objectKey := entry.Name()
+		if !isFlatObject(entry) {
+			continue
+		}
+		err := Metadata.Update(bucketPath, objectKey, func(current *info.Object) (*info.Object, error) {
+			if current == nil {
+				return nil, errLayoutSkip
+			}
+			if err := moveObject(filepath.Join(bucketPath, objectKey), ObjectPath(bucketPath, objectKey)); err != nil {
+				return nil, err
+			}
+			return current, nil
+		})
+		if errors.Is(err, errLayoutSkip) {
+			continue
+		}
+		if err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// isFlatObject tells an object file of the flat layout from the metadata
+// files, temporary files and shard directories next to it.
+func isFlatObject(entry os.DirEntry) bool {
+	name := entry.Name()
+	return entry.Type().IsRegular() && !isMetadataFile(name) && !strings.HasPrefix(name, ".")
+}
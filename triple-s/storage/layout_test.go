@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"triple-s/info"
+	"triple-s/utils"
+)
+
+func TestValidateObjectKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"photo.png", true},
+		{"posts/2026/10/abc.png", true},
+		{"folder/", true},
+		{"with space/and-ümlaut.txt", true},
+		{"..hidden/a..b", true},
+		{strings.Repeat("k", 1024), true},
+		{strings.Repeat("k", 1025), false},
+		{"../escape", false},
+		{"a/../../escape", false},
+		{"a/./b", false},
+		{"..", false},
+		{"tab\tkey", false},
+		{"null\x00key", false},
+		{"bad\xffutf8", false},
+	}
+	for _, tt := range tests {
+		if err := validateObjectKey(tt.key); (err == nil) != tt.valid {
+			t.Errorf("validateObjectKey(%.40q) = %v, want valid %v", tt.key, err, tt.valid)
+		}
+	}
+}
+
+func TestObjectPath(t *testing.T) {
+	bucketPath := filepath.Join("data", testBucket)
+	for _, key := range []string{"a.txt", "posts/2026/10/abc.png", "../../etc/passwd", strings.Repeat("x", 1024)} {
+		path := ObjectPath(bucketPath, key)
+		rel, err := filepath.Rel(bucketPath, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			t.Errorf("%q stored outside the bucket at %s", key, path)
+		}
+		if parts := strings.Split(rel, string(filepath.Separator)); len(parts) != 3 || len(parts[2]) != 64 || !isShardDir(parts[0]) || !isShardDir(parts[1]) {
+			t.Errorf("%q stored at %s, want two shard levels and a hashed name", key, rel)
+		}
+	}
+	if ObjectPath(bucketPath, "a") == ObjectPath(bucketPath, "b") {
+		t.Error("different keys share a path")
+	}
+}
+
+func TestObjects_NestedKeys(t *testing.T) {
+	quietLogs(t)
+	bucketPath := setupBucket(t)
+
+	key := "posts/2026/10/abc.png"
+	putObject(t, key, "image/png", "nested")
+	if w := getObject(t, key, nil); w.Code != http.StatusOK || w.Body.String() != "nested" {
+		t.Errorf("GET %s: status %d, body %q", key, w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(bucketPath, "posts")); !os.IsNotExist(err) {
+		t.Errorf("key path created in the bucket: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/"+testBucket+"/"+key, nil)
+	w := httptest.NewRecorder()
+	DeleteObject(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("DELETE %s: status %d", key, w.Code)
+	}
+	if _, err := os.Stat(ObjectPath(bucketPath, key)); !os.IsNotExist(err) {
+		t.Errorf("object file left after delete: %v", err)
+	}
+}
+
+func TestCreateObject_InvalidKey(t *testing.T) {
+	quietLogs(t)
+	setupBucket(t)
+
+	tests := []struct {
+		key, wantCode string
+	}{
+		{"../../escape.txt", "InvalidArgument"},
+		{"a/./b", "InvalidArgument"},
+		{strings.Repeat("k", 1025), "KeyTooLongError"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/"+testBucket+"/placeholder", strings.NewReader("data"))
+		// Set after parsing, a client's request line isn't cleaned.
+		r.URL.Path = "/" + testBucket + "/" + tt.key
+		w := httptest.NewRecorder()
+		CreateObject(w, r)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "<Code>"+tt.wantCode+"</Code>") {
+			t.Errorf("PUT %.40q: status %d, body %s", tt.key, w.Code, w.Body.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(GetBucketPath(testBucket)), "escape.txt")); !os.IsNotExist(err) {
+		t.Errorf("object written outside the bucket: %v", err)
+	}
+}
+
+func TestMigrateLayout(t *testing.T) {
+	quietLogs(t)
+	bucketPath := setupBucket(t)
+	if err := utils.WriteBucket(info.Buckets{Buckets: []info.Bucket{{Name: testBucket, Status: "Available"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"a.txt", "b.txt", "orphan.txt"} {
+		if err := os.WriteFile(filepath.Join(bucketPath, key), []byte(key), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if key == "orphan.txt" {
+			continue
+		}
+		err := Metadata.Update(bucketPath, key, func(*info.Object) (*info.Object, error) {
+			return &info.Object{ObjectKey: key, ContentType: "text/plain", Size: "5"}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moved, err := MigrateLayout()
+	if err != nil || moved != 2 {
+		t.Fatalf("MigrateLayout: moved %d, %v; want 2", moved, err)
+	}
+	for _, key := range []string{"a.txt", "b.txt"} {
+		if w := getObject(t, key, nil); w.Body.String() != key {
+			t.Errorf("GET %s after migration: status %d, body %q", key, w.Code, w.Body.String())
+		}
+	}
+	// Orphans are the scrubber's business.
+	if _, err := os.Stat(filepath.Join(bucketPath, "orphan.txt")); err != nil {
+		t.Errorf("orphan moved: %v", err)
+	}
+
+	if moved, err := MigrateLayout(); err != nil || moved != 0 {
+		t.Errorf("second run: moved %d, %v; want 0", moved, err)
+	}
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"triple-s/info"
+)
+
+const maxListKeys = 1000
+
+// listParams are the ListObjectsV2 query parameters.
+type listParams struct {
+	Prefix            string
+	Delimiter         string
+	MaxKeys           int
+	ContinuationToken string
+	StartAfter        string
+	after             string // decoded from ContinuationToken, else StartAfter
+	afterPrefix       bool   // after is a CommonPrefix that ended the last page
+}
+
+// A continuation token is the last key or CommonPrefix of a page behind a
+// byte telling which of the two it is, unpadded base64url.
+const (
+	tokenKey    = 'k'
+	tokenPrefix = 'p'
+)
+
+func encodeToken(last string, isPrefix bool) string {
+	kind := byte(tokenKey)
+	if isPrefix {
+		kind = tokenPrefix
+	}
+	return base64.RawURLEncoding.EncodeToString(append([]byte{kind}, last...))
+}
+
+var errInvalidListArgument = errors.New("invalid list argument")
+
+func parseListParams(query url.Values) (listParams, error) {
+	params := listParams{
+		Prefix:            query.Get("prefix"),
+		Delimiter:         query.Get("delimiter"),
+		MaxKeys:           maxListKeys,
+		ContinuationToken: query.Get("continuation-token"),
+		StartAfter:        query.Get("start-after"),
+	}
+
+	if value := query.Get("max-keys"); value != "" {
+		maxKeys, err := strconv.Atoi(value)
+		if err != nil || maxKeys < 0 {
+			return params, errInvalidListArgument
+		}
+		params.MaxKeys = min(maxKeys, maxListKeys)
+	}
+
+	params.after = params.StartAfter
+	if params.ContinuationToken != "" {
+		token, err := base64.RawURLEncoding.DecodeString(params.ContinuationToken)
+		if err != nil || len(token) == 0 || (token[0] != tokenKey && token[0] != tokenPrefix) {
+			return params, errInvalidListArgument
+		}
+		params.after = string(token[1:])
+		params.afterPrefix = token[0] == tokenPrefix
+	}
+	return params, nil
+}
+
+// listObjectsV2 builds one page of a listing. Keys are sorted byte-wise,
+// and with a delimiter every key sharing the part of its name up to the
+// first delimiter after the prefix collapses into one CommonPrefix, which
+// counts against MaxKeys like a key does.
+func listObjectsV2(bucketName string, objects []info.Object, params listParams) info.ListBucketResult {
+	result := info.ListBucketResult{
+		Name:              bucketName,
+		Prefix:            params.Prefix,
+		Delimiter:         params.Delimiter,
+		MaxKeys:           params.MaxKeys,
+		ContinuationToken: params.ContinuationToken,
+		StartAfter:        params.StartAfter,
+	}
+
+	sorted := make([]info.Object, len(objects))
+	copy(sorted, objects)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ObjectKey < sorted[j].ObjectKey })
+
+	var last string
+	lastIsPrefix := false
+	for _, object := range sorted {
+		key := object.ObjectKey
+		if !strings.HasPrefix(key, params.Prefix) || key <= params.after {
+			continue
+		}
+		// A page that ended on a common prefix resumes after all of its keys.
+		if params.afterPrefix && strings.HasPrefix(key, params.after) {
+			continue
+		}
+
+		commonPrefix := ""
+		if params.Delimiter != "" {
+			if i := strings.Index(key[len(params.Prefix):], params.Delimiter); i != -1 {
+				commonPrefix = key[:len(params.Prefix)+i+len(params.Delimiter)]
+			}
+		}
+		if commonPrefix != "" && commonPrefix == last {
+			continue
+		}
+
+		if result.KeyCount == params.MaxKeys {
+			result.IsTruncated = params.MaxKeys > 0
+			break
+		}
+
+		if commonPrefix != "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, info.CommonPrefix{Prefix: commonPrefix})
+			last, lastIsPrefix = commonPrefix, true
+		} else {
+			result.Contents = append(result.Contents, listContents(object))
+			last, lastIsPrefix = key, false
+		}
+		result.KeyCount++
+	}
+
+	if result.IsTruncated {
+		result.NextContinuationToken = encodeToken(last, lastIsPrefix)
+	}
+	return result
+}
+
+func listContents(object info.Object) info.ListContents {
+	contents := info.ListContents{Key: object.ObjectKey, StorageClass: "STANDARD"}
+	if object.ETag != "" {
+		contents.ETag = `"` + object.ETag + `"`
+	}
+	// Sizes of -1 come from chunked uploads before sizes were counted.
+	if size, err := strconv.ParseInt(object.Size, 10, 64); err == nil && size > 0 {
+		contents.Size = size
+	}
+	if modTime, err := time.Parse(time.RFC3339Nano, object.LastModified); err == nil {
+		contents.LastModified = modTime.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	return contents
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"triple-s/info"
+)
+
+// setupListBucket records entries straight in the metadata store, listing
+// never opens the object files.
+func setupListBucket(t *testing.T, keys ...string) {
+	t.Helper()
+	quietLogs(t)
+	bucketPath := setupBucket(t)
+	for _, key := range keys {
+		err := Metadata.Update(bucketPath, key, func(*info.Object) (*info.Object, error) {
+			return &info.Object{ObjectKey: key, ContentType: "text/plain", Size: "4", LastModified: "2024-01-02T15:04:05.123456Z", ETag: "etag"}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func listObjects(t *testing.T, query string) (info.ListBucketResult, int) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/"+testBucket+"?"+query, nil)
+	w := httptest.NewRecorder()
+	ListObjects(w, r)
+
+	var result info.ListBucketResult
+	if w.Code == http.StatusOK {
+		if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("bad listing %s: %v", w.Body.String(), err)
+		}
+	}
+	return result, w.Code
+}
+
+func keysAndPrefixes(result info.ListBucketResult) ([]string, []string) {
+	var keys, prefixes []string
+	for _, contents := range result.Contents {
+		keys = append(keys, contents.Key)
+	}
+	for _, prefix := range result.CommonPrefixes {
+		prefixes = append(prefixes, prefix.Prefix)
+	}
+	return keys, prefixes
+}
+
+func TestListObjects(t *testing.T) {
+	setupListBucket(t, "photos/2024/b.png", "readme.txt", "photos/2023/a.png", "photos/cover.png", "docs/a.md", "b.txt")
+
+	tests := []struct {
+		query    string
+		keys     []string
+		prefixes []string
+	}{
+		{"", []string{"b.txt", "docs/a.md", "photos/2023/a.png", "photos/2024/b.png", "photos/cover.png", "readme.txt"}, nil},
+		{"prefix=photos/", []string{"photos/2023/a.png", "photos/2024/b.png", "photos/cover.png"}, nil},
+		{"delimiter=/", []string{"b.txt", "readme.txt"}, []string{"docs/", "photos/"}},
+		{"prefix=photos/&delimiter=/", []string{"photos/cover.png"}, []string{"photos/2023/", "photos/2024/"}},
+		{"start-after=photos/2023/a.png", []string{"photos/2024/b.png", "photos/cover.png", "readme.txt"}, nil},
+		{"prefix=nothing/", nil, nil},
+	}
+	for _, tt := range tests {
+		result, code := listObjects(t, tt.query)
+		if code != http.StatusOK {
+			t.Errorf("%q: status %d", tt.query, code)
+			continue
+		}
+		keys, prefixes := keysAndPrefixes(result)
+		if !reflect.DeepEqual(keys, tt.keys) || !reflect.DeepEqual(prefixes, tt.prefixes) {
+			t.Errorf("%q: got keys %v, prefixes %v; want %v, %v", tt.query, keys, prefixes, tt.keys, tt.prefixes)
+		}
+		if result.KeyCount != len(tt.keys)+len(tt.prefixes) || result.IsTruncated {
+			t.Errorf("%q: KeyCount %d, IsTruncated %v", tt.query, result.KeyCount, result.IsTruncated)
+		}
+	}
+}
+
+func TestListObjects_Contents(t *testing.T) {
+	setupListBucket(t, "a.txt")
+
+	result, _ := listObjects(t, "")
+	want := info.ListContents{Key: "a.txt", LastModified: "2024-01-02T15:04:05.123Z", ETag: `"etag"`, Size: 4, StorageClass: "STANDARD"}
+	if result.Name != testBucket || result.MaxKeys != 1000 || len(result.Contents) != 1 || result.Contents[0] != want {
+		t.Errorf("got %+v, want one entry %+v", result, want)
+	}
+}
+
+// listAllPages follows continuation tokens, maxKeys at a time, and collects
+// every key and common prefix listed.
+func listAllPages(t *testing.T, query string, maxKeys int) ([]string, []string) {
+	t.Helper()
+	var keys, prefixes []string
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("pagination doesn't end")
+		}
+		pageQuery := query + "&max-keys=" + strconv.Itoa(maxKeys)
+		if token != "" {
+			pageQuery += "&continuation-token=" + token
+		}
+		result, code := listObjects(t, pageQuery)
+		if code != http.StatusOK {
+			t.Fatalf("status %d", code)
+		}
+		if result.KeyCount > maxKeys || result.ContinuationToken != token {
+			t.Errorf("page %d: KeyCount %d, ContinuationToken %q", pages, result.KeyCount, result.ContinuationToken)
+		}
+		pageKeys, pagePrefixes := keysAndPrefixes(result)
+		keys, prefixes = append(keys, pageKeys...), append(prefixes, pagePrefixes...)
+
+		if !result.IsTruncated {
+			if result.NextContinuationToken != "" {
+				t.Error("NextContinuationToken on the last page")
+			}
+			return keys, prefixes
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Paging with a delimiter must visit every key and common prefix exactly
+// once, including prefixes that end a page.
+func TestListObjects_Pagination(t *testing.T) {
+	setupListBucket(t, "a", "b/1", "b/2", "b/3", "c", "d/1", "e")
+
+	keys, prefixes := listAllPages(t, "delimiter=/", 2)
+	if want := []string{"a", "c", "e"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys %v, want %v", keys, want)
+	}
+	if want := []string{"b/", "d/"}; !reflect.DeepEqual(prefixes, want) {
+		t.Errorf("prefixes %v, want %v", prefixes, want)
+	}
+}
+
+// A folder marker is a key ending in the delimiter. A page ending on it
+// must not skip the keys under it, nor must start-after naming it.
+func TestListObjects_FolderMarker(t *testing.T) {
+	setupListBucket(t, "a/", "a/b", "a/c", "a/d/1")
+
+	keys, prefixes := listAllPages(t, "prefix=a/&delimiter=/", 1)
+	if want := []string{"a/", "a/b", "a/c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys %v, want %v", keys, want)
+	}
+	if want := []string{"a/d/"}; !reflect.DeepEqual(prefixes, want) {
+		t.Errorf("prefixes %v, want %v", prefixes, want)
+	}
+
+	result, _ := listObjects(t, "prefix=a/&delimiter=/&start-after=a/")
+	if keys, prefixes := keysAndPrefixes(result); !reflect.DeepEqual(keys, []string{"a/b", "a/c"}) || !reflect.DeepEqual(prefixes, []string{"a/d/"}) {
+		t.Errorf("start-after=a/: keys %v, prefixes %v", keys, prefixes)
+	}
+}
+
+func TestListObjects_InvalidArguments(t *testing.T) {
+	setupListBucket(t)
+
+	for _, query := range []string{"max-keys=ten", "max-keys=-1", "continuation-token=%25%25", "continuation-token=eA"} {
+		if _, code := listObjects(t, query); code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want 400", query, code)
+		}
+	}
+	if result, code := listObjects(t, "max-keys=5000"); code != http.StatusOK || result.MaxKeys != 1000 {
+		t.Errorf("max-keys=5000: status %d, MaxKeys %d", code, result.MaxKeys)
+	}
+}
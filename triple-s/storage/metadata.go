@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"triple-s/info"
+	"triple-s/metadata"
+	"triple-s/utils"
+)
+
+// MetadataStore keeps the object metadata of every bucket. Keys are bucket
+// paths as returned by GetBucketPath.
+type MetadataStore interface {
+	InitBucket(bucketPath string) error
+	Get(bucketPath, objectKey string) (info.Object, error)
+	List(bucketPath string) ([]info.Object, error)
+	Update(bucketPath, objectKey string, fn metadata.UpdateFunc) error
+	RemoveBucket(bucketPath string, fn metadata.RemoveFunc) error
+	Close() error
+}
+
+// Metadata is the store the handlers use, replaced in main according to
+// the -metadata flag.
+var Metadata MetadataStore = metadata.NewCSVStore()
+
+const (
+	MetadataCSV = "csv"
+	MetadataLog = "log"
+)
+
+func OpenMetadataStore(kind string, compactInterval time.Duration) (MetadataStore, error) {
+	switch kind {
+	case MetadataCSV:
+		return metadata.NewCSVStore(), nil
+	case MetadataLog:
+		return metadata.NewLogStore(compactInterval), nil
+	default:
+		return nil, fmt.Errorf("unknown metadata store %q, want %s or %s", kind, MetadataCSV, MetadataLog)
+	}
+}
+
+// MigrateMetadata copies the object metadata of every bucket in
+// buckets.csv from src to dst and returns the number of objects copied.
+// The destination ends up holding exactly the source's entries: a store
+// switched back to still has the entries of its last run, and those of
+// objects deleted since must not come back. The source files are left in
+// place.
+func MigrateMetadata(src, dst MetadataStore) (int, error) {
+	buckets, err := utils.ReadBucket()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read buckets: %w", err)
+	}
+
+	migrated := 0
+	for _, bucket := range buckets.Buckets {
+		bucketPath := GetBucketPath(bucket.Name)
+		objects, err := src.List(bucketPath)
+		if err != nil {
+			return migrated, fmt.Errorf("failed to list objects of bucket %s: %w", bucket.Name, err)
+		}
+		if err := dst.InitBucket(bucketPath); err != nil {
+			return migrated, fmt.Errorf("failed to initialize bucket %s: %w", bucket.Name, err)
+		}
+		if err := dropStale(dst, bucketPath, objects); err != nil {
+			return migrated, fmt.Errorf("failed to clear bucket %s: %w", bucket.Name, err)
+		}
+
+		for _, object := range objects {
+			object := object
+			err := dst.Update(bucketPath, object.ObjectKey, func(*info.Object) (*info.Object, error) {
+				return &object, nil
+			})
+			if err != nil {
+				return migrated, fmt.Errorf("failed to migrate object %s/%s: %w", bucket.Name, object.ObjectKey, err)
+			}
+			migrated++
+		}
+		log.Printf("Migrated %d objects of bucket %s", len(objects), bucket.Name)
+	}
+	return migrated, nil
+}
+
+// dropStale deletes the entries of dst that aren't among objects.
+func dropStale(dst MetadataStore, bucketPath string, objects []info.Object) error {
+	keep := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		keep[object.ObjectKey] = true
+	}
+
+	existing, err := dst.List(bucketPath)
+	if err != nil {
+		return err
+	}
+	for _, object := range existing {
+		if keep[object.ObjectKey] {
+			continue
+		}
+		err := dst.Update(bucketPath, object.ObjectKey, func(*info.Object) (*info.Object, error) {
+			return nil, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
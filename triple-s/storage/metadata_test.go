@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"triple-s/flags"
+	"triple-s/info"
+	"triple-s/metadata"
+	"triple-s/utils"
+)
+
+func useLogStore(t *testing.T) *metadata.LogStore {
+	t.Helper()
+	previous := Metadata
+	store := metadata.NewLogStore(0)
+	Metadata = store
+	t.Cleanup(func() {
+		store.Close()
+		Metadata = previous
+	})
+	return store
+}
+
+func TestObjects_LogStore(t *testing.T) {
+	quietLogs(t)
+	useLogStore(t)
+	bucketPath := setupBucket(t)
+
+	for i := 0; i < 20; i++ {
+		putObject(t, fmt.Sprintf("file-%02d.txt", i), "text/plain", fmt.Sprintf("content %d", i))
+	}
+	putObject(t, "file-00.txt", "text/plain", "overwritten")
+
+	w := getObject(t, "file-00.txt", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "overwritten" {
+		t.Fatalf("GET: status %d, body %q", w.Code, w.Body.String())
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/"+testBucket+"/file-01.txt", nil)
+	w = httptest.NewRecorder()
+	DeleteObject(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: status %d", w.Code)
+	}
+	if w := getObject(t, "file-01.txt", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET deleted object: status %d, want 404", w.Code)
+	}
+
+	objects, err := Metadata.List(bucketPath)
+	if err != nil || len(objects) != 19 {
+		t.Errorf("List returned %d objects, %v; want 19", len(objects), err)
+	}
+	if _, err := os.Stat(filepath.Join(bucketPath, "objects.log")); err != nil {
+		t.Errorf("objects.log missing: %v", err)
+	}
+}
+
+func TestMigrateMetadata(t *testing.T) {
+	quietLogs(t)
+	flags.Dir = t.TempDir()
+
+	// Two buckets written by the CSV store.
+	var buckets info.Buckets
+	for _, name := range []string{"photos", "videos"} {
+		buckets.Buckets = append(buckets.Buckets, info.Bucket{Name: name, Status: "Available"})
+		bucketPath := GetBucketPath(name)
+		if err := os.MkdirAll(bucketPath, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		objects := info.Objects{Objects: []info.Object{
+			{ObjectKey: name + "-1", ContentType: "text/plain", Size: "1", ETag: "e1"},
+			{ObjectKey: name + "-2", ContentType: "text/plain", Size: "2", ETag: "e2", Metadata: "author=anon"},
+		}}
+		if err := utils.WriteObject(bucketPath, objects); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := utils.WriteBucket(buckets); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := metadata.NewLogStore(0)
+	migrated, err := MigrateMetadata(metadata.NewCSVStore(), dst)
+	if err != nil {
+		t.Fatalf("MigrateMetadata: %v", err)
+	}
+	if migrated != 4 {
+		t.Errorf("migrated %d objects, want 4", migrated)
+	}
+	if err := dst.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh log store sees the same entries, read back from objects.log.
+	store := useLogStore(t)
+	object, err := store.Get(GetBucketPath("videos"), "videos-2")
+	if err != nil {
+		t.Fatalf("Get after migration: %v", err)
+	}
+	if object.ETag != "e2" || object.Metadata != "author=anon" || object.Size != "2" {
+		t.Errorf("migrated entry = %+v", object)
+	}
+
+	// The CSV files stay untouched for a rollback.
+	if _, err := os.Stat(filepath.Join(GetBucketPath("photos"), "objects.csv")); err != nil {
+		t.Errorf("objects.csv removed: %v", err)
+	}
+}
+
+func TestMigrateMetadata_ReplacesDestination(t *testing.T) {
+	quietLogs(t)
+	flags.Dir = t.TempDir()
+	bucketPath := GetBucketPath("photos")
+	if err := os.MkdirAll(bucketPath, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.WriteBucket(info.Buckets{Buckets: []info.Bucket{{Name: "photos", Status: "Available"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// objects.csv as the server left it before switching to the log store.
+	err := utils.WriteObject(bucketPath, info.Objects{Objects: []info.Object{
+		{ObjectKey: "kept", Size: "1", ETag: "old"},
+		{ObjectKey: "deleted", Size: "2", ETag: "gone"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Since then "deleted" was deleted, "kept" replaced and "new" uploaded.
+	src := metadata.NewLogStore(0)
+	defer src.Close()
+	for _, object := range []info.Object{{ObjectKey: "kept", Size: "1", ETag: "new"}, {ObjectKey: "new", Size: "3", ETag: "e3"}} {
+		object := object
+		if err := src.Update(bucketPath, object.ObjectKey, func(*info.Object) (*info.Object, error) { return &object, nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := metadata.NewCSVStore()
+	if _, err := MigrateMetadata(src, dst); err != nil {
+		t.Fatalf("MigrateMetadata: %v", err)
+	}
+
+	objects, err := dst.List(bucketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, object := range objects {
+		got[object.ObjectKey] = object.ETag
+	}
+	if len(got) != 2 || got["kept"] != "new" || got["new"] != "e3" {
+		t.Errorf("destination after migration = %v, want kept=new and new=e3 only", got)
+	}
+}
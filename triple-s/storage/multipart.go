@@ -0,0 +1,621 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"triple-s/info"
+	"triple-s/utils"
+)
+
+// Uploads in progress live in <bucket>/.multipart/<uploadId>: the parts as
+// numbered files next to upload.json, which records the key, the headers
+// of the initiating request and every part received so far. The directory
+// is hidden, so the scrubber and listings never see it.
+const (
+	multipartDir   = ".multipart"
+	uploadManifest = "upload.json"
+	maxPartNumber  = 10000
+)
+
+// minPartSize is the S3 minimum for every part but the last, a variable so
+// tests don't need to upload megabytes.
+var minPartSize int64 = 5 << 20
+
+var (
+	ErrNoSuchUpload     = errors.New("no such upload")
+	errInvalidPart      = errors.New("invalid part")
+	errInvalidPartOrder = errors.New("parts not in ascending order")
+	errEntityTooSmall   = errors.New("part too small")
+	errUploadCompleting = errors.New("upload is being completed")
+)
+
+type multipartUpload struct {
+	Key         string         `json:"key"`
+	ContentType string         `json:"contentType"`
+	Metadata    string         `json:"metadata,omitempty"`
+	Initiated   time.Time      `json:"initiated"`
+	Parts       []uploadedPart `json:"parts"`
+	// Completing is set while CompleteMultipartUpload joins the parts, the
+	// upload takes no parts and can't be aborted meanwhile.
+	Completing *time.Time `json:"completing,omitempty"`
+}
+
+type uploadedPart struct {
+	Number       int       `json:"number"`
+	ETag         string    `json:"etag"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+func uploadPath(bucketPath, uploadID string) string {
+	return filepath.Join(bucketPath, multipartDir, uploadID)
+}
+
+func partPath(bucketPath, uploadID string, partNumber int) string {
+	return filepath.Join(uploadPath(bucketPath, uploadID), fmt.Sprintf("%05d", partNumber))
+}
+
+// lockUploads serialises changes to the uploads of a bucket, one lock per
+// bucket keeps utils.LockFile's table small.
+func lockUploads(bucketPath string) (unlock func()) {
+	return utils.LockFile(filepath.Join(bucketPath, multipartDir))
+}
+
+func newUploadID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// loadUpload reads the manifest of an upload. Upload IDs end up in paths,
+// anything but the IDs newUploadID hands out is refused.
+func loadUpload(bucketPath, uploadID, objectKey string) (*multipartUpload, error) {
+	if id, err := hex.DecodeString(uploadID); err != nil || len(id) != 16 {
+		return nil, ErrNoSuchUpload
+	}
+	data, err := os.ReadFile(filepath.Join(uploadPath(bucketPath, uploadID), uploadManifest))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoSuchUpload
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var upload multipartUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("corrupt upload manifest %s: %w", uploadID, err)
+	}
+	if objectKey != "" && upload.Key != objectKey {
+		return nil, ErrNoSuchUpload
+	}
+	return &upload, nil
+}
+
+func saveUpload(bucketPath, uploadID string, upload *multipartUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(uploadPath(bucketPath, uploadID), uploadManifest), data)
+}
+
+// multipartTarget checks the bucket and key of a multipart request. It
+// writes the error response itself and returns ok false on failure.
+func multipartTarget(w http.ResponseWriter, r *http.Request) (bucketPath, bucketName, objectKey string, ok bool) {
+	bucketName, objectKey = ValidatePath(r.URL.Path)
+	if strings.TrimSpace(bucketName) == "" || strings.TrimSpace(objectKey) == "" {
+		log.Println("Invalid  bucket or object key")
+		ErrXMLResponse(w, http.StatusBadRequest, "Invalid bucket or object key")
+		return "", "", "", false
+	}
+	if err := validateObjectKey(objectKey); err != nil {
+		log.Printf("Rejecting object key %q in bucket %s: %v\n", objectKey, bucketName, err)
+		ErrS3Response(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return "", "", "", false
+	}
+
+	bucketPath = GetBucketPath(bucketName)
+	if _, err := os.Stat(bucketPath); os.IsNotExist(err) {
+		log.Printf("Bucket not found: %s\n", bucketName)
+		ErrXMLResponse(w, http.StatusNotFound, "Bucket not found")
+		return "", "", "", false
+	}
+	return bucketPath, bucketName, objectKey, true
+}
+
+func uploadError(w http.ResponseWriter, err error, uploadID, action string) {
+	// A part racing an abort finds its upload directory gone.
+	if errors.Is(err, ErrNoSuchUpload) || errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Upload %s not found\n", uploadID)
+		ErrS3Response(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+		return
+	}
+	if errors.Is(err, errUploadCompleting) {
+		log.Printf("Upload %s is being completed\n", uploadID)
+		ErrS3Response(w, http.StatusConflict, "OperationAborted", "The upload is being completed")
+		return
+	}
+	log.Printf("Failed to %s of upload %s: %v\n", action, uploadID, err)
+	ErrXMLResponse(w, http.StatusInternalServerError, "Failed to "+action)
+}
+
+// PostObject serves the POST requests on an object, which S3 only uses for
+// multipart uploads: ?uploads starts one and ?uploadId=<id> completes it.
+func PostObject(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch {
+	case query.Has("uploads"):
+		CreateMultipartUpload(w, r)
+	case query.Has("uploadId"):
+		CompleteMultipartUpload(w, r)
+	default:
+		ErrS3Response(w, http.StatusBadRequest, "InvalidArgument", "POST on an object needs ?uploads or ?uploadId")
+	}
+}
+
+func CreateMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	bucketPath, bucketName, objectKey, ok := multipartTarget(w, r)
+	if !ok {
+		return
+	}
+
+	uploadID, err := newUploadID()
+	if err != nil {
+		uploadError(w, err, "", "create upload")
+		return
+	}
+	upload := &multipartUpload{
+		Key:         objectKey,
+		ContentType: r.Header.Get("Content-Type"),
+		Metadata:    EncodeUserMetadata(r.Header),
+		Initiated:   time.Now(),
+	}
+
+	err = os.MkdirAll(uploadPath(bucketPath, uploadID), 0o755)
+	if err == nil {
+		err = saveUpload(bucketPath, uploadID, upload)
+	}
+	if err != nil {
+		uploadError(w, err, uploadID, "create upload")
+		return
+	}
+
+	log.Printf("Multipart upload %s started for object %s in bucket %s", uploadID, objectKey, bucketName)
+	WriteXMLResponse(w, http.StatusOK, info.InitiateMultipartUploadResult{Bucket: bucketName, Key: objectKey, UploadID: uploadID})
+}
+
+// UploadPart stores one part. Sending a part number again replaces it.
+func UploadPart(w http.ResponseWriter, r *http.Request) {
+	bucketPath, bucketName, objectKey, ok := multipartTarget(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+	partNumber, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		ErrS3Response(w, http.StatusBadRequest, "InvalidArgument", fmt.Sprintf("Part number must be an integer between 1 and %d", maxPartNumber))
+		return
+	}
+	wantMD5, err := requestDigest(r.Header, "Content-MD5", md5.Size)
+	if err != nil {
+		ErrS3Response(w, http.StatusBadRequest, "InvalidDigest", "The Content-MD5 you specified is not valid")
+		return
+	}
+	if _, err := loadUpload(bucketPath, uploadID, objectKey); err != nil {
+		uploadError(w, err, uploadID, "upload part")
+		return
+	}
+
+	tmp, err := os.CreateTemp(uploadPath(bucketPath, uploadID), ".part-*")
+	if err != nil {
+		uploadError(w, err, uploadID, "upload part")
+		return
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	defer tmp.Close()
+
+	md5Hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(tmp, md5Hash), r.Body)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		uploadError(w, err, uploadID, "write part data")
+		return
+	}
+	md5Sum := md5Hash.Sum(nil)
+	if wantMD5 != nil && !bytes.Equal(wantMD5, md5Sum) {
+		ErrS3Response(w, http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received")
+		return
+	}
+
+	part := uploadedPart{Number: partNumber, ETag: hex.EncodeToString(md5Sum), Size: size, LastModified: time.Now()}
+
+	// The manifest is read again under the lock, the upload may have been
+	// completed or aborted while the part was arriving.
+	unlock := lockUploads(bucketPath)
+	err = func() error {
+		upload, err := loadUpload(bucketPath, uploadID, objectKey)
+		if err != nil {
+			return err
+		}
+		if upload.Completing != nil {
+			return errUploadCompleting
+		}
+		if err := os.Rename(tmp.Name(), partPath(bucketPath, uploadID, partNumber)); err != nil {
+			return err
+		}
+		i := sort.Search(len(upload.Parts), func(i int) bool { return upload.Parts[i].Number >= partNumber })
+		if i < len(upload.Parts) && upload.Parts[i].Number == partNumber {
+			upload.Parts[i] = part
+		} else {
+			upload.Parts = append(upload.Parts[:i], append([]uploadedPart{part}, upload.Parts[i:]...)...)
+		}
+		return saveUpload(bucketPath, uploadID, upload)
+	}()
+	unlock()
+	if err != nil {
+		uploadError(w, err, uploadID, "upload part")
+		return
+	}
+
+	log.Printf("Part %d of upload %s stored for object %s in bucket %s (%d bytes)", partNumber, uploadID, objectKey, bucketName, size)
+	w.Header().Set("ETag", `"`+part.ETag+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+func ListParts(w http.ResponseWriter, r *http.Request) {
+	bucketPath, bucketName, objectKey, ok := multipartTarget(w, r)
+	if !ok {
+		return
+	}
+
+	uploadID := r.URL.Query().Get("uploadId")
+	upload, err := loadUpload(bucketPath, uploadID, objectKey)
+	if err != nil {
+		uploadError(w, err, uploadID, "list parts")
+		return
+	}
+
+	result := info.ListPartsResult{Bucket: bucketName, Key: objectKey, UploadID: uploadID}
+	for _, part := range upload.Parts {
+		result.Parts = append(result.Parts, info.Part{
+			PartNumber:   part.Number,
+			LastModified: part.LastModified.UTC().Format("2006-01-02T15:04:05.000Z"),
+			ETag:         `"` + part.ETag + `"`,
+			Size:         part.Size,
+		})
+	}
+	WriteXMLResponse(w, http.StatusOK, result)
+}
+
+// CompleteMultipartUpload joins the listed parts into the object. Its ETag
+// is the MD5 of the part MD5s followed by the part count, like S3's, so
+// clients can tell it apart from a single PUT.
+func CompleteMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	bucketPath, bucketName, objectKey, ok := multipartTarget(w, r)
+	if !ok {
+		return
+	}
+
+	uploadID := r.URL.Query().Get("uploadId")
+	var request info.CompleteMultipartUpload
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Parts) == 0 {
+		ErrS3Response(w, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate")
+		return
+	}
+
+	// The upload is only locked while it is marked as completing, the parts
+	// are joined without holding up the other uploads of the bucket.
+	unlock := lockUploads(bucketPath)
+	upload, parts, err := startCompletion(bucketPath, uploadID, objectKey, request.Parts)
+	unlock()
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidPartOrder):
+			ErrS3Response(w, http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order")
+		case errors.Is(err, errEntityTooSmall):
+			ErrS3Response(w, http.StatusBadRequest, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size")
+		case errors.Is(err, errInvalidPart):
+			ErrS3Response(w, http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found")
+		default:
+			uploadError(w, err, uploadID, "complete upload")
+			return
+		}
+		log.Printf("Rejecting completion of upload %s: %v\n", uploadID, err)
+		return
+	}
+	completed := false
+	defer func() {
+		if !completed {
+			cancelCompletion(bucketPath, uploadID)
+		}
+	}()
+
+	tmp, err := os.CreateTemp(bucketPath, ".upload-*")
+	if err != nil {
+		uploadError(w, err, uploadID, "complete upload")
+		return
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	defer tmp.Close()
+
+	newObject, err := joinParts(tmp, bucketPath, uploadID, upload, parts)
+	if err != nil {
+		uploadError(w, err, uploadID, "join parts")
+		return
+	}
+
+	err = Metadata.Update(bucketPath, objectKey, func(*info.Object) (*info.Object, error) {
+		if err := moveObject(tmp.Name(), ObjectPath(bucketPath, objectKey)); err != nil {
+			return nil, err
+		}
+		return newObject, nil
+	})
+	if err != nil {
+		uploadError(w, err, uploadID, "complete upload")
+		return
+	}
+	completed = true
+	if err := os.RemoveAll(uploadPath(bucketPath, uploadID)); err != nil {
+		log.Printf("Failed to remove parts of completed upload %s: %v\n", uploadID, err)
+	}
+
+	log.Printf("Multipart upload %s completed object %s in bucket %s (%d parts, %s bytes)", uploadID, objectKey, bucketName, len(parts), newObject.Size)
+	WriteXMLResponse(w, http.StatusOK, info.CompleteMultipartUploadResult{
+		Location: "/" + bucketName + "/" + objectKey,
+		Bucket:   bucketName,
+		Key:      objectKey,
+		ETag:     `"` + newObject.ETag + `"`,
+	})
+}
+
+// startCompletion checks the parts named by the client and marks the upload
+// as completing. Call it with the uploads of the bucket locked.
+func startCompletion(bucketPath, uploadID, objectKey string, requested []info.CompletedPart) (*multipartUpload, []uploadedPart, error) {
+	upload, err := loadUpload(bucketPath, uploadID, objectKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if upload.Completing != nil {
+		return nil, nil, errUploadCompleting
+	}
+	parts, err := completedParts(upload, requested)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	upload.Completing = &now
+	if err := saveUpload(bucketPath, uploadID, upload); err != nil {
+		return nil, nil, err
+	}
+	return upload, parts, nil
+}
+
+// cancelCompletion reopens an upload whose completion failed, so the client
+// can retry or abort it.
+func cancelCompletion(bucketPath, uploadID string) {
+	unlock := lockUploads(bucketPath)
+	defer unlock()
+
+	upload, err := loadUpload(bucketPath, uploadID, "")
+	if err == nil {
+		upload.Completing = nil
+		err = saveUpload(bucketPath, uploadID, upload)
+	}
+	if err != nil {
+		log.Printf("Failed to reopen upload %s: %v\n", uploadID, err)
+	}
+}
+
+// completedParts matches the parts named by the client against the ones
+// received. Every part but the last must be at least minPartSize.
+func completedParts(upload *multipartUpload, requested []info.CompletedPart) ([]uploadedPart, error) {
+	received := make(map[int]uploadedPart, len(upload.Parts))
+	for _, part := range upload.Parts {
+		received[part.Number] = part
+	}
+
+	parts := make([]uploadedPart, 0, len(requested))
+	for i, req := range requested {
+		if i > 0 && req.PartNumber <= requested[i-1].PartNumber {
+			return nil, errInvalidPartOrder
+		}
+		part, ok := received[req.PartNumber]
+		if !ok || strings.Trim(req.ETag, `"`) != part.ETag {
+			return nil, fmt.Errorf("%w: part %d", errInvalidPart, req.PartNumber)
+		}
+		parts = append(parts, part)
+	}
+	for _, part := range parts[:len(parts)-1] {
+		if part.Size < minPartSize {
+			return nil, fmt.Errorf("%w: part %d has %d bytes", errEntityTooSmall, part.Number, part.Size)
+		}
+	}
+	return parts, nil
+}
+
+// joinParts writes the parts to dst and returns the metadata entry of the
+// resulting object.
+func joinParts(dst *os.File, bucketPath, uploadID string, upload *multipartUpload, parts []uploadedPart) (*info.Object, error) {
+	sha256Hash := sha256.New()
+	partMD5s := md5.New()
+	out := bufio.NewWriter(io.MultiWriter(dst, sha256Hash))
+
+	var size int64
+	var head []byte
+	for _, part := range parts {
+		file, err := os.Open(partPath(bucketPath, uploadID, part.Number))
+		if err != nil {
+			return nil, err
+		}
+		if head == nil {
+			head = make([]byte, 512)
+			n, _ := io.ReadFull(file, head)
+			head = head[:n]
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+		n, err := io.Copy(out, file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		size += n
+
+		sum, _ := hex.DecodeString(part.ETag)
+		partMD5s.Write(sum)
+	}
+	if err := out.Flush(); err != nil {
+		return nil, err
+	}
+	if err := dst.Sync(); err != nil {
+		return nil, err
+	}
+
+	object := &info.Object{
+		ObjectKey:    upload.Key,
+		ContentType:  upload.ContentType,
+		Size:         strconv.FormatInt(size, 10),
+		LastModified: time.Now().Format(time.RFC3339Nano),
+		ETag:         fmt.Sprintf("%s-%d", hex.EncodeToString(partMD5s.Sum(nil)), len(parts)),
+		Metadata:     upload.Metadata,
+		SHA256:       hex.EncodeToString(sha256Hash.Sum(nil)),
+	}
+	if object.ContentType == "" || object.ContentType == "application/octet-stream" {
+		object.ContentType = http.DetectContentType(head)
+	}
+	return object, nil
+}
+
+func AbortMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	bucketPath, bucketName, objectKey, ok := multipartTarget(w, r)
+	if !ok {
+		return
+	}
+
+	uploadID := r.URL.Query().Get("uploadId")
+	unlock := lockUploads(bucketPath)
+	upload, err := loadUpload(bucketPath, uploadID, objectKey)
+	if err == nil && upload.Completing != nil {
+		err = errUploadCompleting
+	}
+	if err == nil {
+		err = os.RemoveAll(uploadPath(bucketPath, uploadID))
+	}
+	unlock()
+	if err != nil {
+		uploadError(w, err, uploadID, "abort upload")
+		return
+	}
+
+	log.Printf("Multipart upload %s aborted for object %s in bucket %s", uploadID, objectKey, bucketName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CleanupMultipartUploads removes the uploads started more than ttl ago
+// that were never completed nor aborted, and returns how many it removed.
+// An upload that can't be cleaned up is logged and skipped, and the
+// failures are returned together once every bucket has been visited.
+func CleanupMultipartUploads(ttl time.Duration) (int, error) {
+	buckets, err := utils.ReadBucket()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read buckets: %w", err)
+	}
+
+	removed := 0
+	var errs []error
+	cutoff := time.Now().Add(-ttl)
+	for _, bucket := range buckets.Buckets {
+		bucketPath := GetBucketPath(bucket.Name)
+		entries, err := os.ReadDir(filepath.Join(bucketPath, multipartDir))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to read uploads in bucket %s: %w", bucket.Name, err)
+			log.Printf("%v", err)
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, entry := range entries {
+			uploadID := entry.Name()
+			unlock := lockUploads(bucketPath)
+			expired, err := uploadExpired(bucketPath, uploadID, cutoff)
+			if err == nil && expired {
+				err = os.RemoveAll(uploadPath(bucketPath, uploadID))
+			}
+			unlock()
+			if err != nil {
+				err = fmt.Errorf("failed to clean up upload %s in bucket %s: %w", uploadID, bucket.Name, err)
+				log.Printf("%v", err)
+				errs = append(errs, err)
+				continue
+			}
+			if expired {
+				log.Printf("Removed abandoned upload %s in bucket %s", uploadID, bucket.Name)
+				removed++
+			}
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// uploadExpired goes by the manifest, or by the directory's age when a
+// crash left an upload without one. An upload being completed expires when
+// its completion started ttl ago, so a crash halfway isn't kept forever.
+func uploadExpired(bucketPath, uploadID string, cutoff time.Time) (bool, error) {
+	upload, err := loadUpload(bucketPath, uploadID, "")
+	if err == nil && upload.Completing != nil {
+		return upload.Completing.Before(cutoff), nil
+	}
+	if err == nil {
+		return upload.Initiated.Before(cutoff), nil
+	}
+	stat, statErr := os.Stat(uploadPath(bucketPath, uploadID))
+	if statErr != nil {
+		return false, statErr
+	}
+	return stat.ModTime().Before(cutoff), nil
+}
+
+// StartMultipartCleaner removes abandoned uploads in the background.
+func StartMultipartCleaner(ttl time.Duration) {
+	go func() {
+		ticker := time.NewTicker(min(ttl, time.Hour))
+		defer ticker.Stop()
+
+		log.Printf("Multipart cleaner started, uploads expire after %s", ttl)
+		for range ticker.C {
+			if _, err := CleanupMultipartUploads(ttl); err != nil {
+				log.Printf("Multipart cleanup failed: %v\n", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"triple-s/info"
+	"triple-s/utils"
+)
+
+func setupMultipart(t *testing.T) string {
+	t.Helper()
+	quietLogs(t)
+	old := minPartSize
+	minPartSize = 4
+	t.Cleanup(func() { minPartSize = old })
+	bucketPath := setupBucket(t)
+	if err := utils.WriteBucket(info.Buckets{Buckets: []info.Bucket{{Name: testBucket, Status: "Available"}}}); err != nil {
+		t.Fatal(err)
+	}
+	return bucketPath
+}
+
+func multipartRequest(t *testing.T, handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, "/"+testBucket+"/"+target, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func startUpload(t *testing.T, key string) string {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/"+testBucket+"/"+key+"?uploads", nil)
+	r.Header.Set("Content-Type", "text/plain")
+	r.Header.Set("X-Amz-Meta-Author", "rick")
+	w := httptest.NewRecorder()
+	PostObject(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("CreateMultipartUpload: status %d: %s", w.Code, w.Body.String())
+	}
+	var result info.InitiateMultipartUploadResult
+	if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil || result.UploadID == "" || result.Key != key {
+		t.Fatalf("CreateMultipartUpload: %v, %s", err, w.Body.String())
+	}
+	return result.UploadID
+}
+
+func uploadPart(t *testing.T, key, uploadID string, partNumber int, data string) string {
+	t.Helper()
+	w := multipartRequest(t, CreateObject, http.MethodPut, fmt.Sprintf("%s?uploadId=%s&partNumber=%d", key, uploadID, partNumber), data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("UploadPart %d: status %d: %s", partNumber, w.Code, w.Body.String())
+	}
+	return w.Header().Get("ETag")
+}
+
+func completeBody(parts ...info.CompletedPart) string {
+	data, _ := xml.Marshal(info.CompleteMultipartUpload{Parts: parts})
+	return string(data)
+}
+
+func TestMultipartUpload(t *testing.T) {
+	bucketPath := setupMultipart(t)
+	key := "videos/2026/clip.txt"
+	uploadID := startUpload(t, key)
+
+	// Out of order and with part 2 replaced, as a retrying client would.
+	etag3 := uploadPart(t, key, uploadID, 3, "third")
+	etag1 := uploadPart(t, key, uploadID, 1, "first-")
+	uploadPart(t, key, uploadID, 2, "lost")
+	etag2 := uploadPart(t, key, uploadID, 2, "second-")
+
+	w := multipartRequest(t, GetObject, http.MethodGet, key+"?uploadId="+uploadID, "")
+	var parts info.ListPartsResult
+	if err := xml.Unmarshal(w.Body.Bytes(), &parts); err != nil || len(parts.Parts) != 3 {
+		t.Fatalf("ListParts: %v, %s", err, w.Body.String())
+	}
+	for i, part := range parts.Parts {
+		if part.PartNumber != i+1 || part.ETag != []string{etag1, etag2, etag3}[i] {
+			t.Errorf("part %d listed as %+v", i+1, part)
+		}
+	}
+	if parts.Parts[1].Size != int64(len("second-")) {
+		t.Errorf("replaced part has size %d", parts.Parts[1].Size)
+	}
+
+	w = multipartRequest(t, PostObject, http.MethodPost, key+"?uploadId="+uploadID, completeBody(
+		info.CompletedPart{PartNumber: 1, ETag: etag1},
+		info.CompletedPart{PartNumber: 2, ETag: etag2},
+		info.CompletedPart{PartNumber: 3, ETag: etag3},
+	))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Complete: status %d: %s", w.Code, w.Body.String())
+	}
+
+	// The composite ETag is the MD5 of the binary part MD5s and the count.
+	composite := md5.New()
+	for _, part := range []string{"first-", "second-", "third"} {
+		sum := md5.Sum([]byte(part))
+		composite.Write(sum[:])
+	}
+	wantETag := `"` + hex.EncodeToString(composite.Sum(nil)) + `-3"`
+	var result info.CompleteMultipartUploadResult
+	if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil || result.ETag != wantETag {
+		t.Errorf("Complete: ETag %s, want %s: %v", result.ETag, wantETag, err)
+	}
+
+	w = getObject(t, key, nil)
+	if w.Body.String() != "first-second-third" || w.Header().Get("ETag") != wantETag {
+		t.Errorf("GET: body %q, ETag %s", w.Body.String(), w.Header().Get("ETag"))
+	}
+	if w.Header().Get("Content-Type") != "text/plain" || w.Header().Get("X-Amz-Meta-Author") != "rick" {
+		t.Errorf("headers of the initiating request lost: %v", w.Header())
+	}
+
+	if _, err := os.Stat(uploadPath(bucketPath, uploadID)); !os.IsNotExist(err) {
+		t.Errorf("parts left after completion: %v", err)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(bucketPath, ".upload-*")); len(tmp) != 0 {
+		t.Errorf("temporary files left behind: %v", tmp)
+	}
+
+	// A multipart object is an ordinary object to the scrubber.
+	if report, err := Scrub(false); err != nil || len(report.Issues) != 0 {
+		t.Errorf("scrub after completion: %+v, %v", report.Issues, err)
+	}
+}
+
+func TestMultipartUpload_Errors(t *testing.T) {
+	setupMultipart(t)
+	key := "big.bin"
+	uploadID := startUpload(t, key)
+	etag1 := uploadPart(t, key, uploadID, 1, "12")
+	etag2 := uploadPart(t, key, uploadID, 2, "3456")
+
+	tests := []struct {
+		name, target, body string
+		handler            http.HandlerFunc
+		wantStatus         int
+		wantCode           string
+	}{
+		{"unknown upload", key + "?uploadId=00000000000000000000000000000000&partNumber=1", "x", CreateObject, http.StatusNotFound, "NoSuchUpload"},
+		{"upload id as path", key + "?uploadId=../../escape&partNumber=1", "x", CreateObject, http.StatusNotFound, "NoSuchUpload"},
+		{"other key", "other.bin?uploadId=" + uploadID + "&partNumber=1", "x", CreateObject, http.StatusNotFound, "NoSuchUpload"},
+		{"part number", key + "?uploadId=" + uploadID + "&partNumber=10001", "x", CreateObject, http.StatusBadRequest, "InvalidArgument"},
+		{"malformed xml", key + "?uploadId=" + uploadID, "<Complete", PostObject, http.StatusBadRequest, "MalformedXML"},
+		{"wrong etag", key + "?uploadId=" + uploadID, completeBody(info.CompletedPart{PartNumber: 1, ETag: etag2}), PostObject, http.StatusBadRequest, "InvalidPart"},
+		{"missing part", key + "?uploadId=" + uploadID, completeBody(info.CompletedPart{PartNumber: 3, ETag: etag1}), PostObject, http.StatusBadRequest, "InvalidPart"},
+		{"order", key + "?uploadId=" + uploadID, completeBody(info.CompletedPart{PartNumber: 2, ETag: etag2}, info.CompletedPart{PartNumber: 1, ETag: etag1}), PostObject, http.StatusBadRequest, "InvalidPartOrder"},
+		{"too small", key + "?uploadId=" + uploadID, completeBody(info.CompletedPart{PartNumber: 1, ETag: etag1}, info.CompletedPart{PartNumber: 2, ETag: etag2}), PostObject, http.StatusBadRequest, "EntityTooSmall"},
+	}
+	for _, tt := range tests {
+		method := http.MethodPut
+		if tt.body != "x" {
+			method = http.MethodPost
+		}
+		w := multipartRequest(t, tt.handler, method, tt.target, tt.body)
+		if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), "<Code>"+tt.wantCode+"</Code>") {
+			t.Errorf("%s: status %d, body %s; want %d %s", tt.name, w.Code, w.Body.String(), tt.wantStatus, tt.wantCode)
+		}
+	}
+
+	// Failed completions leave the upload as it was.
+	w := multipartRequest(t, PostObject, http.MethodPost, key+"?uploadId="+uploadID, completeBody(info.CompletedPart{PartNumber: 2, ETag: etag2}))
+	if w.Code != http.StatusOK {
+		t.Errorf("Complete with the last part only: status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// While the parts are joined the upload is marked as completing, outside the
+// bucket's upload lock. It takes no parts and no abort meanwhile, and is
+// reopened when the completion fails.
+func TestCompleteMultipartUpload_Completing(t *testing.T) {
+	bucketPath := setupMultipart(t)
+	key := "joined.bin"
+	uploadID := startUpload(t, key)
+	etag1 := uploadPart(t, key, uploadID, 1, "1234")
+	etag2 := uploadPart(t, key, uploadID, 2, "56")
+	parts := []info.CompletedPart{{PartNumber: 1, ETag: etag1}, {PartNumber: 2, ETag: etag2}}
+
+	if _, _, err := startCompletion(bucketPath, uploadID, key, parts); err != nil {
+		t.Fatalf("startCompletion: %v", err)
+	}
+	conflicts := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+	}{
+		{"part", CreateObject, http.MethodPut, key + "?uploadId=" + uploadID + "&partNumber=2", "late"},
+		{"abort", DeleteObject, http.MethodDelete, key + "?uploadId=" + uploadID, ""},
+		{"second completion", PostObject, http.MethodPost, key + "?uploadId=" + uploadID, completeBody(parts...)},
+	}
+	for _, tt := range conflicts {
+		w := multipartRequest(t, tt.handler, tt.method, tt.target, tt.body)
+		if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "<Code>OperationAborted</Code>") {
+			t.Errorf("%s while completing: status %d, body %s; want 409 OperationAborted", tt.name, w.Code, w.Body.String())
+		}
+	}
+	// Other uploads of the bucket go on.
+	other := startUpload(t, "other.bin")
+	uploadPart(t, "other.bin", other, 1, "data")
+
+	cancelCompletion(bucketPath, uploadID)
+	if err := os.Remove(partPath(bucketPath, uploadID, 2)); err != nil {
+		t.Fatal(err)
+	}
+	w := multipartRequest(t, PostObject, http.MethodPost, key+"?uploadId="+uploadID, completeBody(parts...))
+	if w.Code == http.StatusOK {
+		t.Error("Complete with a part gone succeeded")
+	}
+	w = multipartRequest(t, DeleteObject, http.MethodDelete, key+"?uploadId="+uploadID, "")
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Abort after a failed completion: status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAbortMultipartUpload(t *testing.T) {
+	bucketPath := setupMultipart(t)
+	uploadID := startUpload(t, "aborted.bin")
+	uploadPart(t, "aborted.bin", uploadID, 1, "data")
+
+	w := multipartRequest(t, DeleteObject, http.MethodDelete, "aborted.bin?uploadId="+uploadID, "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Abort: status %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(uploadPath(bucketPath, uploadID)); !os.IsNotExist(err) {
+		t.Errorf("parts left after abort: %v", err)
+	}
+
+	w = multipartRequest(t, CreateObject, http.MethodPut, "aborted.bin?uploadId="+uploadID+"&partNumber=2", "late")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("part after abort: status %d", w.Code)
+	}
+	w = multipartRequest(t, DeleteObject, http.MethodDelete, "aborted.bin?uploadId="+uploadID, "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("second abort: status %d", w.Code)
+	}
+	if w := getObject(t, "aborted.bin", nil); w.Code != http.StatusNotFound {
+		t.Errorf("aborted upload created the object: status %d", w.Code)
+	}
+}
+
+func TestCleanupMultipartUploads(t *testing.T) {
+	bucketPath := setupMultipart(t)
+
+	stale := startUpload(t, "stale.bin")
+	fresh := startUpload(t, "fresh.bin")
+	upload, err := loadUpload(bucketPath, stale, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload.Initiated = time.Now().Add(-48 * time.Hour)
+	if err := saveUpload(bucketPath, stale, upload); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash between creating the directory and writing the manifest.
+	broken := filepath.Join(bucketPath, multipartDir, "broken")
+	if err := os.Mkdir(broken, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(broken, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := CleanupMultipartUploads(24 * time.Hour)
+	if err != nil || removed != 2 {
+		t.Fatalf("CleanupMultipartUploads: removed %d, %v; want 2", removed, err)
+	}
+	if _, err := loadUpload(bucketPath, fresh, ""); err != nil {
+		t.Errorf("fresh upload removed: %v", err)
+	}
+	if _, err := loadUpload(bucketPath, stale, ""); err != ErrNoSuchUpload {
+		t.Errorf("stale upload kept: %v", err)
+	}
+}
+
+func TestCleanupMultipartUploadsSkipsFailures(t *testing.T) {
+	bucketPath := setupMultipart(t)
+
+	stale := startUpload(t, "stale.bin")
+	upload, err := loadUpload(bucketPath, stale, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload.Initiated = time.Now().Add(-48 * time.Hour)
+	if err := saveUpload(bucketPath, stale, upload); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dangling link can't be stat'ed, and it is listed before the upload.
+	dangling := filepath.Join(bucketPath, multipartDir, "0")
+	if err := os.Symlink(filepath.Join(t.TempDir(), "missing"), dangling); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := CleanupMultipartUploads(24 * time.Hour)
+	if err == nil || removed != 1 {
+		t.Fatalf("CleanupMultipartUploads: removed %d, %v; want 1 and an error", removed, err)
+	}
+	if _, err := loadUpload(bucketPath, stale, ""); err != ErrNoSuchUpload {
+		t.Errorf("stale upload kept: %v", err)
+	}
+}
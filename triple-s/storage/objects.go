@@ -1,20 +1,30 @@
 package storage
 
 import (
-	"fmt"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"io"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 	"triple-s/info"
-	"triple-s/utils"
 )
 
 func CreateObject(w http.ResponseWriter, r *http.Request) {
+	// A PUT with ?uploadId is a part of a multipart upload.
+	if r.URL.Query().Has("uploadId") {
+		UploadPart(w, r)
+		return
+	}
+
 	bucketName, objectKey := ValidatePath(r.URL.Path)
 	if strings.TrimSpace(bucketName) == "" || strings.TrimSpace(objectKey) == "" {
 		log.Println("Invalid  bucket or object key")
@@ -22,6 +32,16 @@ func CreateObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := validateObjectKey(objectKey); err != nil {
+		log.Printf("Rejecting object key %q in bucket %s: %v\n", objectKey, bucketName, err)
+		errorCode := "InvalidArgument"
+		if errors.Is(err, errKeyTooLong) {
+			errorCode = "KeyTooLongError"
+		}
+		ErrS3Response(w, http.StatusBadRequest, errorCode, err.Error())
+		return
+	}
+
 	bucketPath := GetBucketPath(bucketName)
 	if _, err := os.Stat(bucketPath); os.IsNotExist(err) {
 		log.Printf("Bucket not found: %s\n", bucketName)
@@ -29,62 +49,123 @@ func CreateObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	objects, err := utils.ReadObjects(bucketPath)
-	fmt.Println(objects)
+	// Malformed digests are refused before reading the body, mismatching
+	// ones once it has been hashed.
+	wantMD5, err := requestDigest(r.Header, "Content-MD5", md5.Size)
 	if err != nil {
-		log.Printf("Failed to read objects file for bucket %s: %v\n", bucketName, err)
-		ErrXMLResponse(w, http.StatusInternalServerError, "Internal server error")
+		log.Printf("Rejecting object %s in bucket %s: %v\n", objectKey, bucketName, err)
+		ErrS3Response(w, http.StatusBadRequest, "InvalidDigest", "The Content-MD5 you specified is not valid")
 		return
 	}
-
-	objectIDX := SearchObjectIDX(objects.Objects, objectKey)
-	if objectIDX != -1 {
-		objects.Objects = append(objects.Objects[:objectIDX], objects.Objects[objectIDX+1:]...)
+	wantSHA256, err := requestDigest(r.Header, "X-Amz-Checksum-Sha256", sha256.Size)
+	if err != nil {
+		log.Printf("Rejecting object %s in bucket %s: %v\n", objectKey, bucketName, err)
+		ErrS3Response(w, http.StatusBadRequest, "InvalidDigest", "The x-amz-checksum-sha256 you specified is not valid")
+		return
 	}
 
-	objectPath := filepath.Join(bucketPath, objectKey)
-	file, err := os.Create(objectPath)
+	// The body goes to a temporary file first so a concurrent GET never sees
+	// a half-written object, then it is renamed into place together with the
+	// metadata update.
+	tmp, err := os.CreateTemp(bucketPath, ".upload-*")
 	if err != nil {
 		log.Printf("Failed to create object %s in bucket %s: %v\n", objectKey, bucketName, err)
 		ErrXMLResponse(w, http.StatusInternalServerError, "Failed to create object")
 		return
 	}
-	defer file.Close()
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	defer tmp.Close()
 
-	_, err = io.Copy(file, r.Body)
+	// Size comes from the bytes actually written, Content-Length is -1 for
+	// chunked uploads.
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, md5Hash, sha256Hash), r.Body)
+	if err == nil {
+		err = tmp.Sync()
+	}
 	if err != nil {
 		log.Printf("Failed to write object data for %s in bucket %s: %v\n", objectKey, bucketName, err)
 		ErrXMLResponse(w, http.StatusInternalServerError, "Failed to write object data")
 		return
 	}
 
+	md5Sum, sha256Sum := md5Hash.Sum(nil), sha256Hash.Sum(nil)
+	if wantMD5 != nil && !bytes.Equal(wantMD5, md5Sum) {
+		log.Printf("Content-MD5 mismatch for object %s in bucket %s\n", objectKey, bucketName)
+		ErrS3Response(w, http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received")
+		return
+	}
+	if wantSHA256 != nil && !bytes.Equal(wantSHA256, sha256Sum) {
+		log.Printf("x-amz-checksum-sha256 mismatch for object %s in bucket %s\n", objectKey, bucketName)
+		ErrS3Response(w, http.StatusBadRequest, "BadDigest", "The x-amz-checksum-sha256 you specified did not match what we received")
+		return
+	}
+
 	newObject := info.Object{
 		ObjectKey:    objectKey,
 		ContentType:  r.Header.Get("Content-Type"),
-		Size:         strconv.FormatInt(r.ContentLength, 10),
+		Size:         strconv.FormatInt(size, 10),
 		LastModified: time.Now().Format(time.RFC3339Nano),
+		ETag:         hex.EncodeToString(md5Sum),
+		Metadata:     EncodeUserMetadata(r.Header),
+		SHA256:       hex.EncodeToString(sha256Sum),
 	}
 
 	if newObject.ContentType == "" {
 		newObject.ContentType = "application/octet-stream"
 	}
 
-	objects.Objects = append(objects.Objects, newObject)
-	fmt.Println(objects)
-	err = utils.WriteObject(bucketName, objects)
+	// If-None-Match: * only creates, checked under the bucket lock so two
+	// racing uploads can't both succeed.
+	createOnly := r.Header.Get("If-None-Match") == "*"
+	objectPath := ObjectPath(bucketPath, objectKey)
+	err = Metadata.Update(bucketPath, objectKey, func(existing *info.Object) (*info.Object, error) {
+		if createOnly && existing != nil {
+			return nil, errObjectExists
+		}
+		if err := moveObject(tmp.Name(), objectPath); err != nil {
+			return nil, err
+		}
+		return &newObject, nil
+	})
 	if err != nil {
+		if errors.Is(err, errObjectExists) {
+			log.Printf("Object %s already exists in bucket %s, not overwritten\n", objectKey, bucketName)
+			ErrS3Response(w, http.StatusPreconditionFailed, "PreconditionFailed", "The object already exists")
+			return
+		}
+		// The bucket can be deleted while the body was uploading.
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Bucket not found: %s\n", bucketName)
+			ErrXMLResponse(w, http.StatusNotFound, "Bucket not found")
+			return
+		}
 		log.Printf("Failed to update objects file for bucket %s: %v\n", bucketName, err)
 		ErrXMLResponse(w, http.StatusInternalServerError, "Internal server error")
 		return
 	}
-	log.Printf("Object %s created successfully in bucket %s", objectKey, bucketName)
+	w.Header().Set("ETag", `"`+newObject.ETag+`"`)
+	w.Header().Set("X-Amz-Checksum-Sha256", base64.StdEncoding.EncodeToString(sha256Sum))
+	log.Printf("Object %s created successfully in bucket %s (%d bytes)", objectKey, bucketName, size)
 	ErrXMLResponse(w, http.StatusOK, "Object created successfully")
 }
 
 func ListObjects(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		HeadBucket(w, r)
+		return
+	}
+
 	bucketName := strings.TrimPrefix(r.URL.Path, "/")
+	params, err := parseListParams(r.URL.Query())
+	if err != nil {
+		log.Printf("Invalid list parameters for bucket %s: %s\n", bucketName, r.URL.RawQuery)
+		ErrS3Response(w, http.StatusBadRequest, "InvalidArgument", "Invalid max-keys or continuation-token")
+		return
+	}
+
 	bucketPath := GetBucketPath(bucketName)
-	objectsData, err := utils.ReadObjects(bucketPath)
+	objects, err := Metadata.List(bucketPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			log.Printf("Bucket not found: %s\n", bucketName)
@@ -96,11 +177,18 @@ func ListObjects(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Objects listed successfully for bucket %s", bucketName)
-	WriteXMLResponse(w, http.StatusOK, objectsData)
+	result := listObjectsV2(bucketName, objects, params)
+	log.Printf("Listed %d keys of bucket %s", result.KeyCount, bucketName)
+	WriteXMLResponse(w, http.StatusOK, result)
 }
 
 func GetObject(w http.ResponseWriter, r *http.Request) {
+	// A GET with ?uploadId lists the parts of a multipart upload.
+	if r.URL.Query().Has("uploadId") {
+		ListParts(w, r)
+		return
+	}
+
 	bucketName, objectKey := ValidatePath(r.URL.Path)
 	if strings.TrimSpace(bucketName) == "" || strings.TrimSpace(objectKey) == "" {
 		log.Println("Invalid  bucket or object key")
@@ -115,34 +203,59 @@ func GetObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	objectPath := filepath.Join(bucketPath, objectKey)
-	file, err := os.Open(objectPath)
+	object, err := GetObjectMeta(bucketPath, objectKey)
 	if err != nil {
-		log.Printf("Failed to open object %s in bucket %s: %v\n", objectKey, bucketName, err)
-		ErrXMLResponse(w, http.StatusInternalServerError, "Failed to open object")
+		if errors.Is(err, ErrObjectNotFound) {
+			log.Printf("Object not found: %s\n", objectKey)
+			ErrXMLResponse(w, http.StatusNotFound, "Object not found")
+			return
+		}
+		log.Printf("Failed to get metadata for object %s in bucket %s: %v\n", objectKey, bucketName, err)
+		ErrXMLResponse(w, http.StatusInternalServerError, "Failed to get object metadata")
 		return
 	}
-	defer file.Close()
 
-	metaDataType, err := GetMetaDataType(bucketPath, objectKey)
+	objectPath := ObjectPath(bucketPath, objectKey)
+	file, err := os.Open(objectPath)
 	if err != nil {
-		log.Printf("Failed to get metadata type for object %s in bucket %s: %v\n", objectKey, bucketName, err)
-		ErrXMLResponse(w, http.StatusInternalServerError, "Failed to get metadata type")
+		if os.IsNotExist(err) {
+			log.Printf("Object %s is in metadata but missing on disk in bucket %s\n", objectKey, bucketName)
+			ErrXMLResponse(w, http.StatusNotFound, "Object not found")
+			return
+		}
+		log.Printf("Failed to open object %s in bucket %s: %v\n", objectKey, bucketName, err)
+		ErrXMLResponse(w, http.StatusInternalServerError, "Failed to open object")
 		return
 	}
+	defer file.Close()
 
-	w.Header().Set("Content-Type", metaDataType)
-	_, err = io.Copy(w, file)
+	stat, err := file.Stat()
 	if err != nil {
-		log.Printf("Failed to read object %s in bucket %s: %v\n", objectKey, bucketName, err)
+		log.Printf("Failed to stat object %s in bucket %s: %v\n", objectKey, bucketName, err)
 		ErrXMLResponse(w, http.StatusInternalServerError, "Failed to read object")
 		return
 	}
 
-	log.Printf("Object %s read successfully in bucket %s", objectKey, bucketName)
+	// ServeContent takes care of Range, If-None-Match, If-Modified-Since,
+	// Content-Length and of leaving the body out for HEAD.
+	modTime := SetObjectHeaders(w.Header(), object, stat.ModTime())
+	http.ServeContent(w, r, objectKey, modTime, file)
+
+	log.Printf("Object %s read successfully in bucket %s (%s)", objectKey, bucketName, r.Method)
+}
+
+// HeadObject answers with the same headers as GetObject, without the body.
+func HeadObject(w http.ResponseWriter, r *http.Request) {
+	GetObject(w, r)
 }
 
 func DeleteObject(w http.ResponseWriter, r *http.Request) {
+	// A DELETE with ?uploadId aborts a multipart upload.
+	if r.URL.Query().Has("uploadId") {
+		AbortMultipartUpload(w, r)
+		return
+	}
+
 	bucketName, objectKey := ValidatePath(r.URL.Path)
 	if strings.TrimSpace(bucketName) == "" || strings.TrimSpace(objectKey) == "" {
 		log.Println("Invalid  bucket or object key")
@@ -157,43 +270,25 @@ func DeleteObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	objectPath := filepath.Join(bucketPath, objectKey)
-	if _, err := os.Stat(objectPath); err != nil {
-		if os.IsNotExist(err) {
-			log.Printf("Object not found: %s\n", objectKey)
+	objectPath := ObjectPath(bucketPath, objectKey)
+	err := Metadata.Update(bucketPath, objectKey, func(current *info.Object) (*info.Object, error) {
+		if current == nil {
+			return nil, ErrObjectNotFound
+		}
+		// Removed under the lock, otherwise a concurrent PUT of the same key
+		// could have its fresh file deleted. A file that is already gone is
+		// fine, the metadata entry is what makes the object exist.
+		if err := os.Remove(objectPath); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			log.Printf("Object %s not found in bucket %s\n", objectKey, bucketName)
 			ErrXMLResponse(w, http.StatusNotFound, "Object not found")
 			return
-		} else {
-			log.Printf("Error with getting stats of object")
-			ErrXMLResponse(w, http.StatusInternalServerError, "Internal Server Error")
-			return
 		}
-	}
-
-	objects, err := utils.ReadObjects(bucketPath)
-	if err != nil {
-		log.Printf("Failed to read objects file for bucket %s: %v\n", bucketName, err)
-		ErrXMLResponse(w, http.StatusInternalServerError, "Internal server error")
-		return
-	}
-
-	objectIDX := SearchObjectIDX(objects.Objects, objectKey)
-	if objectIDX == -1 {
-		log.Printf("Object %s not found in bucket %s\n", objectKey, bucketName)
-		ErrXMLResponse(w, http.StatusNotFound, "Object not found")
-		return
-	}
-
-	objects.Objects = append(objects.Objects[:objectIDX], objects.Objects[objectIDX+1:]...)
-	err = utils.WriteObject(bucketName, objects)
-	if err != nil {
-		log.Printf("Failed to update objects file for bucket %s: %v\n", bucketName, err)
-		ErrXMLResponse(w, http.StatusInternalServerError, "Internal server error")
-		return
-	}
-
-	err = os.Remove(objectPath)
-	if err != nil {
 		log.Printf("Failed to delete object %s in bucket %s: %v\n", objectKey, bucketName, err)
 		ErrXMLResponse(w, http.StatusInternalServerError, "Failed to delete object")
 		return
@@ -0,0 +1,453 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"triple-s/flags"
+	"triple-s/info"
+	"triple-s/utils"
+)
+
+const testBucket = "test-bucket"
+
+func setupBucket(t *testing.T) string {
+	t.Helper()
+	flags.Dir = t.TempDir()
+	if err := InitObjectFile(testBucket); err != nil {
+		t.Fatalf("failed to init bucket: %v", err)
+	}
+	return GetBucketPath(testBucket)
+}
+
+func putObject(t *testing.T, key, contentType, body string) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPut, "/"+testBucket+"/"+key, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	CreateObject(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT %s: status %d, body %s", key, w.Code, w.Body.String())
+	}
+}
+
+func getObject(t *testing.T, key string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/"+testBucket+"/"+key, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	GetObject(w, r)
+	return w
+}
+
+func TestCreateObject_StoresETag(t *testing.T) {
+	bucketPath := setupBucket(t)
+	body := "hello, triple-s"
+	putObject(t, "hello.txt", "text/plain", body)
+
+	objects, err := utils.ReadObjects(bucketPath)
+	if err != nil {
+		t.Fatalf("failed to read objects.csv: %v", err)
+	}
+	if len(objects.Objects) != 1 {
+		t.Fatalf("expected 1 object in metadata, got %d", len(objects.Objects))
+	}
+
+	sum := md5.Sum([]byte(body))
+	if got, want := objects.Objects[0].ETag, hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("ETag = %q, want %q", got, want)
+	}
+}
+
+func TestCreateObject_DefaultContentType(t *testing.T) {
+	bucketPath := setupBucket(t)
+	putObject(t, "image", "", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	object, err := GetObjectMeta(bucketPath, "image")
+	if err != nil {
+		t.Fatalf("GetObjectMeta: %v", err)
+	}
+	if object.ContentType != "application/octet-stream" {
+		t.Errorf("ContentType = %q, want application/octet-stream", object.ContentType)
+	}
+}
+
+func TestGetObject_Full(t *testing.T) {
+	setupBucket(t)
+	body := "0123456789abcdefghij"
+	putObject(t, "digits.txt", "text/plain", body)
+
+	w := getObject(t, "digits.txt", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if w.Body.String() != body {
+		t.Errorf("body = %q, want %q", w.Body.String(), body)
+	}
+	if got := w.Header().Get("Content-Length"); got != "20" {
+		t.Errorf("Content-Length = %q, want 20", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/plain" {
+		t.Errorf("Content-Type = %q, want text/plain", got)
+	}
+	if got := w.Header().Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("Accept-Ranges = %q, want bytes", got)
+	}
+	if w.Header().Get("ETag") == "" || w.Header().Get("Last-Modified") == "" {
+		t.Errorf("expected ETag and Last-Modified, got %v", w.Header())
+	}
+}
+
+func TestGetObject_Range(t *testing.T) {
+	setupBucket(t)
+	putObject(t, "digits.txt", "text/plain", "0123456789abcdefghij")
+
+	tests := []struct {
+		name         string
+		rangeHeader  string
+		wantStatus   int
+		wantBody     string
+		contentRange string
+	}{
+		{"prefix", "bytes=0-4", http.StatusPartialContent, "01234", "bytes 0-4/20"},
+		{"middle", "bytes=10-12", http.StatusPartialContent, "abc", "bytes 10-12/20"},
+		{"open ended", "bytes=17-", http.StatusPartialContent, "hij", "bytes 17-19/20"},
+		{"suffix", "bytes=-2", http.StatusPartialContent, "ij", "bytes 18-19/20"},
+		{"unsatisfiable", "bytes=50-60", http.StatusRequestedRangeNotSatisfiable, "", "bytes */20"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := getObject(t, "digits.txt", http.Header{"Range": {tt.rangeHeader}})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Content-Range"); got != tt.contentRange {
+				t.Errorf("Content-Range = %q, want %q", got, tt.contentRange)
+			}
+			if tt.wantStatus == http.StatusPartialContent && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestGetObject_MultiRange(t *testing.T) {
+	setupBucket(t)
+	putObject(t, "digits.txt", "text/plain", "0123456789abcdefghij")
+
+	w := getObject(t, "digits.txt", http.Header{"Range": {"bytes=0-1,10-11"}})
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", w.Code)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Content-Type = %q, want multipart/byteranges", w.Header().Get("Content-Type"))
+	}
+
+	reader := multipart.NewReader(w.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		if got := part.Header.Get("Content-Type"); got != "text/plain" {
+			t.Errorf("part Content-Type = %q, want text/plain", got)
+		}
+		data, _ := io.ReadAll(part)
+		parts = append(parts, string(data))
+	}
+
+	if len(parts) != 2 || parts[0] != "01" || parts[1] != "ab" {
+		t.Errorf("parts = %q, want [01 ab]", parts)
+	}
+}
+
+func TestGetObject_Conditional(t *testing.T) {
+	setupBucket(t)
+	putObject(t, "digits.txt", "text/plain", "0123456789")
+
+	first := getObject(t, "digits.txt", nil)
+	etag := first.Header().Get("ETag")
+	lastModified := first.Header().Get("Last-Modified")
+
+	tests := []struct {
+		name       string
+		header     http.Header
+		wantStatus int
+	}{
+		{"matching etag", http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+		{"wildcard etag", http.Header{"If-None-Match": {"*"}}, http.StatusNotModified},
+		{"stale etag", http.Header{"If-None-Match": {`"deadbeef"`}}, http.StatusOK},
+		{"not modified since", http.Header{"If-Modified-Since": {lastModified}}, http.StatusNotModified},
+		{"modified since", http.Header{"If-Modified-Since": {time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}}, http.StatusOK},
+		// If-None-Match wins over If-Modified-Since when both are sent.
+		{"stale etag beats date", http.Header{"If-None-Match": {`"deadbeef"`}, "If-Modified-Since": {lastModified}}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := getObject(t, "digits.txt", tt.header)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 response has a body: %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetObject_LegacyMetadata(t *testing.T) {
+	bucketPath := setupBucket(t)
+
+	// A bucket written before ETags were stored: four columns, no hash.
+	metadata := "ObjectKey,ContentType,Size,LastModified\nold.txt,text/plain,3,2024-01-02T15:04:05Z\n"
+	if err := os.WriteFile(filepath.Join(bucketPath, "objects.csv"), []byte(metadata), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Stored flat in the bucket directory as well, before keys were hashed.
+	if err := os.WriteFile(filepath.Join(bucketPath, "old.txt"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if moved, err := migrateBucketLayout(bucketPath); err != nil || moved != 1 {
+		t.Fatalf("migrateBucketLayout: moved %d, %v", moved, err)
+	}
+
+	w := getObject(t, "old.txt", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "old" {
+		t.Fatalf("status = %d, body = %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("ETag"); got != "" {
+		t.Errorf("ETag = %q, want none", got)
+	}
+	if got := w.Header().Get("Last-Modified"); got != "Tue, 02 Jan 2024 15:04:05 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+
+	w = getObject(t, "old.txt", http.Header{"If-Modified-Since": {"Tue, 02 Jan 2024 15:04:05 GMT"}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want 304", w.Code)
+	}
+}
+
+func TestGetObject_NotFound(t *testing.T) {
+	bucketPath := setupBucket(t)
+
+	if w := getObject(t, "missing.txt", nil); w.Code != http.StatusNotFound {
+		t.Errorf("missing object: status = %d, want 404", w.Code)
+	}
+
+	putObject(t, "gone.txt", "text/plain", "data")
+	if err := os.Remove(ObjectPath(bucketPath, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if w := getObject(t, "gone.txt", nil); w.Code != http.StatusNotFound {
+		t.Errorf("object missing on disk: status = %d, want 404", w.Code)
+	}
+}
+
+func TestHeadObject(t *testing.T) {
+	setupBucket(t)
+
+	r := httptest.NewRequest(http.MethodPut, "/"+testBucket+"/meta.txt", strings.NewReader("with metadata"))
+	r.Header.Set("Content-Type", "text/plain")
+	r.Header.Set("X-Amz-Meta-Author", "anon")
+	r.Header.Set("X-Amz-Meta-Post-Id", "42")
+	w := httptest.NewRecorder()
+	CreateObject(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d", w.Code)
+	}
+
+	// A plain recorder keeps whatever is written, so the test also covers
+	// that HEAD never produces a body.
+	r = httptest.NewRequest(http.MethodHead, "/"+testBucket+"/meta.txt", nil)
+	w = httptest.NewRecorder()
+	HeadObject(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("HEAD response has a body: %q", w.Body.String())
+	}
+
+	sum := md5.Sum([]byte("with metadata"))
+	want := map[string]string{
+		"Content-Type":       "text/plain",
+		"Content-Length":     "13",
+		"ETag":               `"` + hex.EncodeToString(sum[:]) + `"`,
+		"X-Amz-Meta-Author":  "anon",
+		"X-Amz-Meta-Post-Id": "42",
+	}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if w.Header().Get("Last-Modified") == "" {
+		t.Error("missing Last-Modified")
+	}
+
+	r = httptest.NewRequest(http.MethodHead, "/"+testBucket+"/missing.txt", nil)
+	w = httptest.NewRecorder()
+	HeadObject(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing object: status = %d, want 404", w.Code)
+	}
+}
+
+func TestHeadBucket(t *testing.T) {
+	setupBucket(t)
+	err := utils.WriteBucket(info.Buckets{Buckets: []info.Bucket{{
+		Name:             testBucket,
+		CreationTime:     "2024-01-02T15:04:05Z",
+		LastModifiedTime: "2024-01-02T15:04:05Z",
+		Status:           "Available",
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		bucket     string
+		wantStatus int
+	}{
+		{testBucket, http.StatusOK},
+		{"no-such-bucket", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodHead, "/"+tt.bucket, nil)
+		w := httptest.NewRecorder()
+		HeadBucket(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.bucket, w.Code, tt.wantStatus)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("%s: HEAD response has a body: %q", tt.bucket, w.Body.String())
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodHead, "/"+testBucket, nil)
+	w := httptest.NewRecorder()
+	HeadBucket(w, r)
+	if got := w.Header().Get("Last-Modified"); got != "Tue, 02 Jan 2024 15:04:05 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+}
+
+func TestCreateObject_Digests(t *testing.T) {
+	quietLogs(t)
+	body := "checksummed body"
+	md5Sum := md5.Sum([]byte(body))
+	sha256Sum := sha256.Sum256([]byte(body))
+	goodMD5 := base64.StdEncoding.EncodeToString(md5Sum[:])
+	goodSHA256 := base64.StdEncoding.EncodeToString(sha256Sum[:])
+	otherMD5 := md5.Sum([]byte("something else"))
+	otherSHA256 := sha256.Sum256([]byte("something else"))
+
+	tests := []struct {
+		name       string
+		header     map[string]string
+		wantStatus int
+		wantCode   string
+	}{
+		{"no digests", nil, http.StatusOK, ""},
+		{"matching md5", map[string]string{"Content-MD5": goodMD5}, http.StatusOK, ""},
+		{"matching sha256", map[string]string{"X-Amz-Checksum-Sha256": goodSHA256}, http.StatusOK, ""},
+		{"both matching", map[string]string{"Content-MD5": goodMD5, "X-Amz-Checksum-Sha256": goodSHA256}, http.StatusOK, ""},
+		{"md5 mismatch", map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(otherMD5[:])}, http.StatusBadRequest, "BadDigest"},
+		{"sha256 mismatch", map[string]string{"Content-MD5": goodMD5, "X-Amz-Checksum-Sha256": base64.StdEncoding.EncodeToString(otherSHA256[:])}, http.StatusBadRequest, "BadDigest"},
+		{"md5 not base64", map[string]string{"Content-MD5": "not-base64!"}, http.StatusBadRequest, "InvalidDigest"},
+		{"md5 wrong length", map[string]string{"Content-MD5": goodSHA256}, http.StatusBadRequest, "InvalidDigest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucketPath := setupBucket(t)
+			r := httptest.NewRequest(http.MethodPut, "/"+testBucket+"/object.txt", strings.NewReader(body))
+			for name, value := range tt.header {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			CreateObject(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			_, err := GetObjectMeta(bucketPath, "object.txt")
+			if tt.wantStatus != http.StatusOK {
+				if !strings.Contains(w.Body.String(), "<Code>"+tt.wantCode+"</Code>") {
+					t.Errorf("body = %s, want error code %s", w.Body.String(), tt.wantCode)
+				}
+				if err == nil {
+					t.Error("rejected object was stored")
+				}
+				assertNoTempFiles(t, bucketPath)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("stored object not found: %v", err)
+			}
+			if got, want := w.Header().Get("ETag"), `"`+hex.EncodeToString(md5Sum[:])+`"`; got != want {
+				t.Errorf("ETag = %s, want %s", got, want)
+			}
+			if got := w.Header().Get("X-Amz-Checksum-Sha256"); got != goodSHA256 {
+				t.Errorf("x-amz-checksum-sha256 = %s, want %s", got, goodSHA256)
+			}
+		})
+	}
+}
+
+func TestCreateObject_ChunkedSize(t *testing.T) {
+	bucketPath := setupBucket(t)
+	body := strings.Repeat("x", 10000)
+
+	r := httptest.NewRequest(http.MethodPut, "/"+testBucket+"/chunked.bin", io.MultiReader(strings.NewReader(body)))
+	r.ContentLength = -1
+	r.TransferEncoding = []string{"chunked"}
+	w := httptest.NewRecorder()
+	CreateObject(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	object, err := GetObjectMeta(bucketPath, "chunked.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.Size != "10000" {
+		t.Errorf("Size = %s, want 10000", object.Size)
+	}
+
+	sum := sha256.Sum256([]byte(body))
+	if object.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA256 = %s, want %x", object.SHA256, sum)
+	}
+	head := getObject(t, "chunked.bin", nil)
+	if got := head.Header().Get("X-Amz-Checksum-Sha256"); got != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("GET x-amz-checksum-sha256 = %s", got)
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"triple-s/flags"
+)
+
+func presignedTarget(method, contentType, path string, expires int64) string {
+	return fmt.Sprintf("%s?Expires=%d&Signature=%s", path, expires, Signature("secret", method, contentType, "", path, expires))
+}
+
+// presignedUpload is a presigned PUT bound to a body of size bytes.
+func presignedUpload(contentType string, size int, path string, expires int64) string {
+	length := fmt.Sprint(size)
+	return fmt.Sprintf("%s?Content-Length=%s&Expires=%d&Signature=%s", path, length, expires, Signature("secret", http.MethodPut, contentType, length, path, expires))
+}
+
+// The app computes the same signature, its tests pin the same value.
+func TestSignature(t *testing.T) {
+	const want = "JJfQ4ZAad6O3PdIVgpEVqGKvdXheo-wJnFJ4fOAS5Co"
+	if got := Signature("secret", http.MethodPut, "image/png", "1234", "/posts/cat.png", 1760000000); got != want {
+		t.Errorf("Signature = %s, want %s", got, want)
+	}
+	if Signature("secret", http.MethodHead, "", "", "/posts/cat.png", 1) != Signature("secret", http.MethodGet, "", "", "/posts/cat.png", 1) {
+		t.Error("HEAD not signed as GET")
+	}
+}
+
+func TestRequireSignature(t *testing.T) {
+	quietLogs(t)
+	defer func() { flags.PresignSecret = "" }()
+
+	served := false
+	handler := RequireSignature(func(w http.ResponseWriter, r *http.Request) { served = true })
+	request := func(method, target, contentType string) *httptest.ResponseRecorder {
+		served = false
+		r := httptest.NewRequest(method, target, strings.NewReader("data"))
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	flags.PresignSecret = ""
+	if request(http.MethodPut, "/photos/a.png", "image/png"); !served {
+		t.Error("unsigned PUT refused without a secret")
+	}
+
+	flags.PresignSecret = "secret"
+	future := time.Now().Add(time.Minute).Unix()
+	past := time.Now().Add(-time.Minute).Unix()
+	tests := []struct {
+		name, method, target, contentType string
+		wantCode                          string
+	}{
+		{"signed put", http.MethodPut, presignedTarget(http.MethodPut, "image/png", "/photos/a.png", future), "image/png", ""},
+		{"signed get", http.MethodGet, presignedTarget(http.MethodGet, "", "/photos/a.png", future), "", ""},
+		{"head with get signature", http.MethodHead, presignedTarget(http.MethodGet, "", "/photos/a.png", future), "", ""},
+		{"unsigned get", http.MethodGet, "/photos/a.png", "", ""},
+		{"unsigned put", http.MethodPut, "/photos/a.png", "image/png", "AccessDenied"},
+		{"unsigned delete", http.MethodDelete, "/photos/a.png", "", "AccessDenied"},
+		{"expired", http.MethodPut, presignedTarget(http.MethodPut, "image/png", "/photos/a.png", past), "image/png", "AccessDenied"},
+		{"other key", http.MethodPut, strings.Replace(presignedTarget(http.MethodPut, "image/png", "/photos/a.png", future), "a.png", "b.png", 1), "image/png", "SignatureDoesNotMatch"},
+		{"other method", http.MethodDelete, presignedTarget(http.MethodPut, "", "/photos/a.png", future), "", "SignatureDoesNotMatch"},
+		{"other content type", http.MethodPut, presignedTarget(http.MethodPut, "image/png", "/photos/a.png", future), "text/html", "SignatureDoesNotMatch"},
+		{"signed length", http.MethodPut, presignedUpload("image/png", 4, "/photos/a.png", future), "image/png", ""},
+		{"other length", http.MethodPut, presignedUpload("image/png", 5, "/photos/a.png", future), "image/png", "SignatureDoesNotMatch"},
+		{"length dropped", http.MethodPut, strings.Replace(presignedUpload("image/png", 4, "/photos/a.png", future), "Content-Length=4&", "", 1), "image/png", "SignatureDoesNotMatch"},
+		{"later expiry", http.MethodPut, strings.Replace(presignedTarget(http.MethodPut, "image/png", "/photos/a.png", future), fmt.Sprint(future), fmt.Sprint(future+3600), 1), "image/png", "SignatureDoesNotMatch"},
+	}
+	for _, tt := range tests {
+		w := request(tt.method, tt.target, tt.contentType)
+		if tt.wantCode == "" {
+			if !served {
+				t.Errorf("%s: refused with %d: %s", tt.name, w.Code, w.Body.String())
+			}
+			continue
+		}
+		if served || w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "<Code>"+tt.wantCode+"</Code>") {
+			t.Errorf("%s: served %v, status %d, body %s; want 403 %s", tt.name, served, w.Code, w.Body.String(), tt.wantCode)
+		}
+	}
+}
+
+func TestPresignedUpload(t *testing.T) {
+	setupBucket(t)
+	flags.PresignSecret = "secret"
+	defer func() { flags.PresignSecret = "" }()
+
+	target := presignedUpload("text/plain", 5, "/"+testBucket+"/posts/note.txt", time.Now().Add(time.Minute).Unix())
+	put := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "text/plain")
+		w := httptest.NewRecorder()
+		RequireSignature(CreateObject)(w, r)
+		return w
+	}
+	if w := put("hello"); w.Code != http.StatusOK {
+		t.Fatalf("presigned PUT: status %d: %s", w.Code, w.Body.String())
+	}
+
+	// The URL is spent: replaying it can't replace the object.
+	if w := put("HELLO"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("replayed PUT: status %d, want 412: %s", w.Code, w.Body.String())
+	}
+
+	if w := getObject(t, "posts/note.txt", nil); w.Body.String() != "hello" || w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("GET after presigned PUT: body %q, Content-Type %s", w.Body.String(), w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,399 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+	"triple-s/flags"
+	"triple-s/info"
+	"triple-s/utils"
+)
+
+// Problems the scrubber reports.
+const (
+	ScrubCorrupt     = "corrupt"      // content doesn't match the stored checksum
+	ScrubSize        = "size"         // size on disk differs from the metadata
+	ScrubMissing     = "missing"      // metadata entry without a file
+	ScrubUnmigrated  = "unmigrated"   // object still stored in the flat layout
+	ScrubOrphan      = "orphan"       // file without a metadata entry
+	ScrubUnhashed    = "unhashed"     // entry from before checksums were stored
+	ScrubStrayBucket = "stray-bucket" // directory that isn't in buckets.csv
+)
+
+type ScrubIssue struct {
+	Bucket    string `xml:"bucket"`
+	ObjectKey string `xml:"objectKey,omitempty"`
+	Path      string `xml:"path,omitempty"` // relative to the bucket, for files whose key is unknown
+	Problem   string `xml:"problem"`
+	Detail    string `xml:"detail,omitempty"`
+	Repaired  bool   `xml:"repaired"`
+}
+
+type ScrubReport struct {
+	XMLName    xml.Name     `xml:"scrubReport"`
+	StartedAt  string       `xml:"startedAt"`
+	FinishedAt string       `xml:"finishedAt"`
+	Repair     bool         `xml:"repair"`
+	Buckets    int          `xml:"buckets"`
+	Objects    int          `xml:"objects"`
+	Issues     []ScrubIssue `xml:"issue"`
+}
+
+// Unrepaired counts the issues still needing attention.
+func (r ScrubReport) Unrepaired() int {
+	n := 0
+	for _, issue := range r.Issues {
+		if !issue.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+var (
+	ErrScrubRunning = errors.New("scrub already running")
+
+	// errScrubSkip aborts a repair whose object changed since it was checked.
+	errScrubSkip = errors.New("object changed during scrub")
+
+	scrubMu    sync.Mutex
+	lastScrub  *ScrubReport
+	lastScrubM sync.Mutex
+)
+
+// Scrub walks every bucket, verifies each object against its stored size
+// and checksum and looks for drift between files and metadata. With repair
+// set it fixes what the metadata can fix: entries of missing files are
+// dropped, orphan files are adopted, objects of the flat layout are moved
+// to their ObjectPath and missing checksums are filled in.
+// Corrupt content is only reported, the metadata is the last good record.
+func Scrub(repair bool) (ScrubReport, error) {
+	if !scrubMu.TryLock() {
+		return ScrubReport{}, ErrScrubRunning
+	}
+	defer scrubMu.Unlock()
+
+	report := ScrubReport{StartedAt: time.Now().Format(time.RFC3339Nano), Repair: repair}
+
+	buckets, err := utils.ReadBucket()
+	if err != nil {
+		return report, fmt.Errorf("failed to read buckets: %w", err)
+	}
+
+	known := make(map[string]bool, len(buckets.Buckets))
+	for _, bucket := range buckets.Buckets {
+		known[bucket.Name] = true
+		if err := scrubBucket(&report, bucket.Name, repair); err != nil {
+			return report, fmt.Errorf("failed to scrub bucket %s: %w", bucket.Name, err)
+		}
+		report.Buckets++
+	}
+
+	entries, err := os.ReadDir(flags.Dir)
+	if err != nil {
+		return report, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !known[entry.Name()] {
+			report.Issues = append(report.Issues, ScrubIssue{Bucket: entry.Name(), Problem: ScrubStrayBucket})
+		}
+	}
+
+	report.FinishedAt = time.Now().Format(time.RFC3339Nano)
+
+	lastScrubM.Lock()
+	lastScrub = &report
+	lastScrubM.Unlock()
+	return report, nil
+}
+
+func scrubBucket(report *ScrubReport, bucketName string, repair bool) error {
+	bucketPath := GetBucketPath(bucketName)
+	objects, err := Metadata.List(bucketPath)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		report.Objects++
+
+		issue, fix := checkObject(bucketPath, object)
+		if issue == nil || objectChanged(bucketPath, object) {
+			continue
+		}
+		issue.Bucket = bucketName
+		if repair && fix != nil {
+			issue.Repaired = repairObject(bucketPath, object, fix)
+		}
+		report.Issues = append(report.Issues, *issue)
+	}
+
+	entries, err := os.ReadDir(bucketPath)
+	if err != nil {
+		return err
+	}
+	var sharded []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() && isShardDir(name) {
+			files, err := shardFiles(bucketPath, name)
+			if err != nil {
+				return err
+			}
+			sharded = append(sharded, files...)
+			continue
+		}
+		// Hidden files are uploads and metadata rewrites in progress.
+		if !isFlatObject(entry) {
+			continue
+		}
+		// A file of the flat layout with an entry is an object not moved
+		// yet, reported as unmigrated above, one without was never recorded.
+		if _, err := Metadata.Get(bucketPath, name); err == nil {
+			continue
+		}
+
+		issue := ScrubIssue{Bucket: bucketName, ObjectKey: name, Problem: ScrubOrphan}
+		if repair {
+			issue.Repaired = adoptOrphan(bucketPath, name)
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	orphans, err := shardOrphans(bucketPath, sharded)
+	if err != nil {
+		return err
+	}
+	for _, path := range orphans {
+		// The key can't be recovered from its hash, so these stay reported
+		// until someone looks at them.
+		report.Issues = append(report.Issues, ScrubIssue{Bucket: bucketName, Path: path, Problem: ScrubOrphan, Detail: "object key unknown"})
+	}
+	return nil
+}
+
+// shardFiles lists the files of one top-level shard directory, relative to
+// the bucket.
+func shardFiles(bucketPath, shard string) ([]string, error) {
+	subdirs, err := os.ReadDir(filepath.Join(bucketPath, shard))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, subdir := range subdirs {
+		if !subdir.IsDir() {
+			files = append(files, filepath.Join(shard, subdir.Name()))
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(bucketPath, shard, subdir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			files = append(files, filepath.Join(shard, subdir.Name(), entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// shardOrphans returns the files that belong to no object. The metadata is
+// listed after the directories were read so uploads that finished in
+// between aren't reported.
+func shardOrphans(bucketPath string, files []string) ([]string, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	objects, err := Metadata.List(bucketPath)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		known[ObjectPath(bucketPath, object.ObjectKey)] = true
+	}
+
+	var orphans []string
+	for _, file := range files {
+		if !known[filepath.Join(bucketPath, file)] {
+			orphans = append(orphans, file)
+		}
+	}
+	return orphans, nil
+}
+
+// scrubFix turns a metadata entry into its repaired form, nil drops it.
+// It runs under the bucket's metadata lock.
+type scrubFix func(info.Object) (*info.Object, error)
+
+// checkObject hashes one object. The returned fix, if any, is applied to
+// its metadata entry during repair.
+func checkObject(bucketPath string, object info.Object) (*ScrubIssue, scrubFix) {
+	objectPath := ObjectPath(bucketPath, object.ObjectKey)
+	size, md5Sum, sha256Sum, _, err := hashFile(objectPath)
+	if errors.Is(err, os.ErrNotExist) {
+		// Only a repair moves the file, a report leaves the disk as it is.
+		flatPath := filepath.Join(bucketPath, object.ObjectKey)
+		if stat, err := os.Lstat(flatPath); err == nil && stat.Mode().IsRegular() {
+			return &ScrubIssue{ObjectKey: object.ObjectKey, Problem: ScrubUnmigrated},
+				func(o info.Object) (*info.Object, error) { return &o, moveObject(flatPath, objectPath) }
+		}
+		return &ScrubIssue{ObjectKey: object.ObjectKey, Problem: ScrubMissing},
+			func(info.Object) (*info.Object, error) { return nil, nil }
+	}
+	if err != nil {
+		return &ScrubIssue{ObjectKey: object.ObjectKey, Problem: ScrubCorrupt, Detail: err.Error()}, nil
+	}
+
+	// Content that matches, or can't be checked, gets its recorded size and
+	// missing checksums filled in from the file.
+	fill := func(o info.Object) (*info.Object, error) {
+		o.Size = strconv.FormatInt(size, 10)
+		if o.SHA256 == "" {
+			o.ETag, o.SHA256 = md5Sum, sha256Sum
+		}
+		return &o, nil
+	}
+
+	switch {
+	case object.SHA256 != "" && object.SHA256 != sha256Sum:
+		return &ScrubIssue{ObjectKey: object.ObjectKey, Problem: ScrubCorrupt, Detail: "sha256 " + sha256Sum + " != " + object.SHA256}, nil
+	case object.SHA256 == "" && object.ETag != "" && object.ETag != md5Sum:
+		return &ScrubIssue{ObjectKey: object.ObjectKey, Problem: ScrubCorrupt, Detail: "md5 " + md5Sum + " != " + object.ETag}, nil
+	case object.Size != strconv.FormatInt(size, 10):
+		// Content matches, only the recorded size is off, e.g. -1 from a
+		// chunked upload before sizes were counted.
+		return &ScrubIssue{ObjectKey: object.ObjectKey, Problem: ScrubSize, Detail: fmt.Sprintf("%d bytes on disk, %s recorded", size, object.Size)},
+			fill
+	case object.SHA256 == "":
+		return &ScrubIssue{ObjectKey: object.ObjectKey, Problem: ScrubUnhashed},
+			fill
+	}
+	return nil, nil
+}
+
+// repairObject applies fix to an entry, provided no upload replaced the
+// entry since it was checked; uploads move files under the same lock.
+func repairObject(bucketPath string, scanned info.Object, fix scrubFix) bool {
+	err := Metadata.Update(bucketPath, scanned.ObjectKey, func(current *info.Object) (*info.Object, error) {
+		if current == nil || *current != scanned {
+			return nil, errScrubSkip
+		}
+		return fix(*current)
+	})
+	return logRepair(bucketPath, scanned.ObjectKey, err)
+}
+
+// adoptOrphan records a file of the flat layout left behind without
+// metadata, its name is the key, and moves it to its ObjectPath.
+func adoptOrphan(bucketPath, objectKey string) bool {
+	flatPath := filepath.Join(bucketPath, objectKey)
+	err := Metadata.Update(bucketPath, objectKey, func(current *info.Object) (*info.Object, error) {
+		if current != nil {
+			return nil, errScrubSkip
+		}
+		size, md5Sum, sha256Sum, head, err := hashFile(flatPath)
+		if err != nil {
+			return nil, err
+		}
+		stat, err := os.Stat(flatPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := moveObject(flatPath, ObjectPath(bucketPath, objectKey)); err != nil {
+			return nil, err
+		}
+		return &info.Object{
+			ObjectKey:    objectKey,
+			ContentType:  http.DetectContentType(head),
+			Size:         strconv.FormatInt(size, 10),
+			LastModified: stat.ModTime().Format(time.RFC3339Nano),
+			ETag:         md5Sum,
+			SHA256:       sha256Sum,
+		}, nil
+	})
+	return logRepair(bucketPath, objectKey, err)
+}
+
+func logRepair(bucketPath, objectKey string, err error) bool {
+	if err != nil {
+		if !errors.Is(err, errScrubSkip) {
+			log.Printf("Failed to repair metadata of %s in %s: %v\n", objectKey, bucketPath, err)
+		}
+		return false
+	}
+	log.Printf("Repaired metadata of %s in %s\n", objectKey, bucketPath)
+	return true
+}
+
+// hashFile returns size, hex MD5, hex SHA-256 and the first 512 bytes.
+func hashFile(path string) (int64, string, string, []byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", "", nil, err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, "", "", nil, err
+	}
+	head = head[:n]
+
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	hashes := io.MultiWriter(md5Hash, sha256Hash)
+	hashes.Write(head)
+	rest, err := io.Copy(hashes, file)
+	if err != nil {
+		return 0, "", "", nil, err
+	}
+	return int64(n) + rest, hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(sha256Hash.Sum(nil)), head, nil
+}
+
+// objectChanged tells a real problem from an upload or delete that ran
+// while the object was being checked.
+func objectChanged(bucketPath string, scanned info.Object) bool {
+	current, err := Metadata.Get(bucketPath, scanned.ObjectKey)
+	return err != nil || current != scanned
+}
+
+func isMetadataFile(name string) bool {
+	return name == "objects.csv" || name == "objects.log"
+}
+
+// LastScrub returns the report of the latest finished scrub, nil if none.
+func LastScrub() *ScrubReport {
+	lastScrubM.Lock()
+	defer lastScrubM.Unlock()
+	return lastScrub
+}
+
+// StartScrubWorker scrubs every interval without repairing, keeping the
+// report for the admin endpoint.
+func StartScrubWorker(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		log.Printf("Scrub worker started, interval %s", interval)
+		for range ticker.C {
+			report, err := Scrub(false)
+			if err != nil {
+				log.Printf("Scrub failed: %v\n", err)
+				continue
+			}
+			log.Printf("Scrub finished: %d buckets, %d objects, %d issues", report.Buckets, report.Objects, len(report.Issues))
+		}
+	}()
+}
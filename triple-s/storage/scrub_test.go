@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"triple-s/flags"
+	"triple-s/info"
+	"triple-s/utils"
+)
+
+// setupScrubBucket leaves the test bucket with one object of every kind the
+// scrubber reports, and returns its path.
+func setupScrubBucket(t *testing.T) string {
+	t.Helper()
+	quietLogs(t)
+	bucketPath := setupBucket(t)
+	if err := utils.WriteBucket(info.Buckets{Buckets: []info.Bucket{{Name: testBucket, Status: "Available"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	putObject(t, "healthy.txt", "text/plain", "fine")
+	putObject(t, "rotten.txt", "text/plain", "original")
+	putObject(t, "gone.txt", "text/plain", "deleted behind our back")
+	putObject(t, "flat.txt", "text/plain", "not moved yet")
+
+	// Bit rot, a lost file and files that never made it into the metadata,
+	// one left flat in the bucket, which names its key, and one sharded.
+	write := func(path, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(ObjectPath(bucketPath, "rotten.txt"), "0riginal")
+	if err := os.Remove(ObjectPath(bucketPath, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+	write(filepath.Join(bucketPath, "orphan.png"), "\x89PNG\r\n\x1a\n")
+	write(ObjectPath(bucketPath, "lost.txt"), "key unknown")
+
+	// An object of the flat layout, stored under its key.
+	if err := os.Rename(ObjectPath(bucketPath, "flat.txt"), filepath.Join(bucketPath, "flat.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	// An entry from before checksums and true sizes were recorded.
+	write(ObjectPath(bucketPath, "legacy.txt"), "old data")
+	err := Metadata.Update(bucketPath, "legacy.txt", func(*info.Object) (*info.Object, error) {
+		return &info.Object{ObjectKey: "legacy.txt", ContentType: "text/plain", Size: "-1", LastModified: "2024-01-02T15:04:05Z"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(filepath.Join(flags.Dir, "stray"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return bucketPath
+}
+
+func problems(report ScrubReport) map[string]ScrubIssue {
+	issues := make(map[string]ScrubIssue)
+	for _, issue := range report.Issues {
+		issues[issue.Bucket+"/"+issue.ObjectKey+issue.Path] = issue
+	}
+	return issues
+}
+
+func TestScrub_Report(t *testing.T) {
+	bucketPath := setupScrubBucket(t)
+
+	report, err := Scrub(false)
+	if err != nil {
+		t.Fatalf("Scrub: %v", err)
+	}
+	if report.Buckets != 1 || report.Objects != 5 {
+		t.Errorf("scrubbed %d buckets, %d objects; want 1, 5", report.Buckets, report.Objects)
+	}
+
+	lost, _ := filepath.Rel(bucketPath, ObjectPath(bucketPath, "lost.txt"))
+	want := map[string]string{
+		testBucket + "/rotten.txt": ScrubCorrupt,
+		testBucket + "/gone.txt":   ScrubMissing,
+		testBucket + "/flat.txt":   ScrubUnmigrated,
+		testBucket + "/orphan.png": ScrubOrphan,
+		testBucket + "/" + lost:    ScrubOrphan,
+		testBucket + "/legacy.txt": ScrubSize,
+		"stray/":                   ScrubStrayBucket,
+	}
+	issues := problems(report)
+	if len(issues) != len(want) {
+		t.Errorf("got %d issues, want %d: %+v", len(issues), len(want), report.Issues)
+	}
+	for key, problem := range want {
+		issue, ok := issues[key]
+		if !ok || issue.Problem != problem {
+			t.Errorf("%s: got %+v, want problem %s", key, issue, problem)
+		}
+		if issue.Repaired {
+			t.Errorf("%s repaired without -repair", key)
+		}
+	}
+
+	// Reporting alone changes nothing.
+	if _, err := Metadata.Get(bucketPath, "gone.txt"); err != nil {
+		t.Errorf("entry of missing file dropped without repair: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(bucketPath, "flat.txt")); err != nil {
+		t.Errorf("unmigrated object moved without repair: %v", err)
+	}
+	if LastScrub() == nil || len(LastScrub().Issues) != len(report.Issues) {
+		t.Error("LastScrub doesn't hold the report")
+	}
+}
+
+func TestScrub_Repair(t *testing.T) {
+	bucketPath := setupScrubBucket(t)
+
+	report, err := Scrub(true)
+	if err != nil {
+		t.Fatalf("Scrub: %v", err)
+	}
+	issues := problems(report)
+	for _, key := range []string{"gone.txt", "flat.txt", "orphan.png", "legacy.txt"} {
+		if !issues[testBucket+"/"+key].Repaired {
+			t.Errorf("%s not repaired: %+v", key, issues[testBucket+"/"+key])
+		}
+	}
+	if issues[testBucket+"/rotten.txt"].Repaired {
+		t.Error("corrupt content reported as repaired")
+	}
+
+	if _, err := Metadata.Get(bucketPath, "gone.txt"); err == nil {
+		t.Error("entry of missing file kept")
+	}
+	orphan, err := Metadata.Get(bucketPath, "orphan.png")
+	if err != nil || orphan.ContentType != "image/png" || orphan.Size != "8" || orphan.SHA256 == "" {
+		t.Errorf("orphan adopted as %+v, %v", orphan, err)
+	}
+	if _, err := os.Stat(ObjectPath(bucketPath, "orphan.png")); err != nil {
+		t.Errorf("adopted orphan not moved to its shard: %v", err)
+	}
+	if _, err := os.Stat(ObjectPath(bucketPath, "flat.txt")); err != nil {
+		t.Errorf("unmigrated object not moved to its shard: %v", err)
+	}
+
+	legacy, err := Metadata.Get(bucketPath, "legacy.txt")
+	if err != nil || legacy.Size != "8" || legacy.SHA256 == "" || legacy.ETag == "" {
+		t.Errorf("legacy entry repaired as %+v, %v", legacy, err)
+	}
+
+	// A second pass finds only what can't be repaired.
+	report, err = Scrub(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Unrepaired() != 3 {
+		t.Errorf("unrepaired issues after repair: %+v, want rotten.txt, lost.txt and stray", report.Issues)
+	}
+}
+
+func TestScrub_AdminEndpoint(t *testing.T) {
+	setupScrubBucket(t)
+	defer func() { flags.AdminToken = "" }()
+
+	request := func(method, target, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		if method == http.MethodPost {
+			RunScrub(w, r)
+		} else {
+			GetScrubReport(w, r)
+		}
+		return w
+	}
+
+	flags.AdminToken = ""
+	if w := request(http.MethodPost, "/_admin/scrub", "secret"); w.Code != http.StatusNotFound {
+		t.Errorf("disabled endpoint: status %d, want 404", w.Code)
+	}
+
+	flags.AdminToken = "secret"
+	if w := request(http.MethodPost, "/_admin/scrub", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d, want 401", w.Code)
+	}
+
+	w := request(http.MethodPost, "/_admin/scrub", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST: status %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "<problem>corrupt</problem>") {
+		t.Errorf("report misses the corrupt object: %s", w.Body.String())
+	}
+
+	w = request(http.MethodGet, "/_admin/scrub", "secret")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<scrubReport>") {
+		t.Errorf("GET: status %d: %s", w.Code, w.Body.String())
+	}
+}
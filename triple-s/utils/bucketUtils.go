@@ -23,3 +23,19 @@ func WriteBucket(bucketData info.Buckets) error {
 	records := BucketsToRecords(bucketData)
 	return WriteCSV(bucketPath, info.BucketsHeader, records)
 }
+
+// UpdateBuckets runs fn on the current buckets under the buckets.csv lock
+// and writes the result back. Nothing is written when fn fails.
+func UpdateBuckets(fn func(*info.Buckets) error) error {
+	unlock := LockFile(filepath.Join(flags.Dir, "buckets.csv"))
+	defer unlock()
+
+	bucketData, err := ReadBucket()
+	if err != nil {
+		return err
+	}
+	if err := fn(&bucketData); err != nil {
+		return err
+	}
+	return WriteBucket(bucketData)
+}
@@ -40,6 +40,16 @@ func RecordsToObjects(records [][]string) info.Objects {
 			Size:         record[2],
 			LastModified: record[3],
 		}
+		// Objects written before content hashes were kept have no ETag column.
+		if len(record) > 4 {
+			object.ETag = record[4]
+		}
+		if len(record) > 5 {
+			object.Metadata = record[5]
+		}
+		if len(record) > 6 {
+			object.SHA256 = record[6]
+		}
 		objects.Objects = append(objects.Objects, object)
 	}
 	return objects
@@ -54,6 +64,9 @@ func ObjectsToRecords(objects info.Objects) [][]string {
 			object.ContentType,
 			object.Size,
 			object.LastModified,
+			object.ETag,
+			object.Metadata,
+			object.SHA256,
 		}
 		records = append(records, record)
 	}
@@ -3,6 +3,7 @@ package utils
 import (
 	"encoding/csv"
 	"os"
+	"path/filepath"
 )
 
 func ReadCSV(filepath string) ([][]string, error) {
@@ -13,6 +14,7 @@ func ReadCSV(filepath string) ([][]string, error) {
 	defer file.Close()
 
 	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
 	records, err := reader.ReadAll()
 	if err != nil {
 		return nil, err
@@ -23,24 +25,74 @@ func ReadCSV(filepath string) ([][]string, error) {
 	return [][]string{}, nil
 }
 
-func WriteCSV(filepath string, header []string, records [][]string) error {
-	file, err := os.Create(filepath)
+// WriteCSV replaces the file atomically: the records go to a temporary file
+// in the same directory which is synced and renamed over the old one, so a
+// crash leaves either the previous or the new content, never a truncated file.
+func WriteCSV(path string, header []string, records [][]string) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	defer os.Remove(tmp.Name()) // no-op once renamed
 
+	writer := csv.NewWriter(tmp)
 	if header != nil {
 		if err := writer.Write(header); err != nil {
+			tmp.Close()
 			return err
 		}
 	}
-
 	if err := writer.WriteAll(records); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return SyncDir(dir)
+}
+
+// WriteFileAtomic replaces the file the way WriteCSV does.
+func WriteFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return SyncDir(dir)
+}
+
+// SyncDir makes a rename inside dir durable.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
 		return err
 	}
-	return nil
+	defer d.Close()
+	return d.Sync()
 }
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// fileLocks holds one mutex per metadata file. Entries are never removed,
+// there is one per bucket at most.
+var fileLocks sync.Map
+
+// LockFile serialises read-modify-write cycles on a metadata file within
+// this process and returns the matching unlock. Readers don't need it,
+// writes are atomic renames so a reader always sees a complete file.
+func LockFile(path string) (unlock func()) {
+	value, _ := fileLocks.LoadOrStore(filepath.Clean(path), &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
@@ -1,19 +1,16 @@
 package utils
 
 import (
-	"fmt"
 	"log"
 	"path/filepath"
-	"triple-s/flags"
 	"triple-s/info"
 )
 
-func ReadObjects(bucketName string) (info.Objects, error) {
-	objectPath := filepath.Join(bucketName, "objects.csv")
+func ReadObjects(bucketPath string) (info.Objects, error) {
+	objectPath := filepath.Join(bucketPath, "objects.csv")
 	log.Printf("Reading objects metadata from %s\n", objectPath)
 
 	records, err := ReadCSV(objectPath)
-	fmt.Println(records)
 	if err != nil {
 		return info.Objects{}, err
 	}
@@ -21,8 +18,8 @@ func ReadObjects(bucketName string) (info.Objects, error) {
 	return RecordsToObjects(records), nil
 }
 
-func WriteObject(bucketName string, objects info.Objects) error {
-	objectPath := filepath.Join(flags.Dir, bucketName, "objects.csv")
+func WriteObject(bucketPath string, objects info.Objects) error {
+	objectPath := filepath.Join(bucketPath, "objects.csv")
 	records := ObjectsToRecords(objects)
 	return WriteCSV(objectPath, info.ObjectsHeader, records)
 }